@@ -77,6 +77,13 @@ Create the name of the service account to use
 {{- default (include "spegel.fullname" .) .Values.serviceAccount.name }}
 {{- end }}
 
+{{/*
+Create the name of the private network secret to use
+*/}}
+{{- define "spegel.privateNetworkSecretName" -}}
+{{- default (printf "%s-private-network" (include "spegel.fullname" .)) .Values.privateNetwork.existingSecretName }}
+{{- end }}
+
 {{/*
 Image reference
 */}}
@@ -100,3 +107,12 @@ valueFrom:
     fieldPath: status.hostIP
 {{- end -}}
 {{- end -}}
+
+{{/*
+Registry mutual TLS requires the container runtime to connect over loopback, which is only possible with host networking.
+*/}}
+{{- define "spegel.registryMTLS" -}}
+{{- if or .Values.registryMTLSSecretName .Values.spegel.registryPeerIdentity -}}
+true
+{{- end -}}
+{{- end -}}
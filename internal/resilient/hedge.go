@@ -6,31 +6,73 @@ import (
 	"time"
 
 	"github.com/HdrHistogram/hdrhistogram-go"
+	lru "github.com/hashicorp/golang-lru/v2"
 )
 
+const (
+	hedgeWindows          = 3
+	hedgeWindowDuration   = time.Minute
+	hedgeMinPeerSamples   = 5
+	hedgeMaxDistributions = 1024
+)
+
+// HedgeKey identifies the latency distribution of a kind of request, optionally to a specific peer.
+type HedgeKey struct {
+	Kind string
+	Peer string
+}
+
 // Hedger keeps track of durations and triggers hedges after the given quantile duration.
+// Durations are tracked per kind of request and per peer, with observations decaying over time.
+// Peer distributions are bounded, the least recently used distribution is evicted when the max amount is reached.
 type Hedger struct {
-	hist        *hdrhistogram.Histogram
+	kindDists   map[HedgeKey]*latencyDistribution
+	peerDists   *lru.Cache[HedgeKey, *latencyDistribution]
 	percentiles []float64
 	initial     time.Duration
-	mx          sync.RWMutex
+	mx          sync.Mutex
+}
+
+// latencyDistribution is a histogram of durations made up of windows.
+// The oldest window is discarded as time passes so that old observations stop affecting the distribution.
+type latencyDistribution struct {
+	rotated time.Time
+	hist    *hdrhistogram.WindowedHistogram
 }
 
 // NewHedger returns a hedger with the given quantile.
 func NewHedger(percentiles []float64, initial time.Duration) *Hedger {
-	hist := hdrhistogram.New(0, int64(500*time.Millisecond), 1)
+	//nolint: errcheck // Creating the cache only fails when the size is not positive.
+	peerDists, _ := lru.New[HedgeKey, *latencyDistribution](hedgeMaxDistributions)
 	return &Hedger{
+		kindDists:   map[HedgeKey]*latencyDistribution{},
+		peerDists:   peerDists,
 		percentiles: percentiles,
-		hist:        hist,
 		initial:     initial,
 	}
 }
 
 // durationAtPercentile returns the duration at the given percentile, or the the initial duration if no data is available.
-func (h *Hedger) durationAtPercentile(percentile float64) time.Duration {
-	h.mx.RLock()
-	value := h.hist.ValueAtPercentile(percentile)
-	h.mx.RUnlock()
+// The distribution of the peer is used once it has enough observations, otherwise the distribution of the kind is used.
+func (h *Hedger) durationAtPercentile(key HedgeKey, percentile float64) time.Duration {
+	h.mx.Lock()
+	defer h.mx.Unlock()
+
+	now := time.Now()
+	value := int64(0)
+	if key.Peer != "" {
+		if dist, ok := h.peerDists.Get(key); ok {
+			hist := dist.merged(now)
+			if hist.TotalCount() >= hedgeMinPeerSamples {
+				value = hist.ValueAtPercentile(percentile)
+			}
+		}
+	}
+	if value == 0 {
+		if dist, ok := h.kindDists[HedgeKey{Kind: key.Kind}]; ok {
+			value = dist.merged(now).ValueAtPercentile(percentile)
+		}
+	}
 	if value == 0 {
 		return h.initial
 	}
@@ -38,11 +80,11 @@ func (h *Hedger) durationAtPercentile(percentile float64) time.Duration {
 }
 
 // HighestPercentileDuration returns the duration for the highest percentile.
-func (h *Hedger) HighestPercentileDuration() time.Duration {
+func (h *Hedger) HighestPercentileDuration(key HedgeKey) time.Duration {
 	if len(h.percentiles) == 0 {
 		return h.initial
 	}
-	return h.durationAtPercentile(h.percentiles[len(h.percentiles)-1])
+	return h.durationAtPercentile(key, h.percentiles[len(h.percentiles)-1])
 }
 
 // Size returns the amount of times a hedge channel will be triggered.
@@ -51,19 +93,33 @@ func (h *Hedger) Size() int {
 }
 
 // Observe adds the duration to be used in hedge duration calculation.
-func (h *Hedger) Observe(d time.Duration) error {
+// The duration is added to the distribution of the kind and of the peer if it is set.
+func (h *Hedger) Observe(key HedgeKey, d time.Duration) error {
 	h.mx.Lock()
 	defer h.mx.Unlock()
-	return h.hist.RecordValue(d.Milliseconds())
+
+	now := time.Now()
+	keys := []HedgeKey{{Kind: key.Kind}}
+	if key.Peer != "" {
+		keys = append(keys, key)
+	}
+	for _, key := range keys {
+		err := h.distribution(key, now).record(now, d)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // Channel returns a channel which tirggers after the percentile hedge durations.
-func (h *Hedger) Channel(ctx context.Context) <-chan any {
+// The key is resolved before every hedge so that the duration matches the latest request.
+func (h *Hedger) Channel(ctx context.Context, key func() HedgeKey) <-chan any {
 	ch := make(chan any, len(h.percentiles))
 	go func() {
 		start := time.Now()
 		for _, percentile := range h.percentiles {
-			hedgeDuration := h.durationAtPercentile(percentile)
+			hedgeDuration := h.durationAtPercentile(key(), percentile)
 
 			d := max(hedgeDuration-time.Since(start), 0)
 			select {
@@ -77,3 +133,49 @@ func (h *Hedger) Channel(ctx context.Context) <-chan any {
 	}()
 	return ch
 }
+
+// distribution returns the distribution of the key, creating it if it does not exist.
+func (h *Hedger) distribution(key HedgeKey, now time.Time) *latencyDistribution {
+	if key.Peer == "" {
+		dist, ok := h.kindDists[key]
+		if !ok {
+			dist = newLatencyDistribution(now)
+			h.kindDists[key] = dist
+		}
+		return dist
+	}
+	dist, ok := h.peerDists.Get(key)
+	if !ok {
+		dist = newLatencyDistribution(now)
+		h.peerDists.Add(key, dist)
+	}
+	return dist
+}
+
+func newLatencyDistribution(now time.Time) *latencyDistribution {
+	return &latencyDistribution{
+		rotated: now,
+		hist:    hdrhistogram.NewWindowed(hedgeWindows, 0, int64(500*time.Millisecond), 1),
+	}
+}
+
+func (d *latencyDistribution) record(now time.Time, v time.Duration) error {
+	d.rotate(now)
+	return d.hist.Current.RecordValue(v.Milliseconds())
+}
+
+func (d *latencyDistribution) merged(now time.Time) *hdrhistogram.Histogram {
+	d.rotate(now)
+	return d.hist.Merge()
+}
+
+// rotate discards a window for every window duration passed since the last rotation.
+func (d *latencyDistribution) rotate(now time.Time) {
+	for i := 0; i < hedgeWindows && now.Sub(d.rotated) >= hedgeWindowDuration; i++ {
+		d.hist.Rotate()
+		d.rotated = d.rotated.Add(hedgeWindowDuration)
+	}
+	if now.Sub(d.rotated) >= hedgeWindowDuration {
+		d.rotated = now
+	}
+}
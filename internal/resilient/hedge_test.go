@@ -1,6 +1,7 @@
 package resilient
 
 import (
+	"strconv"
 	"testing"
 	"testing/synctest"
 	"time"
@@ -46,12 +47,12 @@ func TestHedger(t *testing.T) {
 			hedger := NewHedger([]float64{80, 90, 95}, 100*time.Millisecond)
 			require.EqualT(t, 3, hedger.Size())
 			for _, d := range tt.observations {
-				err := hedger.Observe(d)
+				err := hedger.Observe(HedgeKey{Kind: "blob"}, d)
 				require.NoError(t, err)
 			}
 
 			synctest.Test(t, func(t *testing.T) {
-				ch := hedger.Channel(t.Context())
+				ch := hedger.Channel(t.Context(), func() HedgeKey { return HedgeKey{Kind: "blob", Peer: "foo"} })
 				start := time.Now()
 				durations := []time.Duration{}
 				for range 3 {
@@ -97,10 +98,67 @@ func TestHedgerHighestPercentileDuration(t *testing.T) {
 			t.Parallel()
 			hedger := NewHedger(tt.percentiles, 100*time.Millisecond)
 			for _, d := range tt.observations {
-				err := hedger.Observe(d)
+				err := hedger.Observe(HedgeKey{Kind: "blob"}, d)
 				require.NoError(t, err)
 			}
-			require.InEpsilon(t, tt.want, hedger.HighestPercentileDuration(), 0.01)
+			require.InEpsilon(t, tt.want, hedger.HighestPercentileDuration(HedgeKey{Kind: "blob"}), 0.01)
 		})
 	}
 }
+
+func TestHedgerDistributions(t *testing.T) {
+	t.Parallel()
+
+	synctest.Test(t, func(t *testing.T) {
+		hedger := NewHedger([]float64{90}, 100*time.Millisecond)
+		for range hedgeMinPeerSamples {
+			err := hedger.Observe(HedgeKey{Kind: "blob", Peer: "slow"}, 400*time.Millisecond)
+			require.NoError(t, err)
+		}
+		for range hedgeMinPeerSamples - 1 {
+			err := hedger.Observe(HedgeKey{Kind: "blob", Peer: "fast"}, 20*time.Millisecond)
+			require.NoError(t, err)
+		}
+		err := hedger.Observe(HedgeKey{Kind: "manifest", Peer: "slow"}, 10*time.Millisecond)
+		require.NoError(t, err)
+
+		// Peers use their own distribution once they have enough observations, otherwise the kind distribution is used.
+		require.EqualT(t, 415*time.Millisecond, hedger.HighestPercentileDuration(HedgeKey{Kind: "blob", Peer: "slow"}))
+		require.EqualT(t, 415*time.Millisecond, hedger.HighestPercentileDuration(HedgeKey{Kind: "blob", Peer: "fast"}))
+		err = hedger.Observe(HedgeKey{Kind: "blob", Peer: "fast"}, 20*time.Millisecond)
+		require.NoError(t, err)
+		require.EqualT(t, 20*time.Millisecond, hedger.HighestPercentileDuration(HedgeKey{Kind: "blob", Peer: "fast"}))
+		require.EqualT(t, 10*time.Millisecond, hedger.HighestPercentileDuration(HedgeKey{Kind: "manifest", Peer: "fast"}))
+		require.EqualT(t, 100*time.Millisecond, hedger.HighestPercentileDuration(HedgeKey{Kind: "unknown"}))
+
+		// Observations decay once all windows have passed.
+		time.Sleep(hedgeWindowDuration)
+		require.EqualT(t, 20*time.Millisecond, hedger.HighestPercentileDuration(HedgeKey{Kind: "blob", Peer: "fast"}))
+		time.Sleep((hedgeWindows - 1) * hedgeWindowDuration)
+		require.EqualT(t, 100*time.Millisecond, hedger.HighestPercentileDuration(HedgeKey{Kind: "blob", Peer: "fast"}))
+		err = hedger.Observe(HedgeKey{Kind: "blob", Peer: "slow"}, 50*time.Millisecond)
+		require.NoError(t, err)
+		require.EqualT(t, 51*time.Millisecond, hedger.HighestPercentileDuration(HedgeKey{Kind: "blob", Peer: "slow"}))
+	})
+}
+
+func TestHedgerDistributionEviction(t *testing.T) {
+	t.Parallel()
+
+	hedger := NewHedger([]float64{90}, 100*time.Millisecond)
+	for i := range hedgeMaxDistributions {
+		err := hedger.Observe(HedgeKey{Kind: "blob", Peer: strconv.Itoa(i)}, 20*time.Millisecond)
+		require.NoError(t, err)
+	}
+	require.EqualT(t, hedgeMaxDistributions, hedger.peerDists.Len())
+
+	// Using a distribution makes it recently used so that it is not evicted.
+	hedger.HighestPercentileDuration(HedgeKey{Kind: "blob", Peer: "0"})
+	err := hedger.Observe(HedgeKey{Kind: "blob", Peer: "new"}, 20*time.Millisecond)
+	require.NoError(t, err)
+	require.EqualT(t, hedgeMaxDistributions, hedger.peerDists.Len())
+	require.TrueT(t, hedger.peerDists.Contains(HedgeKey{Kind: "blob", Peer: "0"}))
+	require.FalseT(t, hedger.peerDists.Contains(HedgeKey{Kind: "blob", Peer: "1"}))
+	require.TrueT(t, hedger.peerDists.Contains(HedgeKey{Kind: "blob", Peer: "new"}))
+	require.Len(t, hedger.kindDists, 1)
+}
@@ -2,12 +2,14 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"log/slog"
 	"net"
 	"net/http"
 	"net/http/pprof"
+	"net/netip"
 	"net/url"
 	"os"
 	"os/signal"
@@ -18,6 +20,8 @@ import (
 	"github.com/alexflint/go-arg"
 	"github.com/go-logr/logr"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
 
 	"github.com/kvick-org/pkg/errgroup"
 	"github.com/kvick-org/pkg/version"
@@ -27,6 +31,9 @@ import (
 	"github.com/spegel-org/spegel/pkg/metrics"
 	"github.com/spegel-org/spegel/pkg/oci"
 	"github.com/spegel-org/spegel/pkg/oci/containerd"
+	"github.com/spegel-org/spegel/pkg/oci/crio"
+	"github.com/spegel-org/spegel/pkg/oci/docker"
+	"github.com/spegel-org/spegel/pkg/oci/layout"
 	"github.com/spegel-org/spegel/pkg/preflight"
 	"github.com/spegel-org/spegel/pkg/registry"
 	"github.com/spegel-org/spegel/pkg/routing"
@@ -39,7 +46,10 @@ type VersionCmd struct {
 }
 
 type ConfigurationCmd struct {
+	ContainerRuntime             string   `arg:"--container-runtime,env:CONTAINER_RUNTIME" default:"containerd" help:"Container runtime to configure, either containerd, crio or docker."`
 	ContainerdRegistryConfigPath string   `arg:"--containerd-registry-config-path,env:CONTAINERD_REGISTRY_CONFIG_PATH" default:"/etc/containerd/certs.d" help:"Directory where mirror configuration is written."`
+	CRIORegistryConfigPath       string   `arg:"--crio-registry-config-path,env:CRIO_REGISTRY_CONFIG_PATH" default:"/etc/containers/registries.conf.d" help:"Directory where CRI-O mirror configuration is written."`
+	DockerDaemonConfigPath       string   `arg:"--docker-daemon-config-path,env:DOCKER_DAEMON_CONFIG_PATH" default:"/etc/docker/daemon.json" help:"Path to the Docker daemon configuration where registry mirrors are written."`
 	MirroredRegistries           []string `arg:"--mirrored-registries,env:MIRRORED_REGISTRIES" help:"Registries that are configured to be mirrored, if slice is empty all registires are mirrored."`
 	MirrorTargets                []string `arg:"--mirror-targets,env:MIRROR_TARGETS,required" help:"registries that are configured to act as mirrors."`
 	ResolveTags                  bool     `arg:"--resolve-tags,env:RESOLVE_TAGS" default:"true" help:"When true Spegel will resolve tags to digests."`
@@ -47,33 +57,67 @@ type ConfigurationCmd struct {
 }
 
 type BootstrapConfig struct {
-	BootstrapKind        string   `arg:"--bootstrap-kind,env:BOOTSTRAP_KIND" help:"Kind of bootsrapper to use."`
+	BootstrapKind        []string `arg:"--bootstrap-kind,env:BOOTSTRAP_KIND" help:"Kinds of bootsrapper to use, either dns, http, static, kubernetes or mdns. Peers from multiple kinds are combined in order."`
 	DNSBootstrapDomain   string   `arg:"--dns-bootstrap-domain,env:DNS_BOOTSTRAP_DOMAIN" help:"Domain to use when bootstrapping using DNS."`
 	HTTPBootstrapAddr    string   `arg:"--http-bootstrap-addr,env:HTTP_BOOTSTRAP_ADDR" help:"Address to serve for HTTP bootstrap at /id. Leave it empty to disable serving."`
 	HTTPBootstrapURL     url.URL  `arg:"--http-bootstrap-url,env:HTTP_BOOTSTRAP_URL" help:"Full URL of an HTTP bootstrap endpoint."`
 	HTTPBootstrapCertDir string   `arg:"--http-bootstrap-cert-dir,env:HTTP_BOOTSTRAP_CERT_DIR" help:"Path to directory containing CA and TLS certificate."`
 	StaticBootstrapPeers []string `arg:"--static-bootstrap-peers,env:STATIC_BOOTSTRAP_PEERS" help:"Static list of peers to bootstrap with."`
+	KubernetesNamespace  string   `arg:"--kubernetes-bootstrap-namespace,env:KUBERNETES_BOOTSTRAP_NAMESPACE" help:"Namespace of the Kubernetes service to bootstrap with."`
+	KubernetesService    string   `arg:"--kubernetes-bootstrap-service,env:KUBERNETES_BOOTSTRAP_SERVICE" help:"Name of the Kubernetes service whose EndpointSlices are used to bootstrap."`
 }
 
 type RegistryCmd struct {
 	BootstrapConfig
 	MetricsAddr           string           `arg:"--metrics-addr,env:METRICS_ADDR" default:":9090" help:"address to serve metrics."`
+	ContainerRuntime      string           `arg:"--container-runtime,env:CONTAINER_RUNTIME" default:"containerd" help:"Container runtime to read content from, either containerd, crio or docker."`
 	ContainerdSock        string           `arg:"--containerd-sock,env:CONTAINERD_SOCK" default:"/run/containerd/containerd.sock" help:"Endpoint of containerd service."`
-	ContainerdNamespace   string           `arg:"--containerd-namespace,env:CONTAINERD_NAMESPACE" default:"k8s.io" help:"Containerd namespace to fetch images from."`
+	ContainerdNamespace   []string         `arg:"--containerd-namespace,env:CONTAINERD_NAMESPACE" help:"Containerd namespaces to fetch images from, defaults to k8s.io. Content is served from the first namespace which contains it."`
 	ContainerdContentPath string           `arg:"--containerd-content-path,env:CONTAINERD_CONTENT_PATH" default:"/var/lib/containerd/io.containerd.content.v1.content" help:"Path to Containerd content store."`
+	CRIOStorageRoot       string           `arg:"--crio-storage-root,env:CRIO_STORAGE_ROOT" default:"/var/lib/containers/storage" help:"Root directory of the CRI-O containers storage."`
+	CRIOStorageDriver     string           `arg:"--crio-storage-driver,env:CRIO_STORAGE_DRIVER" default:"overlay" help:"Storage driver used by the CRI-O containers storage."`
+	DockerContainerdSock  string           `arg:"--docker-containerd-sock,env:DOCKER_CONTAINERD_SOCK" default:"/run/docker/containerd/containerd.sock" help:"Endpoint of the containerd service used by Docker."`
+	DockerNamespace       string           `arg:"--docker-namespace,env:DOCKER_NAMESPACE" help:"Containerd namespace used by Docker, detected when not set."`
+	DockerContentPath     string           `arg:"--docker-content-path,env:DOCKER_CONTENT_PATH" help:"Path to the content store of the containerd service used by Docker, detected when not set."`
+	OCILayoutDirs         []string         `arg:"--oci-layout-dirs,env:OCI_LAYOUT_DIRS" help:"OCI image layout directories to serve content from in addition to the container runtime."`
 	DataDir               string           `arg:"--data-dir,env:DATA_DIR" default:"" help:"Directory where data is persisted."`
 	RouterAddr            string           `arg:"--router-addr,env:ROUTER_ADDR" default:":5001" help:"address to serve router."`
+	RouterPSKPath         string           `arg:"--router-psk-path,env:ROUTER_PSK_PATH" help:"Path to a libp2p pre-shared key, when set only peers with the same key can connect to the router."`
+	RouterTransports      []string         `arg:"--router-transports,env:ROUTER_TRANSPORTS" help:"Transports used by the router, either tcp, quic or websocket. Defaults to tcp."`
 	RegistryAddr          string           `arg:"--registry-addr,env:REGISTRY_ADDR" default:":5000" help:"address to server image registry."`
+	RegistryMTLSCertDir   string           `arg:"--registry-mtls-cert-dir,env:REGISTRY_MTLS_CERT_DIR" help:"Path to directory containing CA and TLS certificate used for mutual TLS between peers. Plain HTTP is still served for the local container runtime."`
+	RegistryPeerIdentity  bool             `arg:"--registry-peer-identity,env:REGISTRY_PEER_IDENTITY" default:"false" help:"When true peers use mutual TLS with certificates bound to their libp2p identity. The identity is verified when fetching from peers, and requests are only served to peers connected to the router."`
 	MirroredRegistries    []string         `arg:"--mirrored-registries,env:MIRRORED_REGISTRIES" help:"Registries that are configured to be mirrored, if slice is empty all registries are mirrored."`
 	RegistryFilters       []*regexp.Regexp `arg:"--registry-filters,env:REGISTRY_FILTERS" help:"Regular expressions to filter out tags/registries, if slice is empty all registries/tags are resolved."`
 	MirrorResolveTimeout  time.Duration    `arg:"--mirror-resolve-timeout,env:MIRROR_RESOLVE_TIMEOUT" default:"20ms" help:"Max duration spent finding a mirror."`
 	MirrorResolveRetries  int              `arg:"--mirror-resolve-retries,env:MIRROR_RESOLVE_RETRIES" default:"3" help:"Max amount of mirrors to attempt."`
 	DebugWebEnabled       bool             `arg:"--debug-web-enabled,env:DEBUG_WEB_ENABLED" default:"true" help:"When true enables debug web page."`
+	MirrorCacheEnabled    bool             `arg:"--mirror-cache-enabled,env:MIRROR_CACHE_ENABLED" default:"false" help:"When true mirrored content is written to the local content store."`
+	UpstreamFallback      bool             `arg:"--upstream-fallback,env:UPSTREAM_FALLBACK" default:"false" help:"When true content is fetched from the upstream registry if no peer can serve it."`
+	UpstreamCoordination  bool             `arg:"--upstream-coordination,env:UPSTREAM_COORDINATION" default:"false" help:"When true only a single peer fetches content from the upstream registry while other peers fetch from it."`
+	UpstreamClaimTimeout  time.Duration    `arg:"--upstream-claim-timeout,env:UPSTREAM_CLAIM_TIMEOUT" default:"10s" help:"Max duration spent waiting for a peer which has claimed an upstream fetch before fetching from upstream."`
+	IngestStreaming       bool             `arg:"--ingest-streaming,env:INGEST_STREAMING" default:"false" help:"When true content is advertised and served to peers while it is being written to the mirror cache or pulled by the container runtime."`
+	PeerQuarantine        time.Duration    `arg:"--peer-quarantine,env:PEER_QUARANTINE" default:"5m" help:"Duration peers which served content not matching its digest are excluded from mirroring, zero disables quarantine."`
+	PeerAllowlistCIDRs    []netip.Prefix   `arg:"--peer-allowlist-cidrs,env:PEER_ALLOWLIST_CIDRS" help:"CIDRs of peers allowed to connect to the router and to be fetched from."`
+	PeerAllowlistNodes    bool             `arg:"--peer-allowlist-nodes,env:PEER_ALLOWLIST_NODES" default:"false" help:"When true peers with the addresses or Pod CIDRs of Kubernetes Nodes are allowed to connect to the router and to be fetched from."`
+	EgressRateLimit       int64            `arg:"--egress-rate-limit,env:EGRESS_RATE_LIMIT" default:"0" help:"Max bytes per second served to all peers combined, zero disables the limit."`
+	EgressClientRateLimit int64            `arg:"--egress-client-rate-limit,env:EGRESS_CLIENT_RATE_LIMIT" default:"0" help:"Max bytes per second served to each peer, zero disables the limit."`
+	MaxConcurrentUploads  int              `arg:"--max-concurrent-uploads,env:MAX_CONCURRENT_UPLOADS" default:"0" help:"Max amount of blobs served to peers at the same time, zero disables the limit."`
+	ChunkSize             int64            `arg:"--chunk-size,env:CHUNK_SIZE" default:"0" help:"Blobs larger than the chunk size in bytes are fetched in chunks from multiple peers concurrently, zero disables chunked fetching."`
+	ChunkConcurrency      int              `arg:"--chunk-concurrency,env:CHUNK_CONCURRENCY" default:"4" help:"Max amount of chunks fetched at the same time for a single blob."`
+	TopologyRegion        string           `arg:"--topology-region,env:TOPOLOGY_REGION" help:"Region the peer is located in."`
+	TopologyZone          string           `arg:"--topology-zone,env:TOPOLOGY_ZONE" help:"Zone the peer is located in."`
+	TopologyRack          string           `arg:"--topology-rack,env:TOPOLOGY_RACK" help:"Rack the peer is located in."`
+	TopologyNodeName      string           `arg:"--topology-node-name,env:TOPOLOGY_NODE_NAME" help:"Name of the Kubernetes Node to read the region and zone labels from when they are not set."`
+	TopologyPolicy        string           `arg:"--topology-policy,env:TOPOLOGY_POLICY" default:"none" help:"Policy used to prefer peers by locality, either none, rack, zone or region."`
 }
 
 type CleanupCmd struct {
 	Addr                         string `arg:"--addr,required,env:ADDR" help:"address to run readiness probe on."`
+	ContainerRuntime             string `arg:"--container-runtime,env:CONTAINER_RUNTIME" default:"containerd" help:"Container runtime to clean up, either containerd, crio or docker."`
 	ContainerdRegistryConfigPath string `arg:"--containerd-registry-config-path,env:CONTAINERD_REGISTRY_CONFIG_PATH" default:"/etc/containerd/certs.d" help:"Directory where mirror configuration is written."`
+	CRIORegistryConfigPath       string `arg:"--crio-registry-config-path,env:CRIO_REGISTRY_CONFIG_PATH" default:"/etc/containers/registries.conf.d" help:"Directory where CRI-O mirror configuration is written."`
+	DockerDaemonConfigPath       string `arg:"--docker-daemon-config-path,env:DOCKER_DAEMON_CONFIG_PATH" default:"/etc/docker/daemon.json" help:"Path to the Docker daemon configuration where registry mirrors are written."`
 }
 
 type CleanupWaitCmd struct {
@@ -157,7 +201,16 @@ func configurationCommand(ctx context.Context, args *ConfigurationCmd) error {
 	if err != nil {
 		return err
 	}
-	err = containerd.AddMirrorConfiguration(ctx, args.ContainerdRegistryConfigPath, args.MirroredRegistries, args.MirrorTargets, args.ResolveTags, args.PrependExisting, userinfo)
+	switch args.ContainerRuntime {
+	case "containerd":
+		err = containerd.AddMirrorConfiguration(ctx, args.ContainerdRegistryConfigPath, args.MirroredRegistries, args.MirrorTargets, args.ResolveTags, args.PrependExisting, userinfo)
+	case "crio":
+		err = crio.AddMirrorConfiguration(ctx, args.CRIORegistryConfigPath, args.MirroredRegistries, args.MirrorTargets, args.ResolveTags, userinfo)
+	case "docker":
+		err = docker.AddMirrorConfiguration(ctx, args.DockerDaemonConfigPath, args.MirroredRegistries, args.MirrorTargets, args.PrependExisting, userinfo)
+	default:
+		err = fmt.Errorf("unknown container runtime %s", args.ContainerRuntime)
+	}
 	if err != nil {
 		return err
 	}
@@ -195,11 +248,45 @@ func registryCommand(ctx context.Context, args *RegistryCmd) error {
 	}
 
 	// OCI Store
-	ociStore, err := containerd.NewContainerd(ctx, args.ContainerdSock, args.ContainerdNamespace, containerd.WithContentPath(args.ContainerdContentPath))
-	if err != nil {
-		return err
+	var ociStore oci.Store
+	switch args.ContainerRuntime {
+	case "containerd":
+		containerdNamespaces := args.ContainerdNamespace
+		if len(containerdNamespaces) == 0 {
+			containerdNamespaces = []string{"k8s.io"}
+		}
+		containerdStore, err := containerd.NewContainerd(ctx, args.ContainerdSock, containerdNamespaces, containerd.WithContentPath(args.ContainerdContentPath))
+		if err != nil {
+			return err
+		}
+		defer containerdStore.Close()
+		ociStore = containerdStore
+	case "crio":
+		ociStore, err = crio.NewCRIO(args.CRIOStorageRoot, crio.WithStorageDriver(args.CRIOStorageDriver))
+		if err != nil {
+			return err
+		}
+	case "docker":
+		dockerStore, err := docker.NewDocker(ctx, args.DockerContainerdSock, docker.WithNamespace(args.DockerNamespace), docker.WithContentPath(args.DockerContentPath))
+		if err != nil {
+			return err
+		}
+		defer dockerStore.Close()
+		ociStore = dockerStore
+	default:
+		return fmt.Errorf("unknown container runtime %s", args.ContainerRuntime)
+	}
+	if len(args.OCILayoutDirs) > 0 {
+		layoutStore, err := layout.NewLayout(args.OCILayoutDirs)
+		if err != nil {
+			return err
+		}
+		// Container runtime content takes priority over layout content.
+		ociStore, err = oci.NewMultiStore(ociStore, layoutStore)
+		if err != nil {
+			return err
+		}
 	}
-	defer ociStore.Close()
 
 	// Router
 	_, registryPort, err := net.SplitHostPort(args.RegistryAddr)
@@ -212,6 +299,31 @@ func registryCommand(ctx context.Context, args *RegistryCmd) error {
 	}
 	routerOpts := []routing.P2PRouterOption{
 		routing.WithDataDir(args.DataDir),
+		routing.WithPSKPath(args.RouterPSKPath),
+	}
+	if len(args.RouterTransports) > 0 {
+		routerOpts = append(routerOpts, routing.WithTransports(args.RouterTransports...))
+	}
+	topology, err := getTopology(ctx, args)
+	if err != nil {
+		return err
+	}
+	topologyPolicy, err := routing.ParseTopologyPolicy(args.TopologyPolicy)
+	if err != nil {
+		return err
+	}
+	loadTracker := routing.NewLoadTracker()
+	scoreboard := routing.NewScoreboard()
+	routerOpts = append(routerOpts, routing.WithTopology(topology, topologyPolicy), routing.WithPeerLoadTracker(loadTracker), routing.WithPeerScoreboard(scoreboard))
+	allowlist, err := getAllowlist(ctx, args.PeerAllowlistCIDRs, args.PeerAllowlistNodes)
+	if err != nil {
+		return err
+	}
+	if allowlist != nil {
+		routerOpts = append(routerOpts, routing.WithAllowlist(allowlist))
+		group.Go(func(ctx context.Context) error {
+			return allowlist.Run(ctx)
+		})
 	}
 	router, err := routing.NewP2PRouter(ctx, args.RouterAddr, bootstrapper, registryPort, routerOpts...)
 	if err != nil {
@@ -233,6 +345,15 @@ func registryCommand(ctx context.Context, args *RegistryCmd) error {
 		}
 		return nil
 	})
+	if ingestStore, ok := ociStore.(oci.IngestStore); ok && args.IngestStreaming {
+		group.Go(func(ctx context.Context) error {
+			err := state.TrackIngests(ctx, ingestStore, router, time.Second)
+			if err != nil && !errors.Is(err, context.Canceled) {
+				return err
+			}
+			return nil
+		})
+	}
 
 	// Registry
 	userinfo, err := httpx.LoadUserinfo("/etc/secrets/basic-auth")
@@ -245,6 +366,48 @@ func registryCommand(ctx context.Context, args *RegistryCmd) error {
 		registry.WithResolveTimeout(args.MirrorResolveTimeout),
 		registry.WithUserinfo(userinfo),
 		registry.WithOCIClient(ociClient),
+		registry.WithMirrorCache(args.MirrorCacheEnabled),
+		registry.WithUpstreamFallback(args.UpstreamFallback),
+		registry.WithUpstreamCoordination(args.UpstreamCoordination),
+		registry.WithUpstreamClaimTimeout(args.UpstreamClaimTimeout),
+		registry.WithPeerID(router.Host().ID().String()),
+		registry.WithIngestStreaming(args.IngestStreaming),
+		registry.WithPeerQuarantine(args.PeerQuarantine),
+		registry.WithPeerAllowlist(allowlist),
+		registry.WithPeerLoadTracker(loadTracker),
+		registry.WithPeerScoreboard(scoreboard),
+		registry.WithEgressRateLimit(args.EgressRateLimit),
+		registry.WithClientEgressRateLimit(args.EgressClientRateLimit),
+		registry.WithMaxConcurrentUploads(args.MaxConcurrentUploads),
+		registry.WithChunkedFetch(args.ChunkSize, args.ChunkConcurrency),
+	}
+	switch args.ContainerRuntime {
+	case "crio":
+		registryOpts = append(registryOpts, registry.WithRegistryPathPrefix(true))
+	case "docker":
+		registryOpts = append(registryOpts, registry.WithDefaultRegistry(docker.MirroredRegistry))
+	}
+	var regTLSConfig *tls.Config
+	switch {
+	case args.RegistryMTLSCertDir != "" && args.RegistryPeerIdentity:
+		return errors.New("registry mutual TLS certificates and peer identity cannot be used at the same time")
+	case args.RegistryMTLSCertDir != "":
+		certReloader, err := httpx.NewCertReloader(args.RegistryMTLSCertDir)
+		if err != nil {
+			return err
+		}
+		group.Go(func(ctx context.Context) error {
+			return certReloader.Run(ctx)
+		})
+		regTLSConfig = certReloader.ServerTLSConfig()
+		registryOpts = append(registryOpts, registry.WithPeerTLS(certReloader.ClientTLSConfig()))
+	case args.RegistryPeerIdentity:
+		peerTLS, err := router.PeerTLS()
+		if err != nil {
+			return err
+		}
+		regTLSConfig = peerTLS.ServerTLSConfig()
+		registryOpts = append(registryOpts, registry.WithPeerTLS(peerTLS.ClientTLSConfig()), registry.WithPeerIdentity(routing.PeerIdentity, router.IsConnected))
 	}
 	reg, err := registry.NewRegistry(ociStore, router, registryOpts...)
 	if err != nil {
@@ -254,8 +417,17 @@ func registryCommand(ctx context.Context, args *RegistryCmd) error {
 		Addr:    args.RegistryAddr,
 		Handler: reg.Handler(log),
 	}
+	regLis, err := (&net.ListenConfig{}).Listen(ctx, "tcp", args.RegistryAddr)
+	if err != nil {
+		return err
+	}
+	if regTLSConfig != nil {
+		// Peers connect with TLS while the local container runtime connects with plain HTTP over loopback.
+		// The registry rejects requests from other addresses which do not present a verified client certificate.
+		regLis = httpx.NewTLSMuxListener(regLis, regTLSConfig)
+	}
 	group.Go(func(ctx context.Context) error {
-		if err := regSrv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		if err := regSrv.Serve(regLis); err != nil && !errors.Is(err, http.ErrServerClosed) {
 			return err
 		}
 		return nil
@@ -322,7 +494,21 @@ func registryCommand(ctx context.Context, args *RegistryCmd) error {
 }
 
 func cleanupCommand(ctx context.Context, args *CleanupCmd) error {
-	err := cleanup.Run(ctx, args.Addr, args.ContainerdRegistryConfigPath)
+	var err error
+	switch args.ContainerRuntime {
+	case "containerd":
+		err = containerd.CleanupMirrorConfiguration(ctx, args.ContainerdRegistryConfigPath)
+	case "crio":
+		err = crio.CleanupMirrorConfiguration(ctx, args.CRIORegistryConfigPath)
+	case "docker":
+		err = docker.CleanupMirrorConfiguration(ctx, args.DockerDaemonConfigPath)
+	default:
+		err = fmt.Errorf("unknown container runtime %s", args.ContainerRuntime)
+	}
+	if err != nil {
+		return err
+	}
+	err = cleanup.Run(ctx, args.Addr)
 	if err != nil {
 		return err
 	}
@@ -338,7 +524,25 @@ func cleanupWaitCommand(ctx context.Context, args *CleanupWaitCmd) error {
 }
 
 func getBootstrapper(cfg BootstrapConfig) (routing.Bootstrapper, error) { //nolint: ireturn // Return type can be different structs.
-	switch cfg.BootstrapKind {
+	if len(cfg.BootstrapKind) == 0 {
+		return nil, errors.New("bootstrap kind is required")
+	}
+	if len(cfg.BootstrapKind) == 1 {
+		return getBootstrapperForKind(cfg, cfg.BootstrapKind[0])
+	}
+	bootstrappers := []routing.Bootstrapper{}
+	for _, kind := range cfg.BootstrapKind {
+		bs, err := getBootstrapperForKind(cfg, kind)
+		if err != nil {
+			return nil, err
+		}
+		bootstrappers = append(bootstrappers, bs)
+	}
+	return routing.NewMultiBootstrapper(bootstrappers...), nil
+}
+
+func getBootstrapperForKind(cfg BootstrapConfig, kind string) (routing.Bootstrapper, error) { //nolint: ireturn // Return type can be different structs.
+	switch kind {
 	case "dns":
 		return routing.NewDNSBootstrapper(cfg.DNSBootstrapDomain), nil
 	case "http":
@@ -349,7 +553,71 @@ func getBootstrapper(cfg BootstrapConfig) (routing.Bootstrapper, error) { //noli
 		return routing.NewHTTPBootstrapper(cfg.HTTPBootstrapAddr, cfg.HTTPBootstrapURL, pool, cert)
 	case "static":
 		return routing.NewStaticBootstrapperFromStrings(cfg.StaticBootstrapPeers)
+	case "mdns":
+		return routing.NewMDNSBootstrapper(), nil
+	case "kubernetes":
+		if cfg.KubernetesNamespace == "" || cfg.KubernetesService == "" {
+			return nil, errors.New("both namespace and service are required for Kubernetes bootstrap")
+		}
+		clientset, err := newKubernetesClient()
+		if err != nil {
+			return nil, err
+		}
+		return routing.NewKubernetesBootstrapper(clientset, cfg.KubernetesNamespace, cfg.KubernetesService), nil
 	default:
-		return nil, fmt.Errorf("unknown bootstrap kind %s", cfg.BootstrapKind)
+		return nil, fmt.Errorf("unknown bootstrap kind %s", kind)
+	}
+}
+
+// getAllowlist returns nil when no allowlist source is configured.
+func getAllowlist(ctx context.Context, cidrs []netip.Prefix, nodes bool) (*routing.Allowlist, error) {
+	sources := []routing.AllowlistSource{}
+	if len(cidrs) > 0 {
+		sources = append(sources, routing.StaticAllowlistSource(cidrs))
+	}
+	if nodes {
+		clientset, err := newKubernetesClient()
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, routing.NewKubernetesNodeSource(clientset))
+	}
+	if len(sources) == 0 {
+		return nil, nil
+	}
+	return routing.NewAllowlist(ctx, sources...)
+}
+
+func getTopology(ctx context.Context, args *RegistryCmd) (routing.Topology, error) {
+	topology := routing.Topology{
+		Region: args.TopologyRegion,
+		Zone:   args.TopologyZone,
+		Rack:   args.TopologyRack,
+	}
+	if args.TopologyNodeName == "" {
+		return topology, nil
+	}
+	clientset, err := newKubernetesClient()
+	if err != nil {
+		return routing.Topology{}, err
+	}
+	nodeTopology, err := routing.KubernetesNodeTopology(ctx, clientset, args.TopologyNodeName)
+	if err != nil {
+		return routing.Topology{}, err
+	}
+	if topology.Region == "" {
+		topology.Region = nodeTopology.Region
+	}
+	if topology.Zone == "" {
+		topology.Zone = nodeTopology.Zone
+	}
+	return topology, nil
+}
+
+func newKubernetesClient() (*kubernetes.Clientset, error) {
+	restCfg, err := rest.InClusterConfig()
+	if err != nil {
+		return nil, err
 	}
+	return kubernetes.NewForConfig(restCfg)
 }
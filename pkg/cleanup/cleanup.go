@@ -14,17 +14,11 @@ import (
 
 	"github.com/spegel-org/spegel/internal/channel"
 	"github.com/spegel-org/spegel/pkg/httpx"
-	"github.com/spegel-org/spegel/pkg/oci/containerd"
 )
 
-func Run(ctx context.Context, addr, configPath string) error {
+func Run(ctx context.Context, addr string) error {
 	log := logr.FromContextOrDiscard(ctx)
 
-	err := containerd.CleanupMirrorConfiguration(ctx, configPath)
-	if err != nil {
-		return err
-	}
-
 	group := errgroup.WithContext(ctx)
 
 	mux := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
@@ -53,7 +47,7 @@ func Run(ctx context.Context, addr, configPath string) error {
 	})
 
 	log.Info("waiting to be shutdown")
-	err = group.Wait()
+	err := group.Wait()
 	if err != nil {
 		return err
 	}
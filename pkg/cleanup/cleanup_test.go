@@ -42,7 +42,7 @@ func TestCleanupSucceed(t *testing.T) {
 	defer timeoutCancel()
 	group := errgroup.WithContext(timeoutCtx)
 	group.Go(func(ctx context.Context) error {
-		err := Run(ctx, addr, t.TempDir())
+		err := Run(ctx, addr)
 		if err != nil {
 			return err
 		}
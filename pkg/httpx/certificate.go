@@ -1,11 +1,16 @@
 package httpx
 
 import (
+	"context"
 	"crypto/tls"
 	"crypto/x509"
 	"errors"
 	"os"
 	"path/filepath"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/go-logr/logr"
 )
 
 const (
@@ -53,3 +58,143 @@ func LoadCerts(dirPath string) (*x509.CertPool, *tls.Certificate, error) {
 
 	return pool, &cert, nil
 }
+
+// CertReloader provides TLS configurations for mutual TLS using the certificates in a directory.
+// The certificates are reloaded when the files in the directory change.
+type CertReloader struct {
+	pool    *x509.CertPool
+	cert    *tls.Certificate
+	dirPath string
+	mx      sync.RWMutex
+}
+
+func NewCertReloader(dirPath string) (*CertReloader, error) {
+	if dirPath == "" {
+		return nil, errors.New("certificate directory path cannot be empty")
+	}
+	c := &CertReloader{
+		dirPath: dirPath,
+	}
+	err := c.Reload()
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Reload loads the certificates from the directory.
+// The current certificates are kept if the new certificates can not be loaded.
+func (c *CertReloader) Reload() error {
+	pool, cert, err := LoadCerts(c.dirPath)
+	if err != nil {
+		return err
+	}
+	if pool == nil || cert == nil {
+		return errors.New("both CA and TLS certificate are required for mutual TLS")
+	}
+
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	c.pool = pool
+	c.cert = cert
+	return nil
+}
+
+// Run watches the directory and reloads the certificates until the context is cancelled.
+// Directories are watched as mounted secrets replace the files through symlinks.
+func (c *CertReloader) Run(ctx context.Context) error {
+	log := logr.FromContextOrDiscard(ctx)
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+	err = watcher.Add(c.dirPath)
+	if err != nil {
+		return err
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return errors.New("certificate watcher closed")
+			}
+			log.Error(err, "received certificate watch error")
+		case _, ok := <-watcher.Events:
+			if !ok {
+				return errors.New("certificate watcher closed")
+			}
+			// Files may be partially written, which will be corrected by the following event.
+			err := c.Reload()
+			if err != nil {
+				log.Error(err, "could not reload certificates", "path", c.dirPath)
+				continue
+			}
+			log.Info("reloaded certificates", "path", c.dirPath)
+		}
+	}
+}
+
+// Certificate returns the current TLS certificate.
+func (c *CertReloader) Certificate() *tls.Certificate {
+	c.mx.RLock()
+	defer c.mx.RUnlock()
+	return c.cert
+}
+
+// CertPool returns the current CA certificates.
+func (c *CertReloader) CertPool() *x509.CertPool {
+	c.mx.RLock()
+	defer c.mx.RUnlock()
+	return c.pool
+}
+
+// ServerTLSConfig returns a server configuration which verifies client certificates when they are given.
+// Requiring a client certificate is left to the handler so that clients without one can still be served.
+func (c *CertReloader) ServerTLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*c.Certificate()},
+				ClientCAs:    c.CertPool(),
+				ClientAuth:   tls.VerifyClientCertIfGiven,
+			}, nil
+		},
+	}
+}
+
+// ClientTLSConfig returns a client configuration which presents the certificate and verifies the server against the CA.
+// Peers are dialed by IP so the certificate chain is verified without the server name.
+func (c *CertReloader) ClientTLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		//nolint: gosec // Certificate chain is verified in VerifyConnection with the current CA.
+		InsecureSkipVerify: true,
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return c.Certificate(), nil
+		},
+		VerifyConnection: func(cs tls.ConnectionState) error {
+			if len(cs.PeerCertificates) == 0 {
+				return errors.New("server did not present a certificate")
+			}
+			opts := x509.VerifyOptions{
+				Roots:         c.CertPool(),
+				Intermediates: x509.NewCertPool(),
+				KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+			}
+			for _, cert := range cs.PeerCertificates[1:] {
+				opts.Intermediates.AddCert(cert)
+			}
+			_, err := cs.PeerCertificates[0].Verify(opts)
+			if err != nil {
+				return err
+			}
+			return nil
+		},
+	}
+}
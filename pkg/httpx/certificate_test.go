@@ -1,9 +1,19 @@
 package httpx
 
 import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/go-openapi/testify/v2/require"
 )
@@ -113,3 +123,87 @@ func TestLoadCerts(t *testing.T) {
 		})
 	}
 }
+
+func TestCertReloader(t *testing.T) {
+	t.Parallel()
+
+	_, err := NewCertReloader("")
+	require.EqualError(t, err, "certificate directory path cannot be empty")
+
+	dirPath := t.TempDir()
+	for _, name := range []string{CertFilename, KeyFilename} {
+		b, err := os.ReadFile(filepath.Join("testdata", "certs", name))
+		require.NoError(t, err)
+		err = os.WriteFile(filepath.Join(dirPath, name), b, 0o600)
+		require.NoError(t, err)
+	}
+	_, err = NewCertReloader(dirPath)
+	require.EqualError(t, err, "both CA and TLS certificate are required for mutual TLS")
+
+	b, err := os.ReadFile(filepath.Join("testdata", "certs", CAFilename))
+	require.NoError(t, err)
+	err = os.WriteFile(filepath.Join(dirPath, CAFilename), b, 0o600)
+	require.NoError(t, err)
+	certReloader, err := NewCertReloader(dirPath)
+	require.NoError(t, err)
+	require.NotNil(t, certReloader.CertPool())
+	initialCert := certReloader.Certificate()
+	require.NotNil(t, initialCert)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	doneCh := make(chan error)
+	go func() {
+		doneCh <- certReloader.Run(ctx)
+	}()
+
+	// Invalid certificates should not replace the current certificates.
+	certPEM, keyPEM := generateTestCert(t)
+	err = os.WriteFile(filepath.Join(dirPath, KeyFilename), []byte("invalid"), 0o600)
+	require.NoError(t, err)
+	require.Never(t, func() bool {
+		return certReloader.Certificate() != initialCert
+	}, 100*time.Millisecond, 10*time.Millisecond)
+
+	err = os.WriteFile(filepath.Join(dirPath, CertFilename), certPEM, 0o600)
+	require.NoError(t, err)
+	err = os.WriteFile(filepath.Join(dirPath, KeyFilename), keyPEM, 0o600)
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		cert := certReloader.Certificate()
+		return cert != initialCert && string(cert.Certificate[0]) != string(initialCert.Certificate[0])
+	}, 5*time.Second, 10*time.Millisecond)
+
+	cancel()
+	require.NoError(t, <-doneCh)
+}
+
+// generateTestCert returns a certificate signed by the test CA.
+func generateTestCert(t *testing.T) ([]byte, []byte) {
+	t.Helper()
+
+	caData, err := os.ReadFile(filepath.Join("testdata", "certs", "ca.crt"))
+	require.NoError(t, err)
+	caKeyData, err := os.ReadFile(filepath.Join("testdata", "certs", "ca.key"))
+	require.NoError(t, err)
+	caPair, err := tls.X509KeyPair(caData, caKeyData)
+	require.NoError(t, err)
+	caCert, err := x509.ParseCertificate(caPair.Certificate[0])
+	require.NoError(t, err)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: "rotated"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, tmpl, caCert, &key.PublicKey, caPair.PrivateKey)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	return certPEM, keyPEM
+}
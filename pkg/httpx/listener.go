@@ -0,0 +1,118 @@
+package httpx
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	// First byte of a TLS handshake record.
+	tlsRecordTypeHandshake = 0x16
+	sniffTimeout           = 10 * time.Second
+)
+
+var _ net.Listener = &tlsMuxListener{}
+
+type acceptResult struct {
+	conn net.Conn
+	err  error
+}
+
+// tlsMuxListener serves TLS and plain connections from the same listener.
+type tlsMuxListener struct {
+	net.Listener
+	tlsConfig *tls.Config
+	acceptCh  chan acceptResult
+	doneCh    chan any
+	closeOnce sync.Once
+}
+
+// NewTLSMuxListener returns a listener which accepts both TLS and plain connections.
+// Connections which start with a TLS handshake are wrapped as TLS server connections.
+func NewTLSMuxListener(l net.Listener, tlsConfig *tls.Config) net.Listener {
+	ml := &tlsMuxListener{
+		Listener:  l,
+		tlsConfig: tlsConfig,
+		acceptCh:  make(chan acceptResult),
+		doneCh:    make(chan any),
+	}
+	go ml.run()
+	return ml
+}
+
+func (l *tlsMuxListener) Accept() (net.Conn, error) {
+	select {
+	case res := <-l.acceptCh:
+		return res.conn, res.err
+	case <-l.doneCh:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *tlsMuxListener) Close() error {
+	l.closeOnce.Do(func() {
+		close(l.doneCh)
+	})
+	return l.Listener.Close()
+}
+
+func (l *tlsMuxListener) run() {
+	for {
+		conn, err := l.Listener.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
+		if err != nil {
+			select {
+			case <-l.doneCh:
+				return
+			case l.acceptCh <- acceptResult{err: err}:
+			}
+			continue
+		}
+		// Sniffing is done concurrently so that slow clients do not block other connections.
+		go l.sniff(conn)
+	}
+}
+
+func (l *tlsMuxListener) sniff(conn net.Conn) {
+	err := conn.SetReadDeadline(time.Now().Add(sniffTimeout))
+	if err != nil {
+		conn.Close()
+		return
+	}
+	br := bufio.NewReader(conn)
+	b, err := br.Peek(1)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	err = conn.SetReadDeadline(time.Time{})
+	if err != nil {
+		conn.Close()
+		return
+	}
+	var muxConn net.Conn = &bufferedConn{Conn: conn, r: br}
+	if b[0] == tlsRecordTypeHandshake {
+		muxConn = tls.Server(muxConn, l.tlsConfig)
+	}
+	select {
+	case <-l.doneCh:
+		muxConn.Close()
+	case l.acceptCh <- acceptResult{conn: muxConn}:
+	}
+}
+
+// bufferedConn reads data peeked from the connection before reading from the connection.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
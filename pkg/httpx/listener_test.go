@@ -0,0 +1,106 @@
+package httpx
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-openapi/testify/v2/require"
+)
+
+func TestTLSMuxListener(t *testing.T) {
+	t.Parallel()
+
+	certReloader, err := NewCertReloader(filepath.Join("testdata", "certs"))
+	require.NoError(t, err)
+
+	lis, err := (&net.ListenConfig{}).Listen(t.Context(), "tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	lis = NewTLSMuxListener(lis, certReloader.ServerTLSConfig())
+	srv := &http.Server{
+		Handler: http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			if req.TLS == nil {
+				fmt.Fprint(rw, "plain")
+				return
+			}
+			fmt.Fprintf(rw, "tls %d", len(req.TLS.VerifiedChains))
+		}),
+	}
+	doneCh := make(chan error)
+	go func() {
+		doneCh <- srv.Serve(lis)
+	}()
+
+	otherReloader, err := NewCertReloader(filepath.Join("testdata", "certs"))
+	require.NoError(t, err)
+	otherReloader.pool = nil
+
+	//nolint: govet // Prioritize readability in tests.
+	tests := []struct {
+		name         string
+		scheme       string
+		tlsConfig    *tls.Config
+		expectedBody string
+		expectedErr  bool
+	}{
+		{
+			name:         "plain",
+			scheme:       "http",
+			expectedBody: "plain",
+		},
+		{
+			name:         "client certificate",
+			scheme:       "https",
+			tlsConfig:    certReloader.ClientTLSConfig(),
+			expectedBody: "tls 1",
+		},
+		{
+			name:   "without client certificate",
+			scheme: "https",
+			tlsConfig: &tls.Config{
+				MinVersion:         tls.VersionTLS12,
+				InsecureSkipVerify: true, //nolint: gosec // Only used in tests.
+			},
+			expectedBody: "tls 0",
+		},
+		{
+			name:        "untrusted server",
+			scheme:      "https",
+			tlsConfig:   otherReloader.ClientTLSConfig(),
+			expectedErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			transport := BaseTransport()
+			transport.TLSClientConfig = tt.tlsConfig
+			client := &http.Client{Transport: transport}
+			t.Cleanup(transport.CloseIdleConnections)
+			req, err := http.NewRequestWithContext(t.Context(), http.MethodGet, fmt.Sprintf("%s://%s", tt.scheme, lis.Addr().String()), nil)
+			require.NoError(t, err)
+			resp, err := client.Do(req)
+			if tt.expectedErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			b, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+			require.EqualT(t, tt.expectedBody, string(b))
+		})
+	}
+
+	t.Cleanup(func() {
+		err := srv.Close()
+		require.NoError(t, err)
+		err = <-doneCh
+		require.ErrorIs(t, err, http.ErrServerClosed)
+	})
+}
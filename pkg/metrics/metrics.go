@@ -21,10 +21,30 @@ var (
 		Name: "spegel_mirror_requests_total",
 		Help: "Total number of mirror requests.",
 	}, []string{"registry", "cache"})
+	MirrorPeerReceivedBytesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "spegel_mirror_peer_received_bytes_total",
+		Help: "Total number of bytes received from peers when mirroring by the locality of the serving peer.",
+	}, []string{"locality"})
 	MirrorLastSuccessTimestamp = prometheus.NewGauge(prometheus.GaugeOpts{
 		Name: "spegel_mirror_last_success_timestamp_seconds",
 		Help: "The timestamp of the last successful mirror request.",
 	})
+	EgressThrottledBytesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "spegel_egress_throttled_bytes_total",
+		Help: "Total number of bytes served to peers which were delayed by the egress rate limit.",
+	}, []string{"limit"})
+	EgressRejectedUploadsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "spegel_egress_rejected_uploads_total",
+		Help: "Total number of requests from peers rejected because the max concurrent uploads was reached.",
+	})
+	PeerCircuitTransitionsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "spegel_peer_circuit_transitions_total",
+		Help: "Total number of peer circuit breaker transitions by the state transitioned to.",
+	}, []string{"state"})
+	PeerCircuitsOpen = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "spegel_peer_circuits_open",
+		Help: "Number of peers with a circuit breaker which is not closed.",
+	})
 	ResolveDurHistogram = prometheus.NewHistogramVec(prometheus.HistogramOpts{
 		Name: "spegel_resolve_duration_seconds",
 		Help: "The duration for router to resolve a peer.",
@@ -32,20 +52,25 @@ var (
 	AdvertisedImageTags = prometheus.NewGaugeVec(prometheus.GaugeOpts{
 		Name: "spegel_advertised_image_tags",
 		Help: "Number of image tags advertised to be available.",
-	}, []string{"registry"})
+	}, []string{"registry", "namespace"})
 	AdvertisedImageDigests = prometheus.NewGaugeVec(prometheus.GaugeOpts{
 		Name: "spegel_advertised_image_digests",
 		Help: "Number of image digests advertised to be available.",
-	}, []string{"registry"})
+	}, []string{"registry", "namespace"})
 	AdvertisedContentDigests = prometheus.NewGaugeVec(prometheus.GaugeOpts{
 		Name: "spegel_advertised_content_digests",
 		Help: "Number of content digests advertised to be available.",
-	}, []string{"registry"})
+	}, []string{"registry", "namespace"})
 )
 
 func Register() {
 	DefaultRegisterer.MustRegister(MirrorRequestsTotal)
+	DefaultRegisterer.MustRegister(MirrorPeerReceivedBytesTotal)
 	DefaultRegisterer.MustRegister(MirrorLastSuccessTimestamp)
+	DefaultRegisterer.MustRegister(EgressThrottledBytesTotal)
+	DefaultRegisterer.MustRegister(EgressRejectedUploadsTotal)
+	DefaultRegisterer.MustRegister(PeerCircuitTransitionsTotal)
+	DefaultRegisterer.MustRegister(PeerCircuitsOpen)
 	DefaultRegisterer.MustRegister(ResolveDurHistogram)
 	DefaultRegisterer.MustRegister(AdvertisedImageTags)
 	DefaultRegisterer.MustRegister(AdvertisedImageDigests)
@@ -47,6 +47,14 @@ func WithTLS(rootCAs *x509.CertPool, certificates []tls.Certificate) ClientOptio
 	}
 }
 
+// WithTLSConfig sets the TLS configuration used by the client, replacing any previous TLS option.
+func WithTLSConfig(tlsConfig *tls.Config) ClientOption {
+	return func(cfg *ClientConfig) error {
+		cfg.TLSClientConfig = tlsConfig
+		return nil
+	}
+}
+
 type Client struct {
 	httpClient *http.Client
 	tokenCache sync.Map
@@ -77,9 +85,10 @@ func NewClient(opts ...ClientOption) (*Client, error) {
 }
 
 type CommonConfig struct {
-	Mirror   *url.URL
-	Header   http.Header
-	Userinfo *url.Userinfo
+	Mirror         *url.URL
+	Header         http.Header
+	Userinfo       *url.Userinfo
+	ResponseHeader func(http.Header)
 }
 
 type PullConfig struct {
@@ -136,6 +145,14 @@ func WithFetchHeader(k, v string) FetchOption {
 	}
 }
 
+// WithFetchResponseHeader calls the function with the header of every response received, including error responses.
+func WithFetchResponseHeader(fn func(http.Header)) FetchOption {
+	return func(cfg *CommonConfig) error {
+		cfg.ResponseHeader = fn
+		return nil
+	}
+}
+
 func WithFetchUserinfo(userinfo *url.Userinfo) FetchOption {
 	return func(cfg *CommonConfig) error {
 		cfg.Userinfo = userinfo
@@ -321,6 +338,9 @@ func (c *Client) Fetch(ctx context.Context, dist DistributionPath, opts ...Fetch
 		if err != nil {
 			return resilient.Unrecoverable(err)
 		}
+		if cfg.ResponseHeader != nil {
+			cfg.ResponseHeader(resp.Header)
+		}
 		if resp.StatusCode == http.StatusUnauthorized {
 			c.tokenCache.Delete(tcKey)
 			wwwAuth := resp.Header.Get(httpx.HeaderWWWAuthenticate)
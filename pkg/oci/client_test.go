@@ -96,10 +96,14 @@ func TestClient(t *testing.T) {
 	}
 	dist, err := NewDistributionPath(ref, DistributionKindBlob, "http", http.MethodHead, nil)
 	require.NoError(t, err)
-	_, desc, err := ociClient.Fetch(t.Context(), dist, WithFetchMirror(mirror))
+	var respHeader http.Header
+	_, desc, err := ociClient.Fetch(t.Context(), dist, WithFetchMirror(mirror), WithFetchResponseHeader(func(h http.Header) {
+		respHeader = h
+	}))
 	require.NoError(t, err)
 	require.EqualT(t, dist.Digest, desc.Digest)
 	require.EqualT(t, httpx.ContentTypeBinary, desc.MediaType)
+	require.EqualT(t, dist.Digest.String(), respHeader.Get(HeaderDockerDigest))
 }
 
 func TestDescriptorHeader(t *testing.T) {
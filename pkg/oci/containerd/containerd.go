@@ -14,9 +14,12 @@ import (
 
 	eventtypes "github.com/containerd/containerd/api/events"
 	"github.com/containerd/containerd/v2/client"
+	"github.com/containerd/containerd/v2/core/content"
 	"github.com/containerd/containerd/v2/core/events"
 	"github.com/containerd/containerd/v2/core/images"
+	"github.com/containerd/containerd/v2/core/leases"
 	"github.com/containerd/containerd/v2/pkg/labels"
+	"github.com/containerd/containerd/v2/pkg/namespaces"
 	"github.com/containerd/containerd/v2/plugins"
 	"github.com/containerd/errdefs"
 	"github.com/containerd/typeurl/v2"
@@ -37,8 +40,9 @@ const (
 )
 
 type ContainerdConfig struct {
-	Conn        net.Conn
-	ContentPath string
+	Conn          net.Conn
+	ContentPath   string
+	LeaseDuration time.Duration
 }
 
 type ContainerdOption = option.Option[ContainerdConfig]
@@ -50,6 +54,14 @@ func WithContentPath(path string) ContainerdOption {
 	}
 }
 
+// WithLeaseDuration sets the duration written content is protected from garbage collection.
+func WithLeaseDuration(d time.Duration) ContainerdOption {
+	return func(c *ContainerdConfig) error {
+		c.LeaseDuration = d
+		return nil
+	}
+}
+
 func WithConnection(conn net.Conn) ContainerdOption {
 	return func(c *ContainerdConfig) error {
 		c.Conn = conn
@@ -57,23 +69,36 @@ func WithConnection(conn net.Conn) ContainerdOption {
 	}
 }
 
-var _ oci.Store = &Containerd{}
+var (
+	_ oci.WritableStore   = &Containerd{}
+	_ oci.IngestStore     = &Containerd{}
+	_ oci.NamespacedStore = &Containerd{}
+)
 
+// Containerd reads content from one or more containerd namespaces.
+// Namespaces are queried in the order given and content is written to the first namespace.
 type Containerd struct {
-	client       *client.Client
-	mediaTypeIdx *lru.Cache[digest.Digest, string]
-	contentPath  string
+	client        *client.Client
+	mediaTypeIdx  *lru.Cache[digest.Digest, string]
+	contentPath   string
+	namespaces    []string
+	leaseDuration time.Duration
 }
 
-func NewContainerd(ctx context.Context, socketPath, namespace string, opts ...ContainerdOption) (*Containerd, error) {
-	cfg := ContainerdConfig{}
+func NewContainerd(ctx context.Context, socketPath string, namespaces []string, opts ...ContainerdOption) (*Containerd, error) {
+	cfg := ContainerdConfig{
+		LeaseDuration: 24 * time.Hour,
+	}
 	err := option.Apply(&cfg, opts...)
 	if err != nil {
 		return nil, err
 	}
+	if len(namespaces) == 0 {
+		return nil, errors.New("at least one namespace is required")
+	}
 
 	clientOpts := []client.Opt{
-		client.WithDefaultNamespace(namespace),
+		client.WithDefaultNamespace(namespaces[0]),
 	}
 	if cfg.Conn != nil {
 		dialOpt := grpc.WithContextDialer(func(ctx context.Context, s string) (net.Conn, error) {
@@ -100,9 +125,11 @@ func NewContainerd(ctx context.Context, socketPath, namespace string, opts ...Co
 	}
 
 	c := &Containerd{
-		client:       client,
-		mediaTypeIdx: mediaTypeIdx,
-		contentPath:  contentPath,
+		client:        client,
+		mediaTypeIdx:  mediaTypeIdx,
+		contentPath:   contentPath,
+		namespaces:    namespaces,
+		leaseDuration: cfg.LeaseDuration,
 	}
 	return c, nil
 }
@@ -120,21 +147,26 @@ func (c *Containerd) Name() string {
 }
 
 func (c *Containerd) ListImages(ctx context.Context) ([]oci.Image, error) {
-	cImgs, err := c.client.ImageService().List(ctx, listImageFilter)
-	if err != nil {
-		return nil, err
-	}
 	tagDgsts := map[digest.Digest]string{}
 	imgs := []oci.Image{}
-	for _, cImg := range cImgs {
-		img, err := oci.ParseImage(cImg.Name, oci.WithDigest(cImg.Target.Digest))
+	for _, ns := range c.namespaces {
+		cImgs, err := c.client.ImageService().List(namespaces.WithNamespace(ctx, ns), listImageFilter)
 		if err != nil {
 			return nil, err
 		}
-		if img.Tag != "" {
-			tagDgsts[img.Digest] = img.Tag
+		for _, cImg := range cImgs {
+			img, err := oci.ParseImage(cImg.Name, oci.WithDigest(cImg.Target.Digest))
+			if err != nil {
+				return nil, err
+			}
+			if slices.Contains(imgs, img) {
+				continue
+			}
+			if img.Tag != "" {
+				tagDgsts[img.Digest] = img.Tag
+			}
+			imgs = append(imgs, img)
 		}
-		imgs = append(imgs, img)
 	}
 	// Remove duplicate digest images that already have tags.
 	imgs = slices.DeleteFunc(imgs, func(img oci.Image) bool {
@@ -150,18 +182,21 @@ func (c *Containerd) ListImages(ctx context.Context) ([]oci.Image, error) {
 }
 
 func (c *Containerd) Resolve(ctx context.Context, ref string) (digest.Digest, error) {
-	cImg, err := c.client.ImageService().Get(ctx, ref)
-	if err != nil {
-		return "", err
+	for _, ns := range c.namespaces {
+		cImg, err := c.client.ImageService().Get(namespaces.WithNamespace(ctx, ns), ref)
+		if errors.Is(err, errdefs.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		return cImg.Target.Digest, nil
 	}
-	return cImg.Target.Digest, nil
+	return "", errors.Join(oci.ErrNotFound, fmt.Errorf("could not resolve tag %s to a digest", ref))
 }
 
 func (c *Containerd) Descriptor(ctx context.Context, dgst digest.Digest) (ocispec.Descriptor, error) {
-	info, err := c.client.ContentStore().Info(ctx, dgst)
-	if errors.Is(err, errdefs.ErrNotFound) {
-		return ocispec.Descriptor{}, errors.Join(oci.ErrNotFound, err)
-	}
+	info, err := c.info(ctx, dgst)
 	if err != nil {
 		return ocispec.Descriptor{}, err
 	}
@@ -209,73 +244,373 @@ func (c *Containerd) Open(ctx context.Context, dgst digest.Digest) (io.ReadSeekC
 		}
 		return file, nil
 	}
-	ra, err := c.client.ContentStore().ReaderAt(ctx, ocispec.Descriptor{Digest: dgst})
-	if errors.Is(err, errdefs.ErrNotFound) {
+	for _, ns := range c.namespaces {
+		ra, err := c.client.ContentStore().ReaderAt(namespaces.WithNamespace(ctx, ns), ocispec.Descriptor{Digest: dgst})
+		if errors.Is(err, errdefs.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return struct {
+			io.ReadSeeker
+			io.Closer
+		}{
+			ReadSeeker: io.NewSectionReader(ra, 0, ra.Size()),
+			Closer:     ra,
+		}, nil
+	}
+	return nil, errors.Join(oci.ErrNotFound, fmt.Errorf("content with digest %s not found", dgst))
+}
+
+// info returns the content info from the first namespace that contains the digest.
+func (c *Containerd) info(ctx context.Context, dgst digest.Digest) (content.Info, error) {
+	for _, ns := range c.namespaces {
+		info, err := c.client.ContentStore().Info(namespaces.WithNamespace(ctx, ns), dgst)
+		if errors.Is(err, errdefs.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return content.Info{}, err
+		}
+		return info, nil
+	}
+	return content.Info{}, errors.Join(oci.ErrNotFound, fmt.Errorf("content with digest %s not found", dgst))
+}
+
+func (c *Containerd) IngestDescriptor(ctx context.Context, dgst digest.Digest) (ocispec.Descriptor, error) {
+	status, err := c.ingestStatus(ctx, dgst)
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	// Media type can only be fingerprinted from complete content.
+	mt, ok := c.mediaTypeIdx.Get(dgst)
+	if !ok {
+		mt = httpx.ContentTypeBinary
+	}
+	desc := ocispec.Descriptor{
+		Size:      status.Total,
+		Digest:    dgst,
+		MediaType: mt,
+	}
+	return desc, nil
+}
+
+// ListIngests returns the digests of all ingests, including ingests started by containerd when pulling images.
+func (c *Containerd) ListIngests(ctx context.Context) ([]digest.Digest, error) {
+	if c.contentPath == "" {
+		return nil, nil
+	}
+	statuses, err := c.listStatuses(ctx)
+	if err != nil {
+		return nil, err
+	}
+	dgsts := []digest.Digest{}
+	for _, status := range statuses {
+		if status.Total <= 0 {
+			continue
+		}
+		dgst, ok := ingestDigest(status.Ref)
+		if !ok || slices.Contains(dgsts, dgst) {
+			continue
+		}
+		dgsts = append(dgsts, dgst)
+	}
+	return dgsts, nil
+}
+
+func (c *Containerd) OpenIngest(ctx context.Context, dgst digest.Digest) (io.ReadSeekCloser, error) {
+	status, err := c.ingestStatus(ctx, dgst)
+	if err != nil {
+		return nil, err
+	}
+	dataPath, err := c.ingestDataPath(status.namespace, status.Ref)
+	if err != nil {
+		return nil, err
+	}
+	// The data file is renamed into the blob directory on commit, so the open file remains readable.
+	file, err := os.Open(dataPath)
+	if errors.Is(err, os.ErrNotExist) {
 		return nil, errors.Join(oci.ErrNotFound, err)
 	}
 	if err != nil {
 		return nil, err
 	}
-	return struct {
-		io.ReadSeeker
-		io.Closer
-	}{
-		ReadSeeker: io.NewSectionReader(ra, 0, ra.Size()),
-		Closer:     ra,
-	}, nil
+	written := func() (int64, error) {
+		fi, err := file.Stat()
+		if err != nil {
+			return 0, err
+		}
+		if fi.Size() >= status.Total {
+			return fi.Size(), nil
+		}
+		// Incomplete data that is no longer in the ingest directory has been aborted.
+		_, err = os.Stat(dataPath)
+		if errors.Is(err, os.ErrNotExist) {
+			return 0, fmt.Errorf("ingest %s has been aborted", status.Ref)
+		}
+		if err != nil {
+			return 0, err
+		}
+		return fi.Size(), nil
+	}
+	return oci.NewIngestReader(ctx, file, status.Total, written, file), nil
+}
+
+// ingestStatus returns the status of the ingest with the most written data for the digest.
+// Ingests can only be read when the content path is known and the total size has been set.
+func (c *Containerd) ingestStatus(ctx context.Context, dgst digest.Digest) (namespacedStatus, error) {
+	if c.contentPath == "" {
+		return namespacedStatus{}, errors.Join(oci.ErrNotFound, errors.New("reading ingests requires the content path"))
+	}
+	statuses, err := c.listStatuses(ctx)
+	if err != nil {
+		return namespacedStatus{}, err
+	}
+	var found *namespacedStatus
+	for _, status := range statuses {
+		ingestDgst, ok := ingestDigest(status.Ref)
+		if !ok || ingestDgst != dgst || status.Total <= 0 {
+			continue
+		}
+		if found == nil || status.Offset > found.Offset {
+			found = &status
+		}
+	}
+	if found == nil {
+		return namespacedStatus{}, errors.Join(oci.ErrNotFound, fmt.Errorf("ingest for digest %s not found", dgst))
+	}
+	return *found, nil
+}
+
+// namespacedStatus is an ingest status with the namespace it was listed from.
+type namespacedStatus struct {
+	namespace string
+	content.Status
+}
+
+func (c *Containerd) listStatuses(ctx context.Context) ([]namespacedStatus, error) {
+	statuses := []namespacedStatus{}
+	for _, ns := range c.namespaces {
+		nsStatuses, err := c.client.ContentStore().ListStatuses(namespaces.WithNamespace(ctx, ns))
+		if err != nil {
+			return nil, err
+		}
+		for _, status := range nsStatuses {
+			statuses = append(statuses, namespacedStatus{namespace: ns, Status: status})
+		}
+	}
+	return statuses, nil
+}
+
+// ingestDataPath returns the path to the data file of the ingest with the ref in the namespace.
+// The metadata store writes ingests with the ref prefixed by the namespace and a sequence ID, so the
+// ingest directory, which is named after the digest of that ref, has to be found by reading the ref files.
+func (c *Containerd) ingestDataPath(ns, ref string) (string, error) {
+	ingestRoot := filepath.Join(c.contentPath, "ingest")
+	entries, err := os.ReadDir(ingestRoot)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", errors.Join(oci.ErrNotFound, err)
+	}
+	if err != nil {
+		return "", err
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		b, err := os.ReadFile(filepath.Join(ingestRoot, entry.Name(), "ref"))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		backendRef, ok := strings.CutPrefix(string(b), ns+"/")
+		if !ok {
+			continue
+		}
+		_, userRef, ok := strings.Cut(backendRef, "/")
+		if !ok || userRef != ref {
+			continue
+		}
+		return filepath.Join(ingestRoot, entry.Name(), "data"), nil
+	}
+	return "", errors.Join(oci.ErrNotFound, fmt.Errorf("ingest directory for ref %s not found", ref))
+}
+
+// ingestDigest returns the digest of the content being written from the ingest reference.
+// Ingest references end with the digest, for example layer-sha256:<hash> for layers pulled by containerd.
+func ingestDigest(ref string) (digest.Digest, bool) {
+	dgst, err := digest.Parse(ref[strings.LastIndex(ref, "-")+1:])
+	if err != nil {
+		return "", false
+	}
+	return dgst, true
+}
+
+func (c *Containerd) Writer(ctx context.Context, ref oci.Reference, desc ocispec.Descriptor) (oci.ContentWriter, error) {
+	// Content is written with a lease so that it is not garbage collected before an image references it.
+	lease, err := c.client.LeasesService().Create(ctx, leases.WithRandomID(), leases.WithExpiration(c.leaseDuration))
+	if err != nil {
+		return nil, err
+	}
+	ingestRef := "spegel-" + desc.Digest.String()
+	cw, err := c.client.ContentStore().Writer(leases.WithLease(ctx, lease.ID), content.WithRef(ingestRef), content.WithDescriptor(desc))
+	if err != nil {
+		// Remove the lease so that it does not linger until it expires.
+		leaseErr := c.client.LeasesService().Delete(context.WithoutCancel(ctx), lease)
+		return nil, errors.Join(err, leaseErr)
+	}
+	w := &contentWriter{
+		cs:           c.client.ContentStore(),
+		cw:           cw,
+		ingestRef:    ingestRef,
+		mediaTypeIdx: c.mediaTypeIdx,
+		leaseID:      lease.ID,
+		desc:         desc,
+		labels: map[string]string{
+			labels.LabelDistributionSource + "." + ref.Registry: ref.Repository,
+		},
+	}
+	return w, nil
+}
+
+type contentWriter struct {
+	cs           content.Store
+	cw           content.Writer
+	mediaTypeIdx *lru.Cache[digest.Digest, string]
+	labels       map[string]string
+	ingestRef    string
+	leaseID      string
+	desc         ocispec.Descriptor
+	committed    bool
+}
+
+func (w *contentWriter) Write(p []byte) (int, error) {
+	return w.cw.Write(p)
+}
+
+func (w *contentWriter) Commit(ctx context.Context) error {
+	err := w.cw.Commit(leases.WithLease(ctx, w.leaseID), w.desc.Size, w.desc.Digest, content.WithLabels(w.labels))
+	if err != nil && !errors.Is(err, errdefs.ErrAlreadyExists) {
+		return err
+	}
+	w.committed = true
+	if w.desc.MediaType != "" {
+		w.mediaTypeIdx.Add(w.desc.Digest, w.desc.MediaType)
+	}
+	return nil
+}
+
+func (w *contentWriter) Close() error {
+	err := w.cw.Close()
+	if err != nil {
+		return err
+	}
+	if w.committed {
+		return nil
+	}
+	// Remove the partial ingest so that it does not linger until the lease expires.
+	err = w.cs.Abort(leases.WithLease(context.Background(), w.leaseID), w.ingestRef)
+	if err != nil && !errors.Is(err, errdefs.ErrNotFound) {
+		return err
+	}
+	return nil
 }
 
 func (c *Containerd) Subscribe(ctx context.Context) (map[oci.Image][]digest.Digest, <-chan oci.OCIEvent, error) {
+	nsInitial, eventCh, err := c.SubscribeNamespaces(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	initial := map[oci.Image][]digest.Digest{}
+	for _, imgs := range nsInitial {
+		for img, dgsts := range imgs {
+			initial[img] = append(initial[img], dgsts...)
+		}
+	}
+	return initial, eventCh, nil
+}
+
+// SubscribeNamespaces returns the initial content grouped by namespace and the events for all namespaces.
+// Content present in more than one namespace is attributed to the first namespace and only advertised once.
+func (c *Containerd) SubscribeNamespaces(ctx context.Context) (map[string]map[oci.Image][]digest.Digest, <-chan oci.OCIEvent, error) {
 	log := logr.FromContextOrDiscard(ctx)
 
 	eventCh := make(chan oci.OCIEvent)
 	subCtx, subCancel := context.WithCancel(ctx)
-	eventFilters := []string{`topic~="/images/create|/images/delete",event.name~="^.+/"`, `topic~="/content/create"`}
+	eventFilters := []string{}
+	for _, ns := range c.namespaces {
+		eventFilters = append(eventFilters, fmt.Sprintf(`namespace==%q,topic~="/images/create|/images/delete",event.name~="^.+/"`, ns), fmt.Sprintf(`namespace==%q,topic~="/content/create"`, ns))
+	}
 	envelopeCh, cErrCh := c.client.EventService().Subscribe(subCtx, eventFilters...)
 
 	// Populate the content index.
-	initial := map[oci.Image][]digest.Digest{}
-	contentIdx := map[digest.Digest][]oci.Reference{}
-	cImgs, err := c.client.ImageService().List(ctx, listImageFilter)
-	if err != nil {
-		subCancel()
-		return nil, nil, err
-	}
-	for _, cImg := range cImgs {
-		img, err := oci.ParseImage(cImg.Name, oci.WithDigest(cImg.Target.Digest))
+	initial := map[string]map[oci.Image][]digest.Digest{}
+	contentIdxs := map[string]map[digest.Digest][]oci.Reference{}
+	// Identifiers present in each namespace, used to deduplicate advertisements between namespaces.
+	present := map[string]map[string]any{}
+	for _, ns := range c.namespaces {
+		nsCtx := namespaces.WithNamespace(ctx, ns)
+		cImgs, err := c.client.ImageService().List(nsCtx, listImageFilter)
 		if err != nil {
-			log.Error(err, "skipping image that cannot be parsed", "image", img.String())
-			continue
+			subCancel()
+			return nil, nil, err
 		}
-		refs := []oci.Reference{}
-		handler := images.HandlerFunc(func(ctx context.Context, desc ocispec.Descriptor) ([]ocispec.Descriptor, error) {
-			children, err := images.ChildrenHandler(c.client.ContentStore()).Handle(ctx, desc)
-			if errors.Is(err, errdefs.ErrNotFound) {
-				return nil, nil
-			}
+		nsInitial := map[oci.Image][]digest.Digest{}
+		contentIdx := map[digest.Digest][]oci.Reference{}
+		nsPresent := map[string]any{}
+		for _, cImg := range cImgs {
+			img, err := oci.ParseImage(cImg.Name, oci.WithDigest(cImg.Target.Digest))
 			if err != nil {
-				return nil, err
+				log.Error(err, "skipping image that cannot be parsed", "image", img.String())
+				continue
 			}
-			ref := oci.Reference{
-				Registry:   img.Registry,
-				Repository: img.Repository,
-				Digest:     desc.Digest,
+			refs := []oci.Reference{}
+			handler := images.HandlerFunc(func(ctx context.Context, desc ocispec.Descriptor) ([]ocispec.Descriptor, error) {
+				children, err := images.ChildrenHandler(c.client.ContentStore()).Handle(ctx, desc)
+				if errors.Is(err, errdefs.ErrNotFound) {
+					return nil, nil
+				}
+				if err != nil {
+					return nil, err
+				}
+				ref := oci.Reference{
+					Registry:   img.Registry,
+					Repository: img.Repository,
+					Digest:     desc.Digest,
+				}
+				refs = append(refs, ref)
+				return children, nil
+			})
+			err = images.Walk(nsCtx, handler, cImg.Target)
+			if err != nil {
+				log.Error(err, "skipping image that cannot be walked", "image", img.String())
+				continue
 			}
-			refs = append(refs, ref)
-			return children, nil
-		})
-		err = images.Walk(ctx, handler, cImg.Target)
-		if err != nil {
-			log.Error(err, "skipping image that cannot be walked", "image", img.String())
-			continue
-		}
-		contentIdx[cImg.Target.Digest] = refs
+			contentIdx[cImg.Target.Digest] = refs
 
-		dgsts := []digest.Digest{}
-		for _, ref := range refs {
-			dgsts = append(dgsts, ref.Digest)
+			tagName, ok := img.TagName()
+			if ok {
+				nsPresent[tagName] = nil
+			}
+			dgsts := []digest.Digest{}
+			for _, ref := range refs {
+				nsPresent[ref.Digest.String()] = nil
+				if presentInOtherNamespace(present, ns, ref.Digest.String()) {
+					continue
+				}
+				dgsts = append(dgsts, ref.Digest)
+			}
+			if imageInOtherNamespace(initial, ns, img) {
+				continue
+			}
+			nsInitial[img] = dgsts
 		}
-		initial[img] = dgsts
+		initial[ns] = nsInitial
+		contentIdxs[ns] = contentIdx
+		present[ns] = nsPresent
 	}
 
 	go func() {
@@ -285,12 +620,27 @@ func (c *Containerd) Subscribe(ctx context.Context) (map[oci.Image][]digest.Dige
 			case <-subCtx.Done():
 				return
 			case envelope := <-envelopeCh:
-				events, err := c.handleEvent(subCtx, *envelope, contentIdx)
+				contentIdx, ok := contentIdxs[envelope.Namespace]
+				if !ok {
+					continue
+				}
+				events, err := c.handleEvent(namespaces.WithNamespace(subCtx, envelope.Namespace), *envelope, contentIdx)
 				if err != nil {
 					log.Error(err, "error when handling containerd event")
 					continue
 				}
 				for _, event := range events {
+					key := event.Reference.Identifier()
+					switch event.Type {
+					case oci.CreateEvent:
+						present[envelope.Namespace][key] = nil
+					case oci.DeleteEvent:
+						delete(present[envelope.Namespace], key)
+					}
+					if presentInOtherNamespace(present, envelope.Namespace, key) {
+						continue
+					}
+					event.Namespace = envelope.Namespace
 					eventCh <- event
 				}
 			}
@@ -309,6 +659,30 @@ func (c *Containerd) Subscribe(ctx context.Context) (map[oci.Image][]digest.Dige
 	return initial, eventCh, nil
 }
 
+func presentInOtherNamespace(present map[string]map[string]any, namespace, key string) bool {
+	for ns, nsPresent := range present {
+		if ns == namespace {
+			continue
+		}
+		if _, ok := nsPresent[key]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+func imageInOtherNamespace(initial map[string]map[oci.Image][]digest.Digest, namespace string, img oci.Image) bool {
+	for ns, nsInitial := range initial {
+		if ns == namespace {
+			continue
+		}
+		if _, ok := nsInitial[img]; ok {
+			return true
+		}
+	}
+	return false
+}
+
 func (c *Containerd) handleEvent(ctx context.Context, envelope events.Envelope, contentIdx map[digest.Digest][]oci.Reference) ([]oci.OCIEvent, error) {
 	if envelope.Event == nil {
 		return nil, errors.New("envelope event cannot be nil")
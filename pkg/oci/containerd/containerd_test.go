@@ -1,6 +1,8 @@
 package containerd
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/go-openapi/testify/v2/require"
@@ -64,3 +66,97 @@ func TestContentLabelsToReferences(t *testing.T) {
 	_, err := contentLabelsToReferences(map[string]string{}, dgst)
 	require.EqualError(t, err, "no distribution source labels found for foo")
 }
+
+func TestNewContainerdWithoutNamespaces(t *testing.T) {
+	t.Parallel()
+
+	_, err := NewContainerd(t.Context(), "", nil)
+	require.EqualError(t, err, "at least one namespace is required")
+}
+
+func TestPresentInOtherNamespace(t *testing.T) {
+	t.Parallel()
+
+	present := map[string]map[string]any{
+		"k8s.io": {
+			"sha256:foo": nil,
+		},
+		"default": {
+			"sha256:foo": nil,
+			"sha256:bar": nil,
+		},
+	}
+	require.TrueT(t, presentInOtherNamespace(present, "k8s.io", "sha256:foo"))
+	require.TrueT(t, presentInOtherNamespace(present, "k8s.io", "sha256:bar"))
+	require.FalseT(t, presentInOtherNamespace(present, "default", "sha256:bar"))
+	require.FalseT(t, presentInOtherNamespace(present, "buildkit", "sha256:baz"))
+}
+
+func TestIngestDigest(t *testing.T) {
+	t.Parallel()
+
+	dgst := digest.Digest("sha256:c0669ef34cdc14332c0f1ab0c2c01acb91d96014b172f1a76f3a39e63d1f0bda")
+	tests := []struct {
+		ref      string
+		expected digest.Digest
+	}{
+		{
+			ref:      "layer-" + dgst.String(),
+			expected: dgst,
+		},
+		{
+			ref:      "spegel-" + dgst.String(),
+			expected: dgst,
+		},
+		{
+			ref:      dgst.String(),
+			expected: dgst,
+		},
+		{
+			ref: "layer-sha256:foo",
+		},
+		{
+			ref: "random-ref",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ref, func(t *testing.T) {
+			t.Parallel()
+
+			ingestDgst, ok := ingestDigest(tt.ref)
+			require.EqualT(t, tt.expected != "", ok)
+			require.EqualT(t, tt.expected, ingestDgst)
+		})
+	}
+}
+
+func TestIngestDataPath(t *testing.T) {
+	t.Parallel()
+
+	contentPath := t.TempDir()
+	backendRefs := map[string]string{
+		"foo": "default/3/layer-sha256:c0669ef34cdc14332c0f1ab0c2c01acb91d96014b172f1a76f3a39e63d1f0bda",
+		"bar": "k8s.io/12/layer-sha256:c0669ef34cdc14332c0f1ab0c2c01acb91d96014b172f1a76f3a39e63d1f0bda",
+	}
+	for dir, backendRef := range backendRefs {
+		err := os.MkdirAll(filepath.Join(contentPath, "ingest", dir), 0o755)
+		require.NoError(t, err)
+		err = os.WriteFile(filepath.Join(contentPath, "ingest", dir, "ref"), []byte(backendRef), 0o644)
+		require.NoError(t, err)
+	}
+	err := os.MkdirAll(filepath.Join(contentPath, "ingest", "incomplete"), 0o755)
+	require.NoError(t, err)
+
+	c := &Containerd{contentPath: contentPath}
+	dataPath, err := c.ingestDataPath("k8s.io", "layer-sha256:c0669ef34cdc14332c0f1ab0c2c01acb91d96014b172f1a76f3a39e63d1f0bda")
+	require.NoError(t, err)
+	require.EqualT(t, filepath.Join(contentPath, "ingest", "bar", "data"), dataPath)
+	_, err = c.ingestDataPath("k8s.io", "sha256:c0669ef34cdc14332c0f1ab0c2c01acb91d96014b172f1a76f3a39e63d1f0bda")
+	require.ErrorIs(t, err, oci.ErrNotFound)
+	_, err = c.ingestDataPath("buildkit", "layer-sha256:c0669ef34cdc14332c0f1ab0c2c01acb91d96014b172f1a76f3a39e63d1f0bda")
+	require.ErrorIs(t, err, oci.ErrNotFound)
+
+	c = &Containerd{contentPath: t.TempDir()}
+	_, err = c.ingestDataPath("k8s.io", "foo")
+	require.ErrorIs(t, err, oci.ErrNotFound)
+}
@@ -0,0 +1,246 @@
+package crio
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/go-logr/logr"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/spegel-org/spegel/internal/option"
+	"github.com/spegel-org/spegel/pkg/oci"
+)
+
+const (
+	imagesFile = "images.json"
+	// Big data key prefix used by containers-storage for image manifests.
+	manifestKeyPrefix = "manifest-"
+)
+
+type CRIOConfig struct {
+	StorageDriver string
+}
+
+type CRIOOption = option.Option[CRIOConfig]
+
+// WithStorageDriver sets the containers-storage graph driver, which determines the image metadata directory.
+func WithStorageDriver(driver string) CRIOOption {
+	return func(c *CRIOConfig) error {
+		c.StorageDriver = driver
+		return nil
+	}
+}
+
+var _ oci.Store = &CRIO{}
+
+// CRIO reads content from the containers-storage layout used by CRI-O.
+// Containers-storage does not retain compressed layer blobs, only manifests and configs can be served.
+type CRIO struct {
+	watcher    *oci.IndexWatcher[bigData]
+	imagesPath string
+}
+
+func NewCRIO(storageRoot string, opts ...CRIOOption) (*CRIO, error) {
+	cfg := CRIOConfig{
+		StorageDriver: "overlay",
+	}
+	err := option.Apply(&cfg, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.StorageDriver == "" {
+		return nil, errors.New("storage driver cannot be empty")
+	}
+
+	c := &CRIO{
+		imagesPath: filepath.Join(storageRoot, cfg.StorageDriver+"-images"),
+	}
+	c.watcher = oci.NewIndexWatcher([]string{filepath.Join(c.imagesPath, imagesFile)}, c.readIndex)
+	return c, nil
+}
+
+func (c *CRIO) Name() string {
+	return "crio"
+}
+
+func (c *CRIO) ListImages(ctx context.Context) ([]oci.Image, error) {
+	idx, err := c.watcher.Load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	tagDgsts := map[digest.Digest]string{}
+	imgs := []oci.Image{}
+	for img := range idx.Images {
+		if img.Tag != "" {
+			tagDgsts[img.Digest] = img.Tag
+		}
+		imgs = append(imgs, img)
+	}
+	// Remove duplicate digest images that already have tags.
+	imgs = slices.DeleteFunc(imgs, func(img oci.Image) bool {
+		if img.Tag != "" {
+			return false
+		}
+		if _, ok := tagDgsts[img.Digest]; ok {
+			return true
+		}
+		return false
+	})
+	return imgs, nil
+}
+
+func (c *CRIO) Resolve(ctx context.Context, ref string) (digest.Digest, error) {
+	idx, err := c.watcher.Load(ctx)
+	if err != nil {
+		return "", err
+	}
+	for img := range idx.Images {
+		tagName, ok := img.TagName()
+		if !ok || tagName != ref {
+			continue
+		}
+		return img.Digest, nil
+	}
+	return "", errors.Join(oci.ErrNotFound, fmt.Errorf("could not resolve tag %s to a digest", ref))
+}
+
+func (c *CRIO) Descriptor(ctx context.Context, dgst digest.Digest) (ocispec.Descriptor, error) {
+	idx, err := c.watcher.Load(ctx)
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	bd, ok := idx.Content[dgst]
+	if !ok {
+		return ocispec.Descriptor{}, errors.Join(oci.ErrNotFound, fmt.Errorf("content with digest %s not found", dgst))
+	}
+	b, err := os.ReadFile(c.bigDataPath(bd))
+	if errors.Is(err, os.ErrNotExist) {
+		return ocispec.Descriptor{}, errors.Join(oci.ErrNotFound, err)
+	}
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	mt, err := oci.FingerprintMediaType(bytes.NewReader(b))
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	desc := ocispec.Descriptor{
+		Size:      int64(len(b)),
+		Digest:    dgst,
+		MediaType: mt,
+	}
+	return desc, nil
+}
+
+func (c *CRIO) Open(ctx context.Context, dgst digest.Digest) (io.ReadSeekCloser, error) {
+	idx, err := c.watcher.Load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	bd, ok := idx.Content[dgst]
+	if !ok {
+		return nil, errors.Join(oci.ErrNotFound, fmt.Errorf("content with digest %s not found", dgst))
+	}
+	file, err := os.Open(c.bigDataPath(bd))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, errors.Join(oci.ErrNotFound, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+func (c *CRIO) Subscribe(ctx context.Context) (map[oci.Image][]digest.Digest, <-chan oci.OCIEvent, error) {
+	return c.watcher.Subscribe(ctx)
+}
+
+// storageImage is the subset of the containers-storage image record used to locate content.
+type storageImage struct {
+	ID           string        `json:"id"`
+	Digest       digest.Digest `json:"digest,omitempty"`
+	Names        []string      `json:"names,omitempty"`
+	BigDataNames []string      `json:"big-data-names,omitempty"`
+}
+
+type bigData struct {
+	imageID string
+	key     string
+}
+
+// readIndex builds the content index from the images file.
+func (c *CRIO) readIndex(ctx context.Context) (*oci.ImageIndex[bigData], error) {
+	idx := oci.NewImageIndex[bigData]()
+	b, err := os.ReadFile(filepath.Join(c.imagesPath, imagesFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return idx, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	storageImgs := []storageImage{}
+	err = json.Unmarshal(b, &storageImgs)
+	if err != nil {
+		return nil, err
+	}
+	for _, storageImg := range storageImgs {
+		dgsts := []digest.Digest{}
+		for _, key := range storageImg.BigDataNames {
+			// Manifests are stored with the digest prefixed, configs are stored with the digest as key.
+			dgst, err := digest.Parse(strings.TrimPrefix(key, manifestKeyPrefix))
+			if err != nil {
+				continue
+			}
+			idx.Content[dgst] = bigData{imageID: storageImg.ID, key: key}
+			dgsts = append(dgsts, dgst)
+		}
+		for _, name := range storageImg.Names {
+			img, err := oci.ParseImage(name, oci.AllowTagOnly())
+			if err != nil {
+				logr.FromContextOrDiscard(ctx).Error(err, "skipping image that cannot be parsed", "image", name)
+				continue
+			}
+			if img.Digest == "" {
+				img.Digest = storageImg.Digest
+			}
+			if img.Digest == "" {
+				continue
+			}
+			idx.Images[img] = dgsts
+		}
+	}
+	return idx, nil
+}
+
+func (c *CRIO) bigDataPath(bd bigData) string {
+	return filepath.Join(c.imagesPath, bd.imageID, bigDataBaseName(bd.key))
+}
+
+// bigDataBaseName returns the file name used by containers-storage for the big data key.
+// Keys containing characters other than lower case letters, digits and dots are base64 encoded.
+func bigDataBaseName(key string) string {
+	reader := strings.NewReader(key)
+	for reader.Len() > 0 {
+		ch, size, err := reader.ReadRune()
+		if err != nil || size != 1 {
+			break
+		}
+		if ch != '.' && (ch < '0' || ch > '9') && (ch < 'a' || ch > 'z') {
+			break
+		}
+	}
+	if reader.Len() > 0 {
+		return "=" + base64.StdEncoding.EncodeToString([]byte(key))
+	}
+	return key
+}
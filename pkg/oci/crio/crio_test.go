@@ -0,0 +1,133 @@
+package crio
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-openapi/testify/v2/require"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/spegel-org/spegel/pkg/oci"
+)
+
+const (
+	busyboxManifest = digest.Digest("sha256:eacdae772255092bdce23d01fd97917178e100323a9c64fbeaec086fb62e6a20")
+	busyboxConfig   = digest.Digest("sha256:5a8727d6058a0f241b0df838eab28edb83147da9b5a702bf3cc6e773067e8d52")
+	spegelManifest  = digest.Digest("sha256:692651ac701f19bc64ee021e26e4a3e33e00f6eed20f391da39c3eccdc076370")
+	spegelConfig    = digest.Digest("sha256:9e6604ca2a627bae80c81c0d2367f6bef57cc3bcdc9e7894d31489239593fc18")
+)
+
+func TestCRIO(t *testing.T) {
+	t.Parallel()
+
+	_, err := NewCRIO("testdata/storage", WithStorageDriver(""))
+	require.EqualError(t, err, "storage driver cannot be empty")
+
+	c, err := NewCRIO("testdata/storage")
+	require.NoError(t, err)
+	require.EqualT(t, "crio", c.Name())
+
+	imgs, err := c.ListImages(t.Context())
+	require.NoError(t, err)
+	expectedImgs := []oci.Image{
+		{Reference: oci.Reference{Registry: "docker.io", Repository: "library/busybox", Tag: "1.36", Digest: busyboxManifest}},
+		{Reference: oci.Reference{Registry: "ghcr.io", Repository: "spegel-org/spegel", Digest: spegelManifest}},
+	}
+	require.ElementsMatchT(t, expectedImgs, imgs)
+
+	dgst, err := c.Resolve(t.Context(), "docker.io/library/busybox:1.36")
+	require.NoError(t, err)
+	require.EqualT(t, busyboxManifest, dgst)
+	_, err = c.Resolve(t.Context(), "docker.io/library/busybox:latest")
+	require.ErrorIs(t, err, oci.ErrNotFound)
+
+	for _, tt := range []struct {
+		dgst      digest.Digest
+		mediaType string
+	}{
+		{dgst: busyboxManifest, mediaType: ocispec.MediaTypeImageManifest},
+		{dgst: busyboxConfig, mediaType: ocispec.MediaTypeImageConfig},
+		{dgst: spegelManifest, mediaType: ocispec.MediaTypeImageManifest},
+		{dgst: spegelConfig, mediaType: ocispec.MediaTypeImageConfig},
+	} {
+		desc, err := c.Descriptor(t.Context(), tt.dgst)
+		require.NoError(t, err)
+		require.EqualT(t, tt.mediaType, desc.MediaType)
+		rc, err := c.Open(t.Context(), tt.dgst)
+		require.NoError(t, err)
+		b, err := io.ReadAll(rc)
+		require.NoError(t, err)
+		require.NoError(t, rc.Close())
+		require.EqualT(t, desc.Size, int64(len(b)))
+		require.EqualT(t, tt.dgst, digest.FromBytes(b))
+	}
+
+	// Layers are not retained by containers-storage.
+	_, err = c.Descriptor(t.Context(), digest.FromString("layer1gz"))
+	require.ErrorIs(t, err, oci.ErrNotFound)
+	_, err = c.Open(t.Context(), digest.FromString("layer1gz"))
+	require.ErrorIs(t, err, oci.ErrNotFound)
+}
+
+func TestCRIOSubscribe(t *testing.T) {
+	t.Parallel()
+
+	storageRoot := t.TempDir()
+	err := os.CopyFS(storageRoot, os.DirFS("testdata/storage"))
+	require.NoError(t, err)
+	c, err := NewCRIO(storageRoot)
+	require.NoError(t, err)
+
+	initial, eventCh, err := c.Subscribe(t.Context())
+	require.NoError(t, err)
+	require.Len(t, initial, 3)
+	busybox := oci.Image{Reference: oci.Reference{Registry: "docker.io", Repository: "library/busybox", Tag: "1.36", Digest: busyboxManifest}}
+	require.ElementsMatchT(t, []digest.Digest{busyboxManifest, busyboxConfig}, initial[busybox])
+
+	// Removing the busybox image and adding a tag to the spegel image.
+	imagesPath := filepath.Join(storageRoot, "overlay-images", imagesFile)
+	b, err := os.ReadFile(imagesPath)
+	require.NoError(t, err)
+	storageImgs := []map[string]any{}
+	err = json.Unmarshal(b, &storageImgs)
+	require.NoError(t, err)
+	storageImgs = storageImgs[1:]
+	storageImgs[0]["names"] = []string{"ghcr.io/spegel-org/spegel:v1", "ghcr.io/spegel-org/spegel@" + spegelManifest.String()}
+	b, err = json.Marshal(storageImgs)
+	require.NoError(t, err)
+	tmpPath := filepath.Join(storageRoot, "images.json.tmp")
+	err = os.WriteFile(tmpPath, b, 0o644)
+	require.NoError(t, err)
+	err = os.Rename(tmpPath, imagesPath)
+	require.NoError(t, err)
+
+	events := []oci.OCIEvent{}
+	timeoutCh := time.After(5 * time.Second)
+	for len(events) < 4 {
+		select {
+		case <-timeoutCh:
+			t.Fatalf("timed out waiting for events %v", events)
+		case event := <-eventCh:
+			events = append(events, event)
+		}
+	}
+	expectedEvents := []oci.OCIEvent{
+		{Type: oci.CreateEvent, Reference: oci.Reference{Registry: "ghcr.io", Repository: "spegel-org/spegel", Tag: "v1"}},
+		{Type: oci.DeleteEvent, Reference: oci.Reference{Registry: "docker.io", Repository: "library/busybox", Tag: "1.36"}},
+		{Type: oci.DeleteEvent, Reference: oci.Reference{Registry: "docker.io", Repository: "library/busybox", Digest: busyboxManifest}},
+		{Type: oci.DeleteEvent, Reference: oci.Reference{Registry: "docker.io", Repository: "library/busybox", Digest: busyboxConfig}},
+	}
+	require.ElementsMatchT(t, expectedEvents, events)
+}
+
+func TestBigDataBaseName(t *testing.T) {
+	t.Parallel()
+
+	require.EqualT(t, "manifest", bigDataBaseName("manifest"))
+	require.EqualT(t, "=c2hhMjU2OjVhODcyN2Q2MDU4YTBmMjQxYjBkZjgzOGVhYjI4ZWRiODMxNDdkYTliNWE3MDJiZjNjYzZlNzczMDY3ZThkNTI=", bigDataBaseName(busyboxConfig.String()))
+}
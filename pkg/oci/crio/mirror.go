@@ -0,0 +1,136 @@
+package crio
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/go-logr/logr"
+
+	"github.com/spegel-org/spegel/pkg/oci"
+)
+
+const (
+	mirrorConfigName = "spegel.conf"
+)
+
+// AddMirrorConfiguration writes a registries.conf drop-in which configures the mirror targets for the mirrored registries.
+// The registry is prefixed to the mirror repository path as CRI-O does not pass the registry to mirrors.
+// Refer to the containers-registries.conf documentation for more information about the configuration.
+// https://github.com/containers/image/blob/main/docs/containers-registries.conf.5.md
+func AddMirrorConfiguration(ctx context.Context, configPath string, mirroredRegistries, mirrorTargets []string, resolveTags bool, userinfo *url.Userinfo) error {
+	log := logr.FromContextOrDiscard(ctx)
+
+	if userinfo != nil {
+		return errors.New("basic authentication is not supported by CRI-O mirror configuration")
+	}
+	parsedMirroredRegistries, err := oci.ParseRegistries(mirroredRegistries, true)
+	if err != nil {
+		return err
+	}
+	parsedMirrorTargets, err := oci.ParseRegistries(mirrorTargets, false)
+	if err != nil {
+		return err
+	}
+	for _, mr := range parsedMirroredRegistries {
+		if mr == oci.WildcardRegistryURL {
+			return errors.New("CRI-O mirror configuration requires mirrored registries to be set explicitly")
+		}
+		if mr.Port() != "" {
+			return fmt.Errorf("CRI-O mirror configuration does not support registry %s with port", mr.String())
+		}
+	}
+
+	pullFromMirror := "digest-only"
+	if resolveTags {
+		pullFromMirror = "all"
+	}
+	config, err := templateRegistries(parsedMirroredRegistries, parsedMirrorTargets, pullFromMirror)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(configPath, 0o755)
+	if err != nil {
+		return err
+	}
+	fp := filepath.Join(configPath, mirrorConfigName)
+	err = os.WriteFile(fp, []byte(config), 0o644)
+	if err != nil {
+		return err
+	}
+	log.Info("added CRI-O mirror configuration", "path", fp)
+	return nil
+}
+
+// CleanupMirrorConfiguration removes the registries.conf drop-in written by AddMirrorConfiguration.
+func CleanupMirrorConfiguration(ctx context.Context, configPath string) error {
+	fp := filepath.Join(configPath, mirrorConfigName)
+	err := os.Remove(fp)
+	if errors.Is(err, os.ErrNotExist) {
+		logr.FromContextOrDiscard(ctx).Info("skipping cleanup because CRI-O mirror configuration does not exist")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func templateRegistries(parsedMirroredRegistries, parsedMirrorTargets []url.URL, pullFromMirror string) (string, error) {
+	type mirror struct {
+		Location string
+		Insecure bool
+	}
+	type registry struct {
+		Prefix  string
+		Mirrors []mirror
+	}
+	registries := []registry{}
+	for _, mr := range parsedMirroredRegistries {
+		reg := registry{
+			Prefix: mr.Host,
+		}
+		for _, mt := range parsedMirrorTargets {
+			m := mirror{
+				Location: mt.Host + "/" + mr.Host,
+				Insecure: mt.Scheme == "http",
+			}
+			reg.Mirrors = append(reg.Mirrors, m)
+		}
+		registries = append(registries, reg)
+	}
+
+	hc := struct {
+		PullFromMirror string
+		Registries     []registry
+	}{
+		PullFromMirror: pullFromMirror,
+		Registries:     registries,
+	}
+	tmpl, err := template.New("").Parse(`{{- range .Registries }}
+[[registry]]
+prefix = '{{ .Prefix }}'
+location = '{{ .Prefix }}'
+{{ range .Mirrors }}
+[[registry.mirror]]
+location = '{{ .Location }}'
+insecure = {{ .Insecure }}
+pull-from-mirror = '{{ $.PullFromMirror }}'
+{{ end }}
+{{- end }}`)
+	if err != nil {
+		return "", err
+	}
+	buf := bytes.NewBuffer(nil)
+	err = tmpl.Execute(buf, hc)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
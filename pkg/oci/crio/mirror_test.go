@@ -0,0 +1,114 @@
+package crio
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-openapi/testify/v2/require"
+)
+
+func TestMirrorConfiguration(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name               string
+		userinfo           *url.Userinfo
+		expectedError      string
+		expectedConfig     string
+		mirroredRegistries []string
+		mirrorTargets      []string
+		resolveTags        bool
+	}{
+		{
+			name:               "multiple mirrored registries",
+			mirroredRegistries: []string{"https://docker.io", "https://ghcr.io"},
+			mirrorTargets:      []string{"http://127.0.0.1:5000", "https://127.0.0.2:5001"},
+			resolveTags:        true,
+			expectedConfig: `[[registry]]
+prefix = 'docker.io'
+location = 'docker.io'
+
+[[registry.mirror]]
+location = '127.0.0.1:5000/docker.io'
+insecure = true
+pull-from-mirror = 'all'
+
+[[registry.mirror]]
+location = '127.0.0.2:5001/docker.io'
+insecure = false
+pull-from-mirror = 'all'
+
+[[registry]]
+prefix = 'ghcr.io'
+location = 'ghcr.io'
+
+[[registry.mirror]]
+location = '127.0.0.1:5000/ghcr.io'
+insecure = true
+pull-from-mirror = 'all'
+
+[[registry.mirror]]
+location = '127.0.0.2:5001/ghcr.io'
+insecure = false
+pull-from-mirror = 'all'`,
+		},
+		{
+			name:               "resolve tags disabled",
+			mirroredRegistries: []string{"https://docker.io"},
+			mirrorTargets:      []string{"http://127.0.0.1:5000"},
+			resolveTags:        false,
+			expectedConfig: `[[registry]]
+prefix = 'docker.io'
+location = 'docker.io'
+
+[[registry.mirror]]
+location = '127.0.0.1:5000/docker.io'
+insecure = true
+pull-from-mirror = 'digest-only'`,
+		},
+		{
+			name:               "wildcard registries",
+			mirroredRegistries: []string{},
+			mirrorTargets:      []string{"http://127.0.0.1:5000"},
+			expectedError:      "CRI-O mirror configuration requires mirrored registries to be set explicitly",
+		},
+		{
+			name:               "registry with port",
+			mirroredRegistries: []string{"http://foo.bar:5000"},
+			mirrorTargets:      []string{"http://127.0.0.1:5000"},
+			expectedError:      "CRI-O mirror configuration does not support registry http://foo.bar:5000 with port",
+		},
+		{
+			name:               "basic authentication",
+			mirroredRegistries: []string{"https://docker.io"},
+			mirrorTargets:      []string{"http://127.0.0.1:5000"},
+			userinfo:           url.UserPassword("foo", "bar"),
+			expectedError:      "basic authentication is not supported by CRI-O mirror configuration",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			configPath := filepath.Join(t.TempDir(), "registries.conf.d")
+			err := AddMirrorConfiguration(t.Context(), configPath, tt.mirroredRegistries, tt.mirrorTargets, tt.resolveTags, tt.userinfo)
+			if tt.expectedError != "" {
+				require.EqualError(t, err, tt.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			b, err := os.ReadFile(filepath.Join(configPath, mirrorConfigName))
+			require.NoError(t, err)
+			require.EqualT(t, tt.expectedConfig, string(b))
+
+			err = CleanupMirrorConfiguration(t.Context(), configPath)
+			require.NoError(t, err)
+			_, err = os.Stat(filepath.Join(configPath, mirrorConfigName))
+			require.ErrorIs(t, err, os.ErrNotExist)
+			err = CleanupMirrorConfiguration(t.Context(), configPath)
+			require.NoError(t, err)
+		})
+	}
+}
@@ -100,6 +100,23 @@ func TestParseDistributionPath(t *testing.T) {
 	}
 }
 
+func TestParseDistributionPathRegistryPrefix(t *testing.T) {
+	t.Parallel()
+
+	// Repositories are never split as a registry prefix is only expected from some container runtimes.
+	req, err := http.NewRequestWithContext(t.Context(), http.MethodGet, "/v2/docker.io/library/nginx/blobs/sha256:295c7be079025306c4f1d65997fcf7adb411c88f139ad1d34b537164aa060369?ns=example.com", nil)
+	require.NoError(t, err)
+	dist, err := ParseDistributionPath(req)
+	require.NoError(t, err)
+	require.EqualT(t, "example.com", dist.Registry)
+	require.EqualT(t, "docker.io/library/nginx", dist.Repository)
+
+	req, err = http.NewRequestWithContext(t.Context(), http.MethodGet, "/v2/docker.io/library/nginx/manifests/latest", nil)
+	require.NoError(t, err)
+	_, err = ParseDistributionPath(req)
+	require.EqualError(t, err, "registry parameter needs to be set for tag references")
+}
+
 func TestParseDistributionPathErrors(t *testing.T) {
 	t.Parallel()
 
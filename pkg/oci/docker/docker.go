@@ -0,0 +1,122 @@
+package docker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/containerd/containerd/v2/client"
+
+	"github.com/spegel-org/spegel/internal/option"
+	"github.com/spegel-org/spegel/pkg/oci"
+	"github.com/spegel-org/spegel/pkg/oci/containerd"
+)
+
+const (
+	// DefaultNamespace is the containerd namespace used by Docker Engine for images.
+	DefaultNamespace = "moby"
+	// MirroredRegistry is the only registry Docker Engine uses registry mirrors for.
+	// Requests to mirrors do not include the registry.
+	MirroredRegistry = "docker.io"
+	// Prefix of the containerd namespaces used by Docker Engine for plugins.
+	pluginNamespacePrefix = "plugins."
+)
+
+type DockerConfig struct {
+	Namespace   string
+	ContentPath string
+}
+
+type DockerOption = option.Option[DockerConfig]
+
+// WithNamespace sets the containerd namespace used by Docker Engine, instead of detecting it.
+func WithNamespace(namespace string) DockerOption {
+	return func(c *DockerConfig) error {
+		c.Namespace = namespace
+		return nil
+	}
+}
+
+func WithContentPath(path string) DockerOption {
+	return func(c *DockerConfig) error {
+		c.ContentPath = path
+		return nil
+	}
+}
+
+var (
+	_ oci.WritableStore = &Docker{}
+	_ oci.IngestStore   = &Docker{}
+)
+
+// Docker reads content from Docker Engine when the containerd image store is enabled.
+// Docker Engine stores images in containerd, which may be managed by Docker with its own socket.
+type Docker struct {
+	*containerd.Containerd
+}
+
+func NewDocker(ctx context.Context, socketPath string, opts ...DockerOption) (*Docker, error) {
+	cfg := DockerConfig{}
+	err := option.Apply(&cfg, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	namespace := cfg.Namespace
+	if namespace == "" {
+		namespace, err = detectNamespace(ctx, socketPath)
+		if err != nil {
+			return nil, err
+		}
+	}
+	containerdOpts := []containerd.ContainerdOption{}
+	if cfg.ContentPath != "" {
+		containerdOpts = append(containerdOpts, containerd.WithContentPath(cfg.ContentPath))
+	}
+	containerdStore, err := containerd.NewContainerd(ctx, socketPath, []string{namespace}, containerdOpts...)
+	if err != nil {
+		return nil, err
+	}
+	d := &Docker{
+		Containerd: containerdStore,
+	}
+	return d, nil
+}
+
+func (d *Docker) Name() string {
+	return "docker"
+}
+
+func detectNamespace(ctx context.Context, socketPath string) (string, error) {
+	containerdClient, err := client.New(socketPath)
+	if err != nil {
+		return "", err
+	}
+	defer containerdClient.Close()
+	namespaces, err := containerdClient.NamespaceService().List(ctx)
+	if err != nil {
+		return "", err
+	}
+	return selectNamespace(namespaces)
+}
+
+// selectNamespace returns the default Docker namespace if it exists, or the only non plugin namespace.
+// Docker Engine can be configured to use a different namespace which is why the default is not assumed.
+func selectNamespace(namespaces []string) (string, error) {
+	if slices.Contains(namespaces, DefaultNamespace) {
+		return DefaultNamespace, nil
+	}
+	candidates := slices.DeleteFunc(slices.Clone(namespaces), func(namespace string) bool {
+		return strings.HasPrefix(namespace, pluginNamespacePrefix)
+	})
+	switch len(candidates) {
+	case 0:
+		return "", errors.New("could not detect Docker namespace as no namespaces exist, make sure the containerd image store is enabled")
+	case 1:
+		return candidates[0], nil
+	default:
+		return "", fmt.Errorf("could not detect Docker namespace from namespaces %s, the namespace has to be set explicitly", strings.Join(candidates, ", "))
+	}
+}
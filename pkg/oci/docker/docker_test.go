@@ -0,0 +1,52 @@
+package docker
+
+import (
+	"testing"
+
+	"github.com/go-openapi/testify/v2/require"
+)
+
+func TestSelectNamespace(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name          string
+		expected      string
+		expectedError string
+		namespaces    []string
+	}{
+		{
+			name:       "default namespace",
+			namespaces: []string{"k8s.io", "moby", "plugins.moby"},
+			expected:   "moby",
+		},
+		{
+			name:       "custom namespace",
+			namespaces: []string{"docker", "plugins.docker"},
+			expected:   "docker",
+		},
+		{
+			name:          "no namespaces",
+			namespaces:    []string{"plugins.moby"},
+			expectedError: "could not detect Docker namespace as no namespaces exist, make sure the containerd image store is enabled",
+		},
+		{
+			name:          "multiple namespaces",
+			namespaces:    []string{"k8s.io", "docker"},
+			expectedError: "could not detect Docker namespace from namespaces k8s.io, docker, the namespace has to be set explicitly",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			namespace, err := selectNamespace(tt.namespaces)
+			if tt.expectedError != "" {
+				require.EqualError(t, err, tt.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			require.EqualT(t, tt.expected, namespace)
+		})
+	}
+}
@@ -0,0 +1,222 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/go-logr/logr"
+
+	"github.com/spegel-org/spegel/pkg/oci"
+)
+
+const (
+	registryMirrorsKey    = "registry-mirrors"
+	insecureRegistriesKey = "insecure-registries"
+	// Suffix of the file which stores the original values of the keys written by Spegel.
+	backupSuffix = ".spegel-backup"
+)
+
+// AddMirrorConfiguration writes the mirror targets as registry mirrors in the Docker daemon configuration.
+// Docker only uses registry mirrors for Docker Hub, and does not pass the registry to the mirror, so only Docker Hub can be mirrored.
+// Mirror targets using plain HTTP are added as insecure registries. The daemon has to be reloaded to use the configuration.
+// https://docs.docker.com/reference/cli/dockerd/#daemon-configuration-file
+func AddMirrorConfiguration(ctx context.Context, configPath string, mirroredRegistries, mirrorTargets []string, prependExisting bool, userinfo *url.Userinfo) error {
+	log := logr.FromContextOrDiscard(ctx)
+
+	if userinfo != nil {
+		return errors.New("basic authentication is not supported by Docker mirror configuration")
+	}
+	parsedMirroredRegistries, err := oci.ParseRegistries(mirroredRegistries, true)
+	if err != nil {
+		return err
+	}
+	parsedMirrorTargets, err := oci.ParseRegistries(mirrorTargets, false)
+	if err != nil {
+		return err
+	}
+	mirrorsDockerHub := slices.ContainsFunc(parsedMirroredRegistries, func(mr url.URL) bool {
+		return mr == oci.WildcardRegistryURL || mr.Host == MirroredRegistry
+	})
+	if !mirrorsDockerHub {
+		return errors.New("mirrored registries have to include docker.io as Docker only uses mirrors for docker.io")
+	}
+	if len(parsedMirroredRegistries) > 1 {
+		log.Info("Docker only uses mirrors for docker.io, other mirrored registries are ignored")
+	}
+
+	daemonConfig, err := readDaemonConfig(configPath)
+	if err != nil {
+		return err
+	}
+	err = backupDaemonConfig(log, configPath, daemonConfig)
+	if err != nil {
+		return err
+	}
+	backup, err := readDaemonConfig(configPath + backupSuffix)
+	if err != nil {
+		return err
+	}
+
+	mirrors := []string{}
+	insecureRegistries := []string{}
+	err = unmarshalKey(backup, insecureRegistriesKey, &insecureRegistries)
+	if err != nil {
+		return err
+	}
+	for _, mt := range parsedMirrorTargets {
+		mirrors = append(mirrors, mt.String())
+		if mt.Scheme == "http" && !slices.Contains(insecureRegistries, mt.Host) {
+			insecureRegistries = append(insecureRegistries, mt.Host)
+		}
+	}
+	if prependExisting {
+		existingMirrors := []string{}
+		err = unmarshalKey(backup, registryMirrorsKey, &existingMirrors)
+		if err != nil {
+			return err
+		}
+		for _, existingMirror := range existingMirrors {
+			if slices.Contains(mirrors, existingMirror) {
+				continue
+			}
+			mirrors = append(mirrors, existingMirror)
+		}
+		log.Info("prepending to existing Docker registry mirrors")
+	}
+	err = marshalKey(daemonConfig, registryMirrorsKey, mirrors)
+	if err != nil {
+		return err
+	}
+	if len(insecureRegistries) > 0 {
+		err = marshalKey(daemonConfig, insecureRegistriesKey, insecureRegistries)
+		if err != nil {
+			return err
+		}
+	}
+	err = writeDaemonConfig(configPath, daemonConfig)
+	if err != nil {
+		return err
+	}
+	log.Info("added Docker mirror configuration", "path", configPath)
+	return nil
+}
+
+// CleanupMirrorConfiguration restores the Docker daemon configuration values written by AddMirrorConfiguration.
+// Other changes made to the configuration after it was written are kept.
+func CleanupMirrorConfiguration(ctx context.Context, configPath string) error {
+	log := logr.FromContextOrDiscard(ctx)
+
+	backupPath := configPath + backupSuffix
+	_, err := os.Stat(backupPath)
+	if errors.Is(err, os.ErrNotExist) {
+		log.Info("skipping cleanup because Docker mirror configuration backup does not exist")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	backup, err := readDaemonConfig(backupPath)
+	if err != nil {
+		return err
+	}
+	daemonConfig, err := readDaemonConfig(configPath)
+	if err != nil {
+		return err
+	}
+	for _, key := range []string{registryMirrorsKey, insecureRegistriesKey} {
+		v, ok := backup[key]
+		if !ok {
+			delete(daemonConfig, key)
+			continue
+		}
+		daemonConfig[key] = v
+	}
+	err = writeDaemonConfig(configPath, daemonConfig)
+	if err != nil {
+		return err
+	}
+	// Remove backup to indicate that cleanup has been run.
+	err = os.Remove(backupPath)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// backupDaemonConfig stores the original values of the keys written by Spegel.
+// An existing backup is kept as the configuration may already contain values written by Spegel.
+func backupDaemonConfig(log logr.Logger, configPath string, daemonConfig map[string]json.RawMessage) error {
+	backupPath := configPath + backupSuffix
+	_, err := os.Stat(backupPath)
+	if err == nil {
+		log.Info("skipping backup of Docker configuration as it already exists", "path", backupPath)
+		return nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	backup := map[string]json.RawMessage{}
+	for _, key := range []string{registryMirrorsKey, insecureRegistriesKey} {
+		v, ok := daemonConfig[key]
+		if !ok {
+			continue
+		}
+		backup[key] = v
+	}
+	return writeDaemonConfig(backupPath, backup)
+}
+
+// readDaemonConfig returns the top level keys of the configuration so that unknown values are preserved.
+func readDaemonConfig(configPath string) (map[string]json.RawMessage, error) {
+	daemonConfig := map[string]json.RawMessage{}
+	b, err := os.ReadFile(configPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return daemonConfig, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(b, &daemonConfig)
+	if err != nil {
+		return nil, err
+	}
+	return daemonConfig, nil
+}
+
+func writeDaemonConfig(configPath string, daemonConfig map[string]json.RawMessage) error {
+	b, err := json.MarshalIndent(daemonConfig, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(configPath), 0o755)
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(configPath, append(b, '\n'), 0o644)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func unmarshalKey(daemonConfig map[string]json.RawMessage, key string, v any) error {
+	b, ok := daemonConfig[key]
+	if !ok {
+		return nil
+	}
+	return json.Unmarshal(b, v)
+}
+
+func marshalKey(daemonConfig map[string]json.RawMessage, key string, v any) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	daemonConfig[key] = b
+	return nil
+}
@@ -0,0 +1,127 @@
+package docker
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-openapi/testify/v2/require"
+)
+
+func TestMirrorConfiguration(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name               string
+		userinfo           *url.Userinfo
+		existingConfig     string
+		expectedError      string
+		expectedConfig     string
+		mirroredRegistries []string
+		mirrorTargets      []string
+		prependExisting    bool
+	}{
+		{
+			name:          "no existing configuration",
+			mirrorTargets: []string{"http://127.0.0.1:5000", "https://127.0.0.2:5001"},
+			expectedConfig: `{
+  "insecure-registries": [
+    "127.0.0.1:5000"
+  ],
+  "registry-mirrors": [
+    "http://127.0.0.1:5000",
+    "https://127.0.0.2:5001"
+  ]
+}
+`,
+		},
+		{
+			name:               "existing configuration",
+			mirroredRegistries: []string{"https://docker.io", "https://ghcr.io"},
+			mirrorTargets:      []string{"http://127.0.0.1:5000"},
+			existingConfig:     `{"debug": true, "registry-mirrors": ["https://mirror.example.com"], "insecure-registries": ["example.com"]}`,
+			expectedConfig: `{
+  "debug": true,
+  "insecure-registries": [
+    "example.com",
+    "127.0.0.1:5000"
+  ],
+  "registry-mirrors": [
+    "http://127.0.0.1:5000"
+  ]
+}
+`,
+		},
+		{
+			name:            "prepend existing",
+			mirrorTargets:   []string{"http://127.0.0.1:5000"},
+			existingConfig:  `{"registry-mirrors": ["https://mirror.example.com"]}`,
+			prependExisting: true,
+			expectedConfig: `{
+  "insecure-registries": [
+    "127.0.0.1:5000"
+  ],
+  "registry-mirrors": [
+    "http://127.0.0.1:5000",
+    "https://mirror.example.com"
+  ]
+}
+`,
+		},
+		{
+			name:               "docker hub not mirrored",
+			mirroredRegistries: []string{"https://ghcr.io"},
+			mirrorTargets:      []string{"http://127.0.0.1:5000"},
+			expectedError:      "mirrored registries have to include docker.io as Docker only uses mirrors for docker.io",
+		},
+		{
+			name:          "with basic auth",
+			mirrorTargets: []string{"http://127.0.0.1:5000"},
+			userinfo:      url.UserPassword("foo", "bar"),
+			expectedError: "basic authentication is not supported by Docker mirror configuration",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			configPath := filepath.Join(t.TempDir(), "daemon.json")
+			if tt.existingConfig != "" {
+				err := os.WriteFile(configPath, []byte(tt.existingConfig), 0o644)
+				require.NoError(t, err)
+			}
+
+			err := AddMirrorConfiguration(t.Context(), configPath, tt.mirroredRegistries, tt.mirrorTargets, tt.prependExisting, tt.userinfo)
+			if tt.expectedError != "" {
+				require.EqualError(t, err, tt.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			b, err := os.ReadFile(configPath)
+			require.NoError(t, err)
+			require.EqualT(t, tt.expectedConfig, string(b))
+
+			// Running again should result in the same configuration.
+			err = AddMirrorConfiguration(t.Context(), configPath, tt.mirroredRegistries, tt.mirrorTargets, tt.prependExisting, tt.userinfo)
+			require.NoError(t, err)
+			b, err = os.ReadFile(configPath)
+			require.NoError(t, err)
+			require.EqualT(t, tt.expectedConfig, string(b))
+
+			err = CleanupMirrorConfiguration(t.Context(), configPath)
+			require.NoError(t, err)
+			require.FileNotExists(t, configPath+backupSuffix)
+			expectedConfig := "{}\n"
+			if tt.existingConfig != "" {
+				expectedConfig = tt.existingConfig
+			}
+			b, err = os.ReadFile(configPath)
+			require.NoError(t, err)
+			require.JSONEqT(t, expectedConfig, string(b))
+
+			err = CleanupMirrorConfiguration(t.Context(), configPath)
+			require.NoError(t, err)
+		})
+	}
+}
@@ -0,0 +1,211 @@
+package oci
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/go-logr/logr"
+	"github.com/opencontainers/go-digest"
+)
+
+// ImageIndex contains the images of a store and where their content is located.
+type ImageIndex[C any] struct {
+	Images  map[Image][]digest.Digest
+	Content map[digest.Digest]C
+}
+
+func NewImageIndex[C any]() *ImageIndex[C] {
+	return &ImageIndex[C]{
+		Images:  map[Image][]digest.Digest{},
+		Content: map[digest.Digest]C{},
+	}
+}
+
+// References returns the references to advertise keyed by their identifier.
+func (idx *ImageIndex[C]) References() map[string]Reference {
+	refs := map[string]Reference{}
+	for img, dgsts := range idx.Images {
+		if img.Tag != "" {
+			ref := img.Reference
+			ref.Digest = ""
+			refs[ref.Identifier()] = ref
+		}
+		for _, dgst := range dgsts {
+			ref := Reference{
+				Registry:   img.Registry,
+				Repository: img.Repository,
+				Digest:     dgst,
+			}
+			refs[ref.Identifier()] = ref
+		}
+	}
+	return refs
+}
+
+// IndexWatcher keeps an image index which is read from files up to date.
+// The index is rebuilt when any of the files has been modified.
+type IndexWatcher[C any] struct {
+	read     func(ctx context.Context) (*ImageIndex[C], error)
+	modTimes map[string]time.Time
+	index    *ImageIndex[C]
+	paths    []string
+	mx       sync.Mutex
+}
+
+// NewIndexWatcher returns a watcher for the index files at the paths, which are read with the read function.
+// Missing files are expected to be treated as empty by the read function.
+func NewIndexWatcher[C any](paths []string, read func(ctx context.Context) (*ImageIndex[C], error)) *IndexWatcher[C] {
+	cleanPaths := []string{}
+	for _, path := range paths {
+		cleanPaths = append(cleanPaths, filepath.Clean(path))
+	}
+	return &IndexWatcher[C]{
+		read:  read,
+		paths: cleanPaths,
+	}
+}
+
+// Load returns the index, which is rebuilt when any of the index files has changed.
+func (w *IndexWatcher[C]) Load(ctx context.Context) (*ImageIndex[C], error) {
+	w.mx.Lock()
+	defer w.mx.Unlock()
+
+	modTimes, err := w.stat()
+	if err != nil {
+		return nil, err
+	}
+	if w.index != nil && maps.Equal(modTimes, w.modTimes) {
+		return w.index, nil
+	}
+	return w.readIndex(ctx, modTimes)
+}
+
+// Reload rebuilds the index from the index files.
+func (w *IndexWatcher[C]) Reload(ctx context.Context) (*ImageIndex[C], error) {
+	w.mx.Lock()
+	defer w.mx.Unlock()
+
+	modTimes, err := w.stat()
+	if err != nil {
+		return nil, err
+	}
+	return w.readIndex(ctx, modTimes)
+}
+
+// Subscribe returns the images in the index and events for references which are added or removed when the index files change.
+func (w *IndexWatcher[C]) Subscribe(ctx context.Context) (map[Image][]digest.Digest, <-chan OCIEvent, error) {
+	log := logr.FromContextOrDiscard(ctx)
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, nil, err
+	}
+	// Index files are commonly replaced so the directories have to be watched.
+	for _, path := range w.paths {
+		err = watcher.Add(filepath.Dir(path))
+		if err != nil {
+			watcher.Close()
+			return nil, nil, err
+		}
+	}
+
+	idx, err := w.Load(ctx)
+	if err != nil {
+		watcher.Close()
+		return nil, nil, err
+	}
+	initial := map[Image][]digest.Digest{}
+	for img, dgsts := range idx.Images {
+		initial[img] = slices.Clone(dgsts)
+	}
+
+	eventCh := make(chan OCIEvent)
+	go func() {
+		defer close(eventCh)
+		defer watcher.Close()
+
+		refs := idx.References()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				log.Error(err, "received index watch error")
+			case e, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if !slices.Contains(w.paths, filepath.Clean(e.Name)) || e.Op&(fsnotify.Create|fsnotify.Write|fsnotify.Remove|fsnotify.Rename) == 0 {
+					continue
+				}
+				// Modification time may not change between quick writes so the index is always rebuilt.
+				idx, err := w.Reload(ctx)
+				if err != nil {
+					log.Error(err, "could not reload index", "path", e.Name)
+					continue
+				}
+				newRefs := idx.References()
+				events := []OCIEvent{}
+				for key, ref := range newRefs {
+					if _, ok := refs[key]; ok {
+						continue
+					}
+					events = append(events, OCIEvent{Type: CreateEvent, Reference: ref})
+				}
+				for key, ref := range refs {
+					if _, ok := newRefs[key]; ok {
+						continue
+					}
+					events = append(events, OCIEvent{Type: DeleteEvent, Reference: ref})
+				}
+				refs = newRefs
+				for _, event := range events {
+					select {
+					case <-ctx.Done():
+						return
+					case eventCh <- event:
+					}
+				}
+			}
+		}
+	}()
+	return initial, eventCh, nil
+}
+
+// stat returns the modification times of the index files, missing files have a zero modification time.
+func (w *IndexWatcher[C]) stat() (map[string]time.Time, error) {
+	modTimes := map[string]time.Time{}
+	for _, path := range w.paths {
+		fi, err := os.Stat(path)
+		if errors.Is(err, os.ErrNotExist) {
+			modTimes[path] = time.Time{}
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		modTimes[path] = fi.ModTime()
+	}
+	return modTimes, nil
+}
+
+// readIndex reads the index, the modification times are taken before reading so that concurrent writes cause another rebuild.
+func (w *IndexWatcher[C]) readIndex(ctx context.Context, modTimes map[string]time.Time) (*ImageIndex[C], error) {
+	idx, err := w.read(ctx)
+	if err != nil {
+		return nil, err
+	}
+	w.index = idx
+	w.modTimes = modTimes
+	return idx, nil
+}
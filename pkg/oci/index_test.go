@@ -0,0 +1,73 @@
+package oci
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-openapi/testify/v2/require"
+	"github.com/opencontainers/go-digest"
+)
+
+func TestImageIndexReferences(t *testing.T) {
+	t.Parallel()
+
+	dgst := digest.Digest("sha256:c0669ef34cdc14332c0f1ab0c2c01acb91d96014b172f1a76f3a39e63d1f0bda")
+	layerDgst := digest.Digest("sha256:9a0b0ce99936ce4861d44ce1f193e881e5b40b5bf1847627061205b092fa7f1d")
+	img, err := ParseImage("docker.io/library/alpine:3.18.0@" + dgst.String())
+	require.NoError(t, err)
+
+	idx := NewImageIndex[string]()
+	idx.Images[img] = []digest.Digest{dgst, layerDgst}
+	refs := idx.References()
+	require.Len(t, refs, 3)
+	for _, ref := range refs {
+		require.EqualT(t, "docker.io", ref.Registry)
+		require.EqualT(t, "library/alpine", ref.Repository)
+	}
+}
+
+func TestIndexWatcher(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "index.json")
+	reads := 0
+	watcher := NewIndexWatcher([]string{path}, func(ctx context.Context) (*ImageIndex[string], error) {
+		reads += 1
+		return NewImageIndex[string](), nil
+	})
+
+	_, err := watcher.Load(t.Context())
+	require.NoError(t, err)
+	_, err = watcher.Load(t.Context())
+	require.NoError(t, err)
+	require.EqualT(t, 1, reads)
+
+	err = os.WriteFile(path, []byte("{}"), 0o644)
+	require.NoError(t, err)
+	_, err = watcher.Load(t.Context())
+	require.NoError(t, err)
+	require.EqualT(t, 2, reads)
+	_, err = watcher.Load(t.Context())
+	require.NoError(t, err)
+	require.EqualT(t, 2, reads)
+
+	err = os.Chtimes(path, time.Now(), time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	_, err = watcher.Load(t.Context())
+	require.NoError(t, err)
+	require.EqualT(t, 3, reads)
+
+	_, err = watcher.Reload(t.Context())
+	require.NoError(t, err)
+	require.EqualT(t, 4, reads)
+
+	err = os.Remove(path)
+	require.NoError(t, err)
+	_, err = watcher.Load(t.Context())
+	require.NoError(t, err)
+	require.EqualT(t, 5, reads)
+}
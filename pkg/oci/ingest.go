@@ -0,0 +1,107 @@
+package oci
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+const (
+	ingestPollInterval = 10 * time.Millisecond
+	ingestStallTimeout = 30 * time.Second
+)
+
+var _ io.ReadSeekCloser = &IngestReader{}
+
+// IngestReader reads content which is still being written.
+// Reads block until the data is written, the context is cancelled, or the written size stops growing.
+type IngestReader struct {
+	ctx     context.Context
+	ra      io.ReaderAt
+	closer  io.Closer
+	written func() (int64, error)
+	size    int64
+	offset  int64
+}
+
+// NewIngestReader returns a reader for content of the given size that is written to ra.
+// The written function returns the amount of data written so far, or an error if the write has been aborted.
+func NewIngestReader(ctx context.Context, ra io.ReaderAt, size int64, written func() (int64, error), closer io.Closer) *IngestReader {
+	return &IngestReader{
+		ctx:     ctx,
+		ra:      ra,
+		closer:  closer,
+		written: written,
+		size:    size,
+	}
+}
+
+func (r *IngestReader) Read(p []byte) (int, error) {
+	if r.offset >= r.size {
+		return 0, io.EOF
+	}
+	p = p[:min(int64(len(p)), r.size-r.offset)]
+
+	lastWritten := int64(-1)
+	lastProgress := time.Now()
+	timer := time.NewTimer(ingestPollInterval)
+	defer timer.Stop()
+	for {
+		written, err := r.written()
+		if err != nil {
+			return 0, err
+		}
+		if written > r.offset {
+			n, err := r.ra.ReadAt(p[:min(int64(len(p)), written-r.offset)], r.offset)
+			r.offset += int64(n)
+			if n > 0 {
+				return n, nil
+			}
+			// EOF is expected as the written data may not have been flushed yet.
+			if err != nil && !errors.Is(err, io.EOF) {
+				return 0, err
+			}
+		}
+
+		if written != lastWritten {
+			lastWritten = written
+			lastProgress = time.Now()
+		}
+		if time.Since(lastProgress) > ingestStallTimeout {
+			return 0, fmt.Errorf("ingest has not progressed for %s", ingestStallTimeout)
+		}
+
+		timer.Reset(ingestPollInterval)
+		select {
+		case <-r.ctx.Done():
+			return 0, r.ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+func (r *IngestReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.size
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+	r.offset = offset
+	return offset, nil
+}
+
+func (r *IngestReader) Close() error {
+	if r.closer == nil {
+		return nil
+	}
+	return r.closer.Close()
+}
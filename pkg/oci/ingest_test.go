@@ -0,0 +1,95 @@
+package oci
+
+import (
+	"io"
+	"testing"
+	"testing/synctest"
+	"time"
+
+	"github.com/go-openapi/testify/v2/require"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func TestIngestReader(t *testing.T) {
+	t.Parallel()
+
+	synctest.Test(t, func(t *testing.T) {
+		b := []byte("Lorem Ipsum Dolor")
+		desc := ocispec.Descriptor{Digest: digest.FromBytes(b), MediaType: "dummy", Size: int64(len(b))}
+		store := NewMemory()
+
+		_, err := store.IngestDescriptor(t.Context(), desc.Digest)
+		require.ErrorIs(t, err, ErrNotFound)
+		_, err = store.OpenIngest(t.Context(), desc.Digest)
+		require.ErrorIs(t, err, ErrNotFound)
+
+		cw, err := store.Writer(t.Context(), Reference{}, desc)
+		require.NoError(t, err)
+		ingestDesc, err := store.IngestDescriptor(t.Context(), desc.Digest)
+		require.NoError(t, err)
+		require.Equal(t, desc, ingestDesc)
+
+		rc, err := store.OpenIngest(t.Context(), desc.Digest)
+		require.NoError(t, err)
+		_, err = rc.Seek(6, io.SeekStart)
+		require.NoError(t, err)
+		resCh := make(chan []byte)
+		go func() {
+			b, err := io.ReadAll(rc)
+			if err != nil {
+				close(resCh)
+				return
+			}
+			resCh <- b
+		}()
+
+		// Reader waits for data to be written.
+		_, err = cw.Write(b[:10])
+		require.NoError(t, err)
+		time.Sleep(time.Second)
+		_, err = cw.Write(b[10:])
+		require.NoError(t, err)
+		err = cw.Commit(t.Context())
+		require.NoError(t, err)
+		err = cw.Close()
+		require.NoError(t, err)
+		require.EqualT(t, "Ipsum Dolor", string(<-resCh))
+		err = rc.Close()
+		require.NoError(t, err)
+
+		// Ingest is removed when committed.
+		_, err = store.IngestDescriptor(t.Context(), desc.Digest)
+		require.ErrorIs(t, err, ErrNotFound)
+	})
+}
+
+func TestIngestReaderAborted(t *testing.T) {
+	t.Parallel()
+
+	synctest.Test(t, func(t *testing.T) {
+		b := []byte("Lorem Ipsum Dolor")
+		desc := ocispec.Descriptor{Digest: digest.FromBytes(b), MediaType: "dummy", Size: int64(len(b))}
+		store := NewMemory()
+
+		cw, err := store.Writer(t.Context(), Reference{}, desc)
+		require.NoError(t, err)
+		rc, err := store.OpenIngest(t.Context(), desc.Digest)
+		require.NoError(t, err)
+		err = cw.Close()
+		require.NoError(t, err)
+		_, err = io.ReadAll(rc)
+		require.EqualError(t, err, "ingest has been aborted")
+
+		cw, err = store.Writer(t.Context(), Reference{}, desc)
+		require.NoError(t, err)
+		rc, err = store.OpenIngest(t.Context(), desc.Digest)
+		require.NoError(t, err)
+		_, err = cw.Write(b[:5])
+		require.NoError(t, err)
+		start := time.Now()
+		_, err = io.ReadAll(rc)
+		require.EqualError(t, err, "ingest has not progressed for 30s")
+		require.GreaterOrEqual(t, time.Since(start), ingestStallTimeout)
+	})
+}
@@ -0,0 +1,243 @@
+package layout
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/containerd/containerd/v2/core/images"
+	"github.com/go-logr/logr"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/spegel-org/spegel/pkg/oci"
+)
+
+const (
+	indexFile = "index.json"
+	// Annotation used by containerd when exporting images with their full name.
+	annotationImageName = "io.containerd.image.name"
+)
+
+var _ oci.Store = &Layout{}
+
+// Layout serves content from one or more OCI image layout directories.
+// Images are named by the containerd image name annotation or a fully qualified reference name annotation.
+// https://github.com/opencontainers/image-spec/blob/main/image-layout.md
+type Layout struct {
+	watcher *oci.IndexWatcher[layoutContent]
+	dirs    []string
+}
+
+func NewLayout(dirs []string) (*Layout, error) {
+	if len(dirs) == 0 {
+		return nil, errors.New("at least one layout directory is required")
+	}
+	for _, dir := range dirs {
+		_, err := os.Stat(filepath.Join(dir, ocispec.ImageLayoutFile))
+		if err != nil {
+			return nil, fmt.Errorf("directory %s is not an OCI image layout: %w", dir, err)
+		}
+	}
+	l := &Layout{
+		dirs: dirs,
+	}
+	indexPaths := []string{}
+	for _, dir := range dirs {
+		indexPaths = append(indexPaths, filepath.Join(dir, indexFile))
+	}
+	l.watcher = oci.NewIndexWatcher(indexPaths, l.readIndex)
+	return l, nil
+}
+
+func (l *Layout) Name() string {
+	return "layout"
+}
+
+func (l *Layout) ListImages(ctx context.Context) ([]oci.Image, error) {
+	idx, err := l.watcher.Load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	imgs := []oci.Image{}
+	for img := range idx.Images {
+		imgs = append(imgs, img)
+	}
+	return imgs, nil
+}
+
+func (l *Layout) Resolve(ctx context.Context, ref string) (digest.Digest, error) {
+	idx, err := l.watcher.Load(ctx)
+	if err != nil {
+		return "", err
+	}
+	for img := range idx.Images {
+		tagName, ok := img.TagName()
+		if !ok || tagName != ref {
+			continue
+		}
+		return img.Digest, nil
+	}
+	return "", errors.Join(oci.ErrNotFound, fmt.Errorf("could not resolve tag %s to a digest", ref))
+}
+
+func (l *Layout) Descriptor(ctx context.Context, dgst digest.Digest) (ocispec.Descriptor, error) {
+	idx, err := l.watcher.Load(ctx)
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	c, ok := idx.Content[dgst]
+	if !ok {
+		return ocispec.Descriptor{}, errors.Join(oci.ErrNotFound, fmt.Errorf("content with digest %s not found", dgst))
+	}
+	fi, err := os.Stat(blobPath(c.dir, dgst))
+	if errors.Is(err, os.ErrNotExist) {
+		return ocispec.Descriptor{}, errors.Join(oci.ErrNotFound, err)
+	}
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	desc := ocispec.Descriptor{
+		Size:      fi.Size(),
+		Digest:    dgst,
+		MediaType: c.mediaType,
+	}
+	return desc, nil
+}
+
+func (l *Layout) Open(ctx context.Context, dgst digest.Digest) (io.ReadSeekCloser, error) {
+	idx, err := l.watcher.Load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c, ok := idx.Content[dgst]
+	if !ok {
+		return nil, errors.Join(oci.ErrNotFound, fmt.Errorf("content with digest %s not found", dgst))
+	}
+	file, err := os.Open(blobPath(c.dir, dgst))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, errors.Join(oci.ErrNotFound, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+func (l *Layout) Subscribe(ctx context.Context) (map[oci.Image][]digest.Digest, <-chan oci.OCIEvent, error) {
+	return l.watcher.Subscribe(ctx)
+}
+
+type layoutContent struct {
+	dir       string
+	mediaType string
+}
+
+// readIndex builds the content index from the index files.
+func (l *Layout) readIndex(ctx context.Context) (*oci.ImageIndex[layoutContent], error) {
+	log := logr.FromContextOrDiscard(ctx)
+
+	idx := oci.NewImageIndex[layoutContent]()
+	for _, dir := range l.dirs {
+		b, err := os.ReadFile(filepath.Join(dir, indexFile))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		var index ocispec.Index
+		err = json.Unmarshal(b, &index)
+		if err != nil {
+			return nil, fmt.Errorf("could not decode index in %s: %w", dir, err)
+		}
+		for _, desc := range index.Manifests {
+			dgsts, err := walk(idx, dir, desc)
+			if err != nil {
+				log.Error(err, "skipping image that cannot be walked", "dir", dir, "digest", desc.Digest)
+				continue
+			}
+			img, ok := imageName(desc)
+			if !ok {
+				log.Info("skipping image without a fully qualified name", "dir", dir, "digest", desc.Digest)
+				continue
+			}
+			idx.Images[img] = dgsts
+		}
+	}
+	return idx, nil
+}
+
+// walk adds the descriptor and its children to the index and returns their digests.
+// The first directory to contain content is used to serve it.
+func walk(idx *oci.ImageIndex[layoutContent], dir string, desc ocispec.Descriptor) ([]digest.Digest, error) {
+	if _, ok := idx.Content[desc.Digest]; !ok {
+		idx.Content[desc.Digest] = layoutContent{dir: dir, mediaType: desc.MediaType}
+	}
+	dgsts := []digest.Digest{desc.Digest}
+	if !images.IsIndexType(desc.MediaType) && !images.IsManifestType(desc.MediaType) {
+		return dgsts, nil
+	}
+
+	if desc.Size > oci.ManifestMaxSize {
+		return nil, fmt.Errorf("manifest %s exceeds max size", desc.Digest)
+	}
+	b, err := os.ReadFile(blobPath(dir, desc.Digest))
+	if err != nil {
+		return nil, err
+	}
+	var manifest struct {
+		Config    *ocispec.Descriptor  `json:"config,omitempty"`
+		Manifests []ocispec.Descriptor `json:"manifests,omitempty"`
+		Layers    []ocispec.Descriptor `json:"layers,omitempty"`
+	}
+	err = json.Unmarshal(b, &manifest)
+	if err != nil {
+		return nil, err
+	}
+	children := manifest.Manifests
+	if manifest.Config != nil {
+		children = append(children, *manifest.Config)
+	}
+	children = append(children, manifest.Layers...)
+	for _, child := range children {
+		// Layouts may only contain a subset of the content, for example a single platform.
+		_, err := os.Stat(blobPath(dir, child.Digest))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		childDgsts, err := walk(idx, dir, child)
+		if err != nil {
+			return nil, err
+		}
+		dgsts = append(dgsts, childDgsts...)
+	}
+	return dgsts, nil
+}
+
+// imageName returns the image for the index descriptor if it has a fully qualified name.
+func imageName(desc ocispec.Descriptor) (oci.Image, bool) {
+	for _, key := range []string{annotationImageName, ocispec.AnnotationRefName} {
+		name, ok := desc.Annotations[key]
+		if !ok {
+			continue
+		}
+		img, err := oci.ParseImage(name, oci.WithDigest(desc.Digest))
+		if err != nil {
+			continue
+		}
+		return img, true
+	}
+	return oci.Image{}, false
+}
+
+func blobPath(dir string, dgst digest.Digest) string {
+	return filepath.Join(dir, ocispec.ImageBlobsDir, dgst.Algorithm().String(), dgst.Encoded())
+}
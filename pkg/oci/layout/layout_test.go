@@ -0,0 +1,128 @@
+package layout
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-openapi/testify/v2/require"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/spegel-org/spegel/pkg/oci"
+)
+
+const (
+	alpineIndex     = digest.Digest("sha256:a4a7661cdca6dfe4fd9412e08df663f71b5a298fe301944391b70d8f6e37cad7")
+	alpineManifest  = digest.Digest("sha256:d85a123c1227c8d60e45ae3c1886cbf8d199879edf2ca7591d16ad5cc659ead1")
+	alpineConfig    = digest.Digest("sha256:f1a6b8c350acc55105fee0ed3d6292bd0809b968fb75a4b8f00ca5bd2af2d232")
+	alpineLayer     = digest.Digest("sha256:1831de19da58a7c0b6e6cae13809adba551c06051fac2215aeeec055a491179e")
+	spegelManifest  = digest.Digest("sha256:88a4c07b2b1e0c0998f34803a56ef6f3e9bdf8c75da435fbaf9e1142e601dbfb")
+	spegelConfig    = digest.Digest("sha256:bbe7649ee8d882261f68d9ba6c2ea84d9eac0cb4e8a39fdd85cf5b10365bca16")
+	spegelLayer     = digest.Digest("sha256:f5f99e737cf135a7187d7a0d4072ed7efdd5ae0bc090fd65f6f11c74e579746b")
+	unnamedManifest = digest.Digest("sha256:ac09a8d5a77fa966d986d593aef221a5d33075e82ada2f91021522818cf291b3")
+)
+
+func TestLayout(t *testing.T) {
+	t.Parallel()
+
+	_, err := NewLayout(nil)
+	require.EqualError(t, err, "at least one layout directory is required")
+	_, err = NewLayout([]string{t.TempDir()})
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	l, err := NewLayout([]string{"testdata/layout"})
+	require.NoError(t, err)
+	require.EqualT(t, "layout", l.Name())
+
+	imgs, err := l.ListImages(t.Context())
+	require.NoError(t, err)
+	expectedImgs := []oci.Image{
+		{Reference: oci.Reference{Registry: "docker.io", Repository: "library/alpine", Tag: "3.20", Digest: alpineIndex}},
+		{Reference: oci.Reference{Registry: "ghcr.io", Repository: "spegel-org/spegel", Tag: "v1", Digest: spegelManifest}},
+	}
+	require.ElementsMatchT(t, expectedImgs, imgs)
+
+	dgst, err := l.Resolve(t.Context(), "docker.io/library/alpine:3.20")
+	require.NoError(t, err)
+	require.EqualT(t, alpineIndex, dgst)
+	_, err = l.Resolve(t.Context(), "docker.io/library/alpine:latest")
+	require.ErrorIs(t, err, oci.ErrNotFound)
+
+	for _, tt := range []struct {
+		dgst      digest.Digest
+		mediaType string
+	}{
+		{dgst: alpineIndex, mediaType: ocispec.MediaTypeImageIndex},
+		{dgst: alpineManifest, mediaType: ocispec.MediaTypeImageManifest},
+		{dgst: alpineConfig, mediaType: ocispec.MediaTypeImageConfig},
+		{dgst: alpineLayer, mediaType: ocispec.MediaTypeImageLayerGzip},
+		{dgst: spegelLayer, mediaType: ocispec.MediaTypeImageLayerGzip},
+		{dgst: unnamedManifest, mediaType: ocispec.MediaTypeImageManifest},
+	} {
+		desc, err := l.Descriptor(t.Context(), tt.dgst)
+		require.NoError(t, err)
+		require.EqualT(t, tt.mediaType, desc.MediaType)
+		rc, err := l.Open(t.Context(), tt.dgst)
+		require.NoError(t, err)
+		b, err := io.ReadAll(rc)
+		require.NoError(t, err)
+		require.NoError(t, rc.Close())
+		require.EqualT(t, desc.Size, int64(len(b)))
+		require.EqualT(t, tt.dgst, digest.FromBytes(b))
+	}
+
+	_, err = l.Descriptor(t.Context(), digest.FromString("missing"))
+	require.ErrorIs(t, err, oci.ErrNotFound)
+	_, err = l.Open(t.Context(), digest.FromString("missing"))
+	require.ErrorIs(t, err, oci.ErrNotFound)
+}
+
+func TestLayoutSubscribe(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	err := os.CopyFS(dir, os.DirFS("testdata/layout"))
+	require.NoError(t, err)
+	l, err := NewLayout([]string{dir})
+	require.NoError(t, err)
+
+	initial, eventCh, err := l.Subscribe(t.Context())
+	require.NoError(t, err)
+	require.Len(t, initial, 2)
+	spegel := oci.Image{Reference: oci.Reference{Registry: "ghcr.io", Repository: "spegel-org/spegel", Tag: "v1", Digest: spegelManifest}}
+	require.ElementsMatchT(t, []digest.Digest{spegelManifest, spegelConfig, spegelLayer}, initial[spegel])
+
+	// Remove the spegel image from the index.
+	b, err := os.ReadFile(filepath.Join(dir, indexFile))
+	require.NoError(t, err)
+	var index ocispec.Index
+	err = json.Unmarshal(b, &index)
+	require.NoError(t, err)
+	index.Manifests = []ocispec.Descriptor{index.Manifests[0], index.Manifests[2]}
+	b, err = json.Marshal(index)
+	require.NoError(t, err)
+	err = os.WriteFile(filepath.Join(dir, indexFile), b, 0o644)
+	require.NoError(t, err)
+
+	events := []oci.OCIEvent{}
+	timeoutCh := time.After(5 * time.Second)
+	for len(events) < 4 {
+		select {
+		case <-timeoutCh:
+			t.Fatalf("timed out waiting for events %v", events)
+		case event := <-eventCh:
+			events = append(events, event)
+		}
+	}
+	expectedEvents := []oci.OCIEvent{
+		{Type: oci.DeleteEvent, Reference: oci.Reference{Registry: "ghcr.io", Repository: "spegel-org/spegel", Tag: "v1"}},
+		{Type: oci.DeleteEvent, Reference: oci.Reference{Registry: "ghcr.io", Repository: "spegel-org/spegel", Digest: spegelManifest}},
+		{Type: oci.DeleteEvent, Reference: oci.Reference{Registry: "ghcr.io", Repository: "spegel-org/spegel", Digest: spegelConfig}},
+		{Type: oci.DeleteEvent, Reference: oci.Reference{Registry: "ghcr.io", Repository: "spegel-org/spegel", Digest: spegelLayer}},
+	}
+	require.ElementsMatchT(t, expectedEvents, events)
+}
@@ -12,22 +12,27 @@ import (
 	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
 )
 
-var _ Store = &Memory{}
+var (
+	_ WritableStore = &Memory{}
+	_ IngestStore   = &Memory{}
+)
 
 type Memory struct {
-	descs  map[digest.Digest]ocispec.Descriptor
-	blobs  map[digest.Digest][]byte
-	tags   map[string]Image
-	images map[Image][]digest.Digest
-	mx     sync.RWMutex
+	descs   map[digest.Digest]ocispec.Descriptor
+	blobs   map[digest.Digest][]byte
+	tags    map[string]Image
+	images  map[Image][]digest.Digest
+	ingests map[digest.Digest]*memoryWriter
+	mx      sync.RWMutex
 }
 
 func NewMemory() *Memory {
 	return &Memory{
-		images: map[Image][]digest.Digest{},
-		tags:   map[string]Image{},
-		descs:  map[digest.Digest]ocispec.Descriptor{},
-		blobs:  map[digest.Digest][]byte{},
+		images:  map[Image][]digest.Digest{},
+		tags:    map[string]Image{},
+		descs:   map[digest.Digest]ocispec.Descriptor{},
+		blobs:   map[digest.Digest][]byte{},
+		ingests: map[digest.Digest]*memoryWriter{},
 	}
 }
 
@@ -135,3 +140,131 @@ func (m *Memory) Write(img *Image, desc ocispec.Descriptor, b []byte) error {
 	m.blobs[desc.Digest] = b
 	return nil
 }
+
+func (m *Memory) Writer(ctx context.Context, ref Reference, desc ocispec.Descriptor) (ContentWriter, error) {
+	if desc.Digest == "" {
+		return nil, errors.New("digest cannot be empty")
+	}
+
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	if _, ok := m.ingests[desc.Digest]; ok {
+		return nil, fmt.Errorf("digest %s is already being written", desc.Digest)
+	}
+	w := &memoryWriter{
+		memory: m,
+		desc:   desc,
+	}
+	m.ingests[desc.Digest] = w
+	return w, nil
+}
+
+func (m *Memory) IngestDescriptor(ctx context.Context, dgst digest.Digest) (ocispec.Descriptor, error) {
+	m.mx.RLock()
+	defer m.mx.RUnlock()
+
+	w, ok := m.ingests[dgst]
+	if !ok || w.desc.Size == 0 {
+		return ocispec.Descriptor{}, errors.Join(ErrNotFound, fmt.Errorf("ingest for digest %s not found", dgst))
+	}
+	return w.desc, nil
+}
+
+func (m *Memory) ListIngests(ctx context.Context) ([]digest.Digest, error) {
+	m.mx.RLock()
+	defer m.mx.RUnlock()
+
+	dgsts := []digest.Digest{}
+	for dgst, w := range m.ingests {
+		if w.desc.Size == 0 {
+			continue
+		}
+		dgsts = append(dgsts, dgst)
+	}
+	return dgsts, nil
+}
+
+func (m *Memory) OpenIngest(ctx context.Context, dgst digest.Digest) (io.ReadSeekCloser, error) {
+	m.mx.RLock()
+	defer m.mx.RUnlock()
+
+	w, ok := m.ingests[dgst]
+	if !ok || w.desc.Size == 0 {
+		return nil, errors.Join(ErrNotFound, fmt.Errorf("ingest for digest %s not found", dgst))
+	}
+	ra := readerAtFunc(func(p []byte, off int64) (int, error) {
+		m.mx.RLock()
+		defer m.mx.RUnlock()
+
+		return bytes.NewReader(w.buf).ReadAt(p, off)
+	})
+	written := func() (int64, error) {
+		m.mx.RLock()
+		defer m.mx.RUnlock()
+
+		if w.closed && !w.committed {
+			return 0, errors.New("ingest has been aborted")
+		}
+		return int64(len(w.buf)), nil
+	}
+	return NewIngestReader(ctx, ra, w.desc.Size, written, nil), nil
+}
+
+type memoryWriter struct {
+	memory    *Memory
+	buf       []byte
+	desc      ocispec.Descriptor
+	committed bool
+	closed    bool
+}
+
+func (w *memoryWriter) Write(p []byte) (int, error) {
+	w.memory.mx.Lock()
+	defer w.memory.mx.Unlock()
+
+	if w.committed {
+		return 0, errors.New("writer has already been committed")
+	}
+	w.buf = append(w.buf, p...)
+	return len(p), nil
+}
+
+func (w *memoryWriter) Commit(ctx context.Context) error {
+	w.memory.mx.RLock()
+	committed := w.committed
+	b := bytes.Clone(w.buf)
+	w.memory.mx.RUnlock()
+	if committed {
+		return errors.New("writer has already been committed")
+	}
+
+	err := w.memory.Write(nil, w.desc, b)
+	if err != nil {
+		return err
+	}
+
+	w.memory.mx.Lock()
+	defer w.memory.mx.Unlock()
+
+	w.committed = true
+	delete(w.memory.ingests, w.desc.Digest)
+	return nil
+}
+
+func (w *memoryWriter) Close() error {
+	w.memory.mx.Lock()
+	defer w.memory.mx.Unlock()
+
+	w.closed = true
+	if w.memory.ingests[w.desc.Digest] == w {
+		delete(w.memory.ingests, w.desc.Digest)
+	}
+	return nil
+}
+
+type readerAtFunc func(p []byte, off int64) (int, error)
+
+func (f readerAtFunc) ReadAt(p []byte, off int64) (int, error) {
+	return f(p, off)
+}
@@ -0,0 +1,281 @@
+package oci
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+var (
+	_ Store         = &MultiStore{}
+	_ WritableStore = &writableMultiStore{}
+	_ IngestStore   = &ingestMultiStore{}
+	_ WritableStore = &writableIngestMultiStore{}
+	_ IngestStore   = &writableIngestMultiStore{}
+)
+
+// MultiStore combines multiple stores into a single store.
+// Stores are queried in the order given, the first store to return content is used.
+type MultiStore struct {
+	stores []Store
+}
+
+// NewMultiStore returns a store combining the given stores.
+// The returned store is only writable or serves ingests if at least one of the stores does,
+// so that capability checks against the returned store fail at startup instead of at runtime.
+func NewMultiStore(stores ...Store) (Store, error) {
+	if len(stores) == 0 {
+		return nil, errors.New("at least one store is required")
+	}
+	multiStore := &MultiStore{stores: stores}
+
+	var writer multiWriter
+	ingester := multiIngester{}
+	for _, store := range stores {
+		if writableStore, ok := store.(WritableStore); ok && writer.store == nil {
+			writer.store = writableStore
+		}
+		if ingestStore, ok := store.(IngestStore); ok {
+			ingester.stores = append(ingester.stores, ingestStore)
+		}
+	}
+	switch {
+	case writer.store != nil && len(ingester.stores) > 0:
+		return &writableIngestMultiStore{MultiStore: multiStore, multiWriter: writer, multiIngester: ingester}, nil
+	case writer.store != nil:
+		return &writableMultiStore{MultiStore: multiStore, multiWriter: writer}, nil
+	case len(ingester.stores) > 0:
+		return &ingestMultiStore{MultiStore: multiStore, multiIngester: ingester}, nil
+	default:
+		return multiStore, nil
+	}
+}
+
+type writableMultiStore struct {
+	*MultiStore
+	multiWriter
+}
+
+type ingestMultiStore struct {
+	*MultiStore
+	multiIngester
+}
+
+type writableIngestMultiStore struct {
+	*MultiStore
+	multiWriter
+	multiIngester
+}
+
+func (m *MultiStore) Name() string {
+	return "multi"
+}
+
+func (m *MultiStore) ListImages(ctx context.Context) ([]Image, error) {
+	imgs := []Image{}
+	for _, store := range m.stores {
+		storeImgs, err := store.ListImages(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("could not list images in store %s: %w", store.Name(), err)
+		}
+		for _, img := range storeImgs {
+			if slices.Contains(imgs, img) {
+				continue
+			}
+			imgs = append(imgs, img)
+		}
+	}
+	return imgs, nil
+}
+
+func (m *MultiStore) Resolve(ctx context.Context, ref string) (digest.Digest, error) {
+	return firstOf(m.stores, func(store Store) (digest.Digest, error) {
+		return store.Resolve(ctx, ref)
+	})
+}
+
+func (m *MultiStore) Descriptor(ctx context.Context, dgst digest.Digest) (ocispec.Descriptor, error) {
+	return firstOf(m.stores, func(store Store) (ocispec.Descriptor, error) {
+		return store.Descriptor(ctx, dgst)
+	})
+}
+
+func (m *MultiStore) Open(ctx context.Context, dgst digest.Digest) (io.ReadSeekCloser, error) {
+	return firstOf(m.stores, func(store Store) (io.ReadSeekCloser, error) {
+		return store.Open(ctx, dgst)
+	})
+}
+
+// multiWriter writes to the first store which is writable.
+type multiWriter struct {
+	store WritableStore
+}
+
+func (m multiWriter) Writer(ctx context.Context, ref Reference, desc ocispec.Descriptor) (ContentWriter, error) {
+	return m.store.Writer(ctx, ref, desc)
+}
+
+// multiIngester serves ingests from all stores which support ingests.
+type multiIngester struct {
+	stores []IngestStore
+}
+
+func (m multiIngester) IngestDescriptor(ctx context.Context, dgst digest.Digest) (ocispec.Descriptor, error) {
+	return firstOf(m.stores, func(store IngestStore) (ocispec.Descriptor, error) {
+		return store.IngestDescriptor(ctx, dgst)
+	})
+}
+
+func (m multiIngester) ListIngests(ctx context.Context) ([]digest.Digest, error) {
+	dgsts := []digest.Digest{}
+	for _, store := range m.stores {
+		storeDgsts, err := store.ListIngests(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, dgst := range storeDgsts {
+			if slices.Contains(dgsts, dgst) {
+				continue
+			}
+			dgsts = append(dgsts, dgst)
+		}
+	}
+	return dgsts, nil
+}
+
+func (m multiIngester) OpenIngest(ctx context.Context, dgst digest.Digest) (io.ReadSeekCloser, error) {
+	return firstOf(m.stores, func(store IngestStore) (io.ReadSeekCloser, error) {
+		return store.OpenIngest(ctx, dgst)
+	})
+}
+
+// Subscribe merges the initial state and events of all stores.
+// Content present in more than one store is only included once, and is deleted when it is removed from all stores.
+// The event channel is closed when any of the store event channels are closed.
+func (m *MultiStore) Subscribe(ctx context.Context) (map[Image][]digest.Digest, <-chan OCIEvent, error) {
+	subCtx, subCancel := context.WithCancel(ctx)
+
+	type storeEvent struct {
+		event  OCIEvent
+		idx    int
+		closed bool
+	}
+	muxCh := make(chan storeEvent)
+
+	initial := map[Image][]digest.Digest{}
+	// Identifiers of the content present in each store.
+	present := make([]map[string]any, len(m.stores))
+	for i, store := range m.stores {
+		storeInitial, storeEventCh, err := store.Subscribe(subCtx)
+		if err != nil {
+			subCancel()
+			return nil, nil, fmt.Errorf("could not subscribe to store %s: %w", store.Name(), err)
+		}
+
+		present[i] = map[string]any{}
+		for img, dgsts := range storeInitial {
+			merged := initial[img]
+			for _, dgst := range dgsts {
+				if presentInOther(present, i, dgst.String()) || slices.Contains(merged, dgst) {
+					continue
+				}
+				merged = append(merged, dgst)
+			}
+			initial[img] = merged
+		}
+		for img, dgsts := range storeInitial {
+			tagName, ok := img.TagName()
+			if ok {
+				present[i][tagName] = nil
+			}
+			for _, dgst := range dgsts {
+				present[i][dgst.String()] = nil
+			}
+		}
+
+		// Stores without events return a nil channel which is never closed.
+		if storeEventCh == nil {
+			continue
+		}
+		go func() {
+			for event := range storeEventCh {
+				select {
+				case <-subCtx.Done():
+					// Keep draining until the store closes the channel.
+				case muxCh <- storeEvent{idx: i, event: event}:
+				}
+			}
+			select {
+			case <-subCtx.Done():
+			case muxCh <- storeEvent{idx: i, closed: true}:
+			}
+		}()
+	}
+
+	eventCh := make(chan OCIEvent)
+	go func() {
+		defer subCancel()
+		defer close(eventCh)
+		for {
+			select {
+			case <-subCtx.Done():
+				return
+			case se := <-muxCh:
+				if se.closed {
+					return
+				}
+				key := se.event.Reference.Identifier()
+				switch se.event.Type {
+				case CreateEvent:
+					present[se.idx][key] = nil
+				case DeleteEvent:
+					delete(present[se.idx], key)
+				}
+				if presentInOther(present, se.idx, key) {
+					continue
+				}
+				select {
+				case <-subCtx.Done():
+					return
+				case eventCh <- se.event:
+				}
+			}
+		}
+	}()
+	return initial, eventCh, nil
+}
+
+func presentInOther(present []map[string]any, idx int, key string) bool {
+	for i, p := range present {
+		if i == idx {
+			continue
+		}
+		if _, ok := p[key]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// firstOf returns the first successful result in store order.
+// Not found errors are only returned if all stores fail to find the content.
+func firstOf[S Store, T any](stores []S, fn func(store S) (T, error)) (T, error) {
+	errs := []error{}
+	for _, store := range stores {
+		v, err := fn(store)
+		if err == nil {
+			return v, nil
+		}
+		errs = append(errs, fmt.Errorf("store %s: %w", store.Name(), err))
+	}
+	var zero T
+	if len(errs) == 0 {
+		return zero, ErrNotFound
+	}
+	return zero, errors.Join(errs...)
+}
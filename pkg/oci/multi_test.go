@@ -0,0 +1,200 @@
+package oci
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/go-openapi/testify/v2/require"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func TestMultiStore(t *testing.T) {
+	t.Parallel()
+
+	_, err := NewMultiStore()
+	require.EqualError(t, err, "at least one store is required")
+
+	img, err := ParseImage("example.com/foo:latest", WithDigest(digest.FromString("manifest")))
+	require.NoError(t, err)
+	first := NewMemory()
+	first.AddImage(img)
+	firstDesc := ocispec.Descriptor{MediaType: "dummy", Digest: digest.FromString("first")}
+	err = first.Write(&img, firstDesc, []byte("first"))
+	require.NoError(t, err)
+	second := NewMemory()
+	second.AddImage(img)
+	secondDesc := ocispec.Descriptor{MediaType: "second", Digest: digest.FromString("second")}
+	err = second.Write(&img, secondDesc, []byte("second"))
+	require.NoError(t, err)
+	// Same content in both stores is served by the first.
+	err = second.Write(&img, ocispec.Descriptor{MediaType: "other", Digest: firstDesc.Digest}, []byte("first"))
+	require.NoError(t, err)
+
+	store, err := NewMultiStore(first, second)
+	require.NoError(t, err)
+
+	imgs, err := store.ListImages(t.Context())
+	require.NoError(t, err)
+	require.SliceEqualT(t, []Image{img}, imgs)
+
+	dgst, err := store.Resolve(t.Context(), "example.com/foo:latest")
+	require.NoError(t, err)
+	require.EqualT(t, img.Digest, dgst)
+
+	desc, err := store.Descriptor(t.Context(), firstDesc.Digest)
+	require.NoError(t, err)
+	require.EqualT(t, "dummy", desc.MediaType)
+	desc, err = store.Descriptor(t.Context(), secondDesc.Digest)
+	require.NoError(t, err)
+	require.EqualT(t, "second", desc.MediaType)
+	_, err = store.Descriptor(t.Context(), digest.FromString("missing"))
+	require.ErrorIs(t, err, ErrNotFound)
+
+	rc, err := store.Open(t.Context(), secondDesc.Digest)
+	require.NoError(t, err)
+	b, err := io.ReadAll(rc)
+	require.NoError(t, err)
+	require.EqualT(t, "second", string(b))
+	err = rc.Close()
+	require.NoError(t, err)
+
+	// Writes go to the first writable store.
+	writableStore, ok := store.(WritableStore)
+	require.True(t, ok)
+	ingestStore, ok := store.(IngestStore)
+	require.True(t, ok)
+	b = []byte("written")
+	writeDesc := ocispec.Descriptor{MediaType: "dummy", Digest: digest.FromBytes(b), Size: int64(len(b))}
+	cw, err := writableStore.Writer(t.Context(), Reference{}, writeDesc)
+	require.NoError(t, err)
+	ingestDesc, err := ingestStore.IngestDescriptor(t.Context(), writeDesc.Digest)
+	require.NoError(t, err)
+	require.Equal(t, writeDesc, ingestDesc)
+	_, err = cw.Write(b)
+	require.NoError(t, err)
+	err = cw.Commit(t.Context())
+	require.NoError(t, err)
+	err = cw.Close()
+	require.NoError(t, err)
+	_, err = first.Descriptor(t.Context(), writeDesc.Digest)
+	require.NoError(t, err)
+	_, err = second.Descriptor(t.Context(), writeDesc.Digest)
+	require.Error(t, err)
+}
+
+func TestMultiStoreCapabilities(t *testing.T) {
+	t.Parallel()
+
+	readOnly := struct{ Store }{NewMemory()}
+	writeOnly := struct{ WritableStore }{NewMemory()}
+	ingestOnly := struct{ IngestStore }{NewMemory()}
+
+	tests := []struct {
+		name             string
+		stores           []Store
+		expectedWritable bool
+		expectedIngest   bool
+	}{
+		{
+			name:             "read only",
+			stores:           []Store{readOnly, readOnly},
+			expectedWritable: false,
+			expectedIngest:   false,
+		},
+		{
+			name:             "writable",
+			stores:           []Store{readOnly, writeOnly},
+			expectedWritable: true,
+			expectedIngest:   false,
+		},
+		{
+			name:             "ingest",
+			stores:           []Store{ingestOnly, readOnly},
+			expectedWritable: false,
+			expectedIngest:   true,
+		},
+		{
+			name:             "writable and ingest",
+			stores:           []Store{readOnly, NewMemory()},
+			expectedWritable: true,
+			expectedIngest:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			store, err := NewMultiStore(tt.stores...)
+			require.NoError(t, err)
+			require.EqualT(t, "multi", store.Name())
+			_, ok := store.(WritableStore)
+			require.EqualT(t, tt.expectedWritable, ok)
+			_, ok = store.(IngestStore)
+			require.EqualT(t, tt.expectedIngest, ok)
+		})
+	}
+}
+
+type eventStore struct {
+	*Memory
+	eventCh chan OCIEvent
+}
+
+func (e *eventStore) Subscribe(ctx context.Context) (map[Image][]digest.Digest, <-chan OCIEvent, error) {
+	initial, _, err := e.Memory.Subscribe(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	return initial, e.eventCh, nil
+}
+
+func TestMultiStoreSubscribe(t *testing.T) {
+	t.Parallel()
+
+	img, err := ParseImage("example.com/foo:latest", WithDigest(digest.FromString("manifest")))
+	require.NoError(t, err)
+	sharedDgst := digest.FromString("shared")
+	firstDgst := digest.FromString("first")
+	secondDgst := digest.FromString("second")
+
+	first := &eventStore{Memory: NewMemory(), eventCh: make(chan OCIEvent)}
+	first.AddImage(img)
+	for _, dgst := range []digest.Digest{img.Digest, sharedDgst, firstDgst} {
+		first.images[img] = append(first.images[img], dgst)
+	}
+	second := &eventStore{Memory: NewMemory(), eventCh: make(chan OCIEvent)}
+	second.AddImage(img)
+	for _, dgst := range []digest.Digest{img.Digest, sharedDgst, secondDgst} {
+		second.images[img] = append(second.images[img], dgst)
+	}
+
+	store, err := NewMultiStore(first, second)
+	require.NoError(t, err)
+	initial, eventCh, err := store.Subscribe(t.Context())
+	require.NoError(t, err)
+	require.Len(t, initial, 1)
+	require.ElementsMatchT(t, []digest.Digest{img.Digest, sharedDgst, firstDgst, secondDgst}, initial[img])
+
+	// Delete is only forwarded once content is removed from all stores.
+	sharedRef := Reference{Registry: img.Registry, Repository: img.Repository, Digest: sharedDgst}
+	first.eventCh <- OCIEvent{Type: DeleteEvent, Reference: sharedRef}
+	secondRef := Reference{Registry: img.Registry, Repository: img.Repository, Digest: secondDgst}
+	second.eventCh <- OCIEvent{Type: DeleteEvent, Reference: secondRef}
+	require.Equal(t, OCIEvent{Type: DeleteEvent, Reference: secondRef}, <-eventCh)
+	second.eventCh <- OCIEvent{Type: DeleteEvent, Reference: sharedRef}
+	require.Equal(t, OCIEvent{Type: DeleteEvent, Reference: sharedRef}, <-eventCh)
+
+	// Create is only forwarded when content is not present in another store.
+	firstRef := Reference{Registry: img.Registry, Repository: img.Repository, Digest: firstDgst}
+	second.eventCh <- OCIEvent{Type: CreateEvent, Reference: firstRef}
+	first.eventCh <- OCIEvent{Type: CreateEvent, Reference: secondRef}
+	require.Equal(t, OCIEvent{Type: CreateEvent, Reference: secondRef}, <-eventCh)
+
+	// Closing any store closes the event channel.
+	close(second.eventCh)
+	_, ok := <-eventCh
+	require.False(t, ok)
+	close(first.eventCh)
+}
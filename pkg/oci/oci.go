@@ -33,6 +33,8 @@ const (
 type OCIEvent struct {
 	Type      EventType
 	Reference Reference
+	// Namespace is set by stores which read content from multiple namespaces.
+	Namespace string
 }
 
 type Store interface {
@@ -57,6 +59,51 @@ type Store interface {
 	Subscribe(ctx context.Context) (map[Image][]digest.Digest, <-chan OCIEvent, error)
 }
 
+// WritableStore is a store which content can be written to.
+type WritableStore interface {
+	Store
+
+	// Writer returns a writer for the content described by the descriptor.
+	// The reference is used to record the source of the content.
+	// Written content will not be available until the writer is committed.
+	Writer(ctx context.Context, ref Reference, desc ocispec.Descriptor) (ContentWriter, error)
+}
+
+// ContentWriter writes content to a store.
+type ContentWriter interface {
+	io.Writer
+
+	// Commit verifies the written content against the descriptor digest and makes it available in the store.
+	Commit(ctx context.Context) error
+
+	// Close releases the writer. Content that has not been committed is discarded.
+	Close() error
+}
+
+// IngestStore is a store which can serve content that is still being written to it.
+type IngestStore interface {
+	Store
+
+	// IngestDescriptor returns the OCI descriptor for content which is currently being written.
+	IngestDescriptor(ctx context.Context, dgst digest.Digest) (ocispec.Descriptor, error)
+
+	// ListIngests returns the digests of all content which is currently being written and can be served.
+	ListIngests(ctx context.Context) ([]digest.Digest, error)
+
+	// OpenIngest returns the streamable content which is currently being written.
+	// Reads block until the data has been written. The context is used for the lifetime of the reader.
+	OpenIngest(ctx context.Context, dgst digest.Digest) (io.ReadSeekCloser, error)
+}
+
+// NamespacedStore is a store which reads content from multiple namespaces.
+type NamespacedStore interface {
+	Store
+
+	// SubscribeNamespaces is the same as Subscribe except that the initial state is grouped by namespace.
+	// Events include the namespace of the content.
+	SubscribeNamespaces(ctx context.Context) (map[string]map[Image][]digest.Digest, <-chan OCIEvent, error)
+}
+
 // FingerprintMediaType attempts to determine the media type based on the json structure.
 func FingerprintMediaType(r io.Reader) (string, error) {
 	dec := json.NewDecoder(r)
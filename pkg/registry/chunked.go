@@ -0,0 +1,269 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/spegel-org/spegel/pkg/httpx"
+	"github.com/spegel-org/spegel/pkg/oci"
+	"github.com/spegel-org/spegel/pkg/routing"
+)
+
+const chunkFetchAttempts = 3
+
+// chunkRange returns the range of the response which should be fetched in chunks.
+// Only blobs fetched from peers which are larger than a single chunk are chunked.
+func (r *Registry) chunkRange(dist oci.DistributionPath, res fetchResponse) (httpx.ContentRange, bool) {
+	if r.chunkSize <= 0 || dist.Method != http.MethodGet || dist.Kind != oci.DistributionKindBlob || res.peer.Host == "" || res.desc.Size <= 0 {
+		return httpx.ContentRange{}, false
+	}
+	crng := httpx.ContentRange{
+		Start: 0,
+		End:   res.desc.Size - 1,
+		Size:  res.desc.Size,
+	}
+	if dist.Range != nil {
+		var err error
+		crng, err = httpx.ContentRangeFromRange(*dist.Range, res.desc.Size)
+		if err != nil {
+			return httpx.ContentRange{}, false
+		}
+	}
+	if crng.Length() <= r.chunkSize {
+		return httpx.ContentRange{}, false
+	}
+	return crng, true
+}
+
+// blobChunk is a byte range of a blob which is fetched independently of other chunks.
+type blobChunk struct {
+	done  chan any
+	err   error
+	data  []byte
+	peer  routing.Peer
+	start int64
+	end   int64
+}
+
+// chunkedReader reads a blob range by fetching chunks concurrently from multiple peers and returning them in order.
+// The first chunk is read from the response which started the fetch, the following chunks are fetched with range requests.
+// At most the configured concurrency of chunks are fetched or buffered at the same time.
+type chunkedReader struct {
+	ctx    context.Context
+	err    error
+	cancel context.CancelFunc
+	window chan any
+	chunks []*blobChunk
+	buf    []byte
+	wg     sync.WaitGroup
+	idx    int
+}
+
+func (r *Registry) newChunkedReader(ctx context.Context, iter *routing.Iterator, dist oci.DistributionPath, res fetchResponse, crng httpx.ContentRange) *chunkedReader {
+	ctx, cancel := context.WithCancel(ctx)
+	cr := &chunkedReader{
+		ctx:    ctx,
+		cancel: cancel,
+		window: make(chan any, r.chunkConcurrency),
+	}
+	for start := crng.Start; start <= crng.End; start += r.chunkSize {
+		chunk := &blobChunk{
+			done:  make(chan any),
+			start: start,
+			end:   min(start+r.chunkSize-1, crng.End),
+		}
+		cr.chunks = append(cr.chunks, chunk)
+	}
+
+	cr.wg.Add(1)
+	go func() {
+		defer cr.wg.Done()
+		for i, chunk := range cr.chunks {
+			select {
+			case <-ctx.Done():
+				if i == 0 {
+					//nolint: errcheck // Nothing to do if close fails.
+					res.rc.Close()
+				}
+				return
+			case cr.window <- nil:
+			}
+			cr.wg.Go(func() {
+				defer close(chunk.done)
+				if i == 0 {
+					chunk.data, chunk.err = readChunk(res, chunk.start, chunk.end)
+					if chunk.err == nil {
+						chunk.peer = res.peer
+						return
+					}
+					logr.FromContextOrDiscard(ctx).Error(chunk.err, "reading first chunk failed", "peer", res.peer.Host)
+					iter.Remove(res.peer)
+				}
+				chunk.data, chunk.peer, chunk.err = r.fetchChunk(ctx, iter, dist, res.desc, chunk.start, chunk.end)
+			})
+		}
+	}()
+	return cr
+}
+
+func (cr *chunkedReader) Read(p []byte) (int, error) {
+	for len(cr.buf) == 0 {
+		if cr.err != nil {
+			return 0, cr.err
+		}
+		if cr.idx == len(cr.chunks) {
+			return 0, io.EOF
+		}
+		chunk := cr.chunks[cr.idx]
+		select {
+		case <-cr.ctx.Done():
+			cr.err = cr.ctx.Err()
+			continue
+		case <-chunk.done:
+		}
+		if chunk.err != nil {
+			cr.err = fmt.Errorf("could not fetch chunk %d-%d: %w", chunk.start, chunk.end, chunk.err)
+			continue
+		}
+		cr.buf = chunk.data
+		chunk.data = nil
+		cr.idx += 1
+		// Allow the next chunk to be fetched now that this chunk is no longer buffered.
+		<-cr.window
+	}
+	n := copy(p, cr.buf)
+	cr.buf = cr.buf[n:]
+	return n, nil
+}
+
+// Close stops all chunk fetches and waits for them to return.
+func (cr *chunkedReader) Close() error {
+	cr.cancel()
+	cr.wg.Wait()
+	return nil
+}
+
+// Source returns the peer which the chunk at the offset was read from and the offset the chunk ends at.
+func (cr *chunkedReader) Source(offset int64) (routing.Peer, int64) {
+	idx, _ := slices.BinarySearchFunc(cr.chunks, offset, func(chunk *blobChunk, offset int64) int {
+		switch {
+		case chunk.end < offset:
+			return -1
+		case chunk.start > offset:
+			return 1
+		default:
+			return 0
+		}
+	})
+	if idx == len(cr.chunks) {
+		return routing.Peer{}, offset
+	}
+	chunk := cr.chunks[idx]
+	return chunk.peer, chunk.end + 1
+}
+
+// readChunk reads the first chunk from the response and closes it.
+func readChunk(res fetchResponse, start, end int64) ([]byte, error) {
+	data := make([]byte, end-start+1)
+	_, err := io.ReadFull(res.rc, data)
+	return data, errors.Join(err, res.rc.Close())
+}
+
+// fetchChunk fetches the chunk with a range request, retrying with another peer if the fetch fails.
+// Failures are independent of the blob digest which is verified once all chunks have been read.
+func (r *Registry) fetchChunk(ctx context.Context, iter *routing.Iterator, dist oci.DistributionPath, desc ocispec.Descriptor, start, end int64) ([]byte, routing.Peer, error) {
+	log := logr.FromContextOrDiscard(ctx)
+
+	chunkDist := dist.Clone()
+	chunkDist.Range = &httpx.Range{
+		Start: new(start),
+		End:   new(end),
+	}
+	errs := []error{}
+	for range chunkFetchAttempts {
+		peer, err := r.acquireChunkPeer(ctx, iter)
+		if err != nil {
+			errs = append(errs, err)
+			return nil, routing.Peer{}, errors.Join(errs...)
+		}
+		data, latency, err := r.fetchChunkFromPeer(ctx, peer, chunkDist, desc)
+		if err == nil {
+			iter.Release(peer)
+			r.recordPeerSuccess(peer, latency)
+			return data, peer, nil
+		}
+		if ctx.Err() != nil {
+			iter.Release(peer)
+			return nil, routing.Peer{}, ctx.Err()
+		}
+		log.Error(err, "chunk fetch from peer failed", "peer", peer.Host, "start", start, "end", end)
+		iter.Remove(peer)
+		r.recordPeerFailure(peer, err)
+		errs = append(errs, err)
+	}
+	return nil, routing.Peer{}, errors.Join(errs...)
+}
+
+// fetchChunkFromPeer fetches the chunk from the peer, returning the duration until the peer responded.
+func (r *Registry) fetchChunkFromPeer(ctx context.Context, peer routing.Peer, dist oci.DistributionPath, desc ocispec.Descriptor) ([]byte, time.Duration, error) {
+	start := time.Now()
+	res, err := r.peerFetch(ctx, peer, dist)
+	if err != nil {
+		return nil, 0, err
+	}
+	latency := time.Since(start)
+	if res.desc.Digest != desc.Digest || res.desc.Size != desc.Size {
+		return nil, 0, errors.Join(fmt.Errorf("chunk descriptor %s with size %d does not match %s with size %d", res.desc.Digest, res.desc.Size, desc.Digest, desc.Size), res.rc.Close())
+	}
+	data, err := readChunk(res, *dist.Range.Start, *dist.Range.End)
+	if err != nil {
+		return nil, 0, err
+	}
+	return data, latency, nil
+}
+
+// acquireChunkPeer waits for a peer which is not quarantined and has allowed addresses.
+func (r *Registry) acquireChunkPeer(ctx context.Context, iter *routing.Iterator) (routing.Peer, error) {
+	log := logr.FromContextOrDiscard(ctx)
+
+	for {
+		peer, ok := iter.Acquire()
+		if ok {
+			if r.isQuarantined(peer) {
+				iter.Remove(peer)
+				continue
+			}
+			allowedPeer, ok := r.allowedPeer(peer)
+			if !ok {
+				log.Info("skipping peer with no allowed addresses", "peer", peer.Host, "addresses", peer.Addresses)
+				iter.Remove(peer)
+				continue
+			}
+			return allowedPeer, nil
+		}
+
+		// Peers which are acquired by other chunks will be released, an empty iterator may never be updated.
+		var idleTimeoutCh <-chan time.Time
+		if iter.Count() == 0 {
+			idleTimeoutCh = time.After(r.resolveTimeout)
+		}
+		select {
+		case <-ctx.Done():
+			return routing.Peer{}, ctx.Err()
+		case <-iter.Exhausted():
+			return routing.Peer{}, errors.New("no peers left to fetch chunk from")
+		case <-idleTimeoutCh:
+			return routing.Peer{}, errors.New("waited too long for peer to fetch chunk from")
+		case <-iter.Ready():
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package registry
+
+import (
+	"context"
+	"io"
+	"maps"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	"github.com/spegel-org/spegel/pkg/metrics"
+)
+
+const (
+	egressMinBurst   = 32 * 1024
+	egressMaxClients = 1024
+)
+
+// egressShaper limits the bandwidth and concurrency of content served to peers.
+// Bandwidth is shaped with token buckets, both for all clients and for each individual client.
+type egressShaper struct {
+	global      *rate.Limiter
+	clients     map[string]*rate.Limiter
+	uploads     chan any
+	clientLimit int64
+	mx          sync.Mutex
+}
+
+// newEgressShaper creates a shaper with limits in bytes per second, a limit of zero disables it.
+// Nil is returned when all limits are disabled.
+func newEgressShaper(rateLimit, clientRateLimit int64, maxUploads int) *egressShaper {
+	if rateLimit <= 0 && clientRateLimit <= 0 && maxUploads <= 0 {
+		return nil
+	}
+	s := &egressShaper{
+		clientLimit: clientRateLimit,
+	}
+	if rateLimit > 0 {
+		s.global = newEgressLimiter(rateLimit)
+	}
+	if clientRateLimit > 0 {
+		s.clients = map[string]*rate.Limiter{}
+	}
+	if maxUploads > 0 {
+		s.uploads = make(chan any, maxUploads)
+	}
+	return s
+}
+
+func newEgressLimiter(bytesPerSecond int64) *rate.Limiter {
+	return rate.NewLimiter(rate.Limit(bytesPerSecond), max(int(bytesPerSecond), egressMinBurst))
+}
+
+// Acquire reserves an upload slot, returning false if all slots are in use.
+// The returned function releases the slot and has to be called when the upload is done.
+func (s *egressShaper) Acquire() (func(), bool) {
+	if s.uploads == nil {
+		return func() {}, true
+	}
+	select {
+	case s.uploads <- nil:
+		return func() { <-s.uploads }, true
+	default:
+		metrics.EgressRejectedUploadsTotal.Inc()
+		return nil, false
+	}
+}
+
+// Writer returns a writer which is shaped by the global limit and the limit of the client.
+func (s *egressShaper) Writer(ctx context.Context, w io.Writer, client string) io.Writer {
+	limiters := map[string]*rate.Limiter{}
+	if s.global != nil {
+		limiters["global"] = s.global
+	}
+	if s.clients != nil {
+		limiters["client"] = s.clientLimiter(client)
+	}
+	if len(limiters) == 0 {
+		return w
+	}
+	return &shapedWriter{
+		ctx:      ctx,
+		w:        w,
+		limiters: limiters,
+	}
+}
+
+func (s *egressShaper) clientLimiter(client string) *rate.Limiter {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	limiter, ok := s.clients[client]
+	if ok {
+		return limiter
+	}
+	// Limiters with a full bucket behave like new limiters and can be removed.
+	if len(s.clients) >= egressMaxClients {
+		now := time.Now()
+		maps.DeleteFunc(s.clients, func(_ string, limiter *rate.Limiter) bool {
+			return limiter.TokensAt(now) >= float64(limiter.Burst())
+		})
+	}
+	limiter = newEgressLimiter(s.clientLimit)
+	s.clients[client] = limiter
+	return limiter
+}
+
+// shapedWriter waits for tokens from all limiters before writing.
+type shapedWriter struct {
+	ctx      context.Context
+	w        io.Writer
+	limiters map[string]*rate.Limiter
+}
+
+func (sw *shapedWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		n := len(p)
+		for _, limiter := range sw.limiters {
+			n = min(n, limiter.Burst())
+		}
+		err := sw.wait(n)
+		if err != nil {
+			return written, err
+		}
+		m, err := sw.w.Write(p[:n])
+		written += m
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
+
+// wait blocks until all limiters allow n bytes, recording the bytes which had to be delayed.
+func (sw *shapedWriter) wait(n int) error {
+	now := time.Now()
+	delay := time.Duration(0)
+	reservations := []*rate.Reservation{}
+	for name, limiter := range sw.limiters {
+		reservation := limiter.ReserveN(now, n)
+		reservations = append(reservations, reservation)
+		limiterDelay := reservation.DelayFrom(now)
+		if limiterDelay > 0 {
+			metrics.EgressThrottledBytesTotal.WithLabelValues(name).Add(float64(n))
+		}
+		delay = max(delay, limiterDelay)
+	}
+	if delay == 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-sw.ctx.Done():
+		for _, reservation := range reservations {
+			reservation.Cancel()
+		}
+		return sw.ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
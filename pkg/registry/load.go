@@ -0,0 +1,94 @@
+package registry
+
+import (
+	"io"
+	"sync"
+	"time"
+
+	"github.com/spegel-org/spegel/pkg/routing"
+)
+
+const (
+	HeaderSpegelLoad = "X-Spegel-Load"
+	loadRateWindow   = time.Second
+)
+
+// loadMeter measures the load of serving content to peers.
+// The egress rate is measured over fixed windows and reported for the last completed window.
+type loadMeter struct {
+	windowStart time.Time
+	windowBytes int64
+	rate        int64
+	uploads     int
+	mx          sync.Mutex
+}
+
+func newLoadMeter() *loadMeter {
+	return &loadMeter{
+		windowStart: time.Now(),
+	}
+}
+
+// Start counts an upload as active until the returned function is called.
+func (m *loadMeter) Start() func() {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	m.uploads += 1
+	return func() {
+		m.mx.Lock()
+		defer m.mx.Unlock()
+
+		m.uploads -= 1
+	}
+}
+
+// Add records bytes served to peers.
+func (m *loadMeter) Add(n int) {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	m.roll(time.Now())
+	m.windowBytes += int64(n)
+}
+
+// Load returns the current load.
+func (m *loadMeter) Load() routing.PeerLoad {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	m.roll(time.Now())
+	return routing.PeerLoad{
+		Uploads:    m.uploads,
+		EgressRate: m.rate,
+	}
+}
+
+// Writer returns a writer which records the bytes written.
+func (m *loadMeter) Writer(w io.Writer) io.Writer {
+	return &meteredWriter{
+		w:     w,
+		meter: m,
+	}
+}
+
+func (m *loadMeter) roll(now time.Time) {
+	elapsed := now.Sub(m.windowStart)
+	if elapsed < loadRateWindow {
+		return
+	}
+	m.rate = m.windowBytes * int64(time.Second) / int64(elapsed)
+	m.windowBytes = 0
+	m.windowStart = now
+}
+
+type meteredWriter struct {
+	w     io.Writer
+	meter *loadMeter
+}
+
+func (mw *meteredWriter) Write(p []byte) (int, error) {
+	n, err := mw.w.Write(p)
+	mw.meter.Add(n)
+	return n, err
+}
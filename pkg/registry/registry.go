@@ -1,20 +1,26 @@
 package registry
 
 import (
+	"bytes"
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"net/http/httptrace"
 	"net/netip"
 	"net/url"
 	"path"
 	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/go-logr/logr"
+	"github.com/opencontainers/go-digest"
 	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
 
 	"github.com/spegel-org/spegel/internal/option"
@@ -31,12 +37,38 @@ const (
 	RegistryAttrKey      = "registry"
 )
 
+// PeerIdentityFunc returns the identity of the peer which the TLS connection was made with.
+type PeerIdentityFunc func(cs tls.ConnectionState) (string, error)
+
+// PeerConnectedFunc returns true if the peer with the identity is connected to the router.
+type PeerConnectedFunc func(id string) bool
+
 type RegistryConfig struct {
-	OCIClient      *oci.Client
-	Userinfo       *url.Userinfo
-	Filters        []oci.Filter
-	ResolveTimeout time.Duration
-	ResolveRetries int
+	OCIClient            *oci.Client
+	PeerTLSConfig        *tls.Config
+	PeerIdentity         PeerIdentityFunc
+	PeerConnected        PeerConnectedFunc
+	Userinfo             *url.Userinfo
+	DefaultRegistry      string
+	PeerID               string
+	Filters              []oci.Filter
+	ResolveTimeout       time.Duration
+	ClaimTimeout         time.Duration
+	ResolveRetries       int
+	RegistryPathPrefix   bool
+	MirrorCache          bool
+	UpstreamFallback     bool
+	UpstreamCoordination bool
+	IngestStreaming      bool
+	PeerQuarantine       time.Duration
+	PeerAllowlist        *routing.Allowlist
+	PeerLoadTracker      *routing.LoadTracker
+	PeerScoreboard       *routing.Scoreboard
+	EgressRateLimit      int64
+	ClientEgressLimit    int64
+	MaxUploads           int
+	ChunkSize            int64
+	ChunkConcurrency     int
 }
 
 type RegistryOption = option.Option[RegistryConfig]
@@ -69,6 +101,175 @@ func WithOCIClient(ociClient *oci.Client) RegistryOption {
 	}
 }
 
+// WithMirrorCache enables writing mirrored content to the OCI store.
+// The OCI store has to implement the writable store interface.
+func WithMirrorCache(enabled bool) RegistryOption {
+	return func(cfg *RegistryConfig) error {
+		cfg.MirrorCache = enabled
+		return nil
+	}
+}
+
+// WithUpstreamFallback enables fetching content from the upstream registry when no peer can serve it.
+func WithUpstreamFallback(enabled bool) RegistryOption {
+	return func(cfg *RegistryConfig) error {
+		cfg.UpstreamFallback = enabled
+		return nil
+	}
+}
+
+// WithUpstreamCoordination enables coordination of upstream fetches between peers.
+// The first peer to fetch content from upstream claims it, other peers will fetch the content from that peer.
+// Requires both mirror cache and upstream fallback to be enabled.
+func WithUpstreamCoordination(enabled bool) RegistryOption {
+	return func(cfg *RegistryConfig) error {
+		cfg.UpstreamCoordination = enabled
+		return nil
+	}
+}
+
+// WithUpstreamClaimTimeout sets the max duration spent waiting for a peer which has claimed an upstream fetch.
+// This bounds both discovering the claiming peer and waiting for it to complete the fetch, after which content is fetched from upstream.
+func WithUpstreamClaimTimeout(timeout time.Duration) RegistryOption {
+	return func(cfg *RegistryConfig) error {
+		cfg.ClaimTimeout = timeout
+		return nil
+	}
+}
+
+// WithPeerID sets the identifier other peers know this node by.
+// It is used to decide which peer fetches from upstream when multiple peers claim the same content at the same time.
+func WithPeerID(id string) RegistryOption {
+	return func(cfg *RegistryConfig) error {
+		cfg.PeerID = id
+		return nil
+	}
+}
+
+// WithIngestStreaming enables advertising and serving content while it is being written to the mirror cache.
+// Content pulled by the container runtime is advertised separately by tracking the ingests of the store.
+// Peers can stream content from this node before it has been completely received.
+// Requires mirror cache to be enabled and the OCI store to implement the ingest store interface.
+func WithIngestStreaming(enabled bool) RegistryOption {
+	return func(cfg *RegistryConfig) error {
+		cfg.IngestStreaming = enabled
+		return nil
+	}
+}
+
+// WithPeerQuarantine sets how long peers which served content not matching its digest are excluded from fetches.
+// A duration of zero disables quarantine, content is still verified.
+func WithPeerQuarantine(peerQuarantine time.Duration) RegistryOption {
+	return func(cfg *RegistryConfig) error {
+		cfg.PeerQuarantine = peerQuarantine
+		return nil
+	}
+}
+
+// WithPeerAllowlist restricts fetches to peer addresses which are in the allowlist.
+func WithPeerAllowlist(allowlist *routing.Allowlist) RegistryOption {
+	return func(cfg *RegistryConfig) error {
+		cfg.PeerAllowlist = allowlist
+		return nil
+	}
+}
+
+// WithPeerLoadTracker records the load reported by peers when fetching from them.
+func WithPeerLoadTracker(tracker *routing.LoadTracker) RegistryOption {
+	return func(cfg *RegistryConfig) error {
+		cfg.PeerLoadTracker = tracker
+		return nil
+	}
+}
+
+// WithPeerScoreboard records the results of fetching from peers in the scoreboard.
+func WithPeerScoreboard(scoreboard *routing.Scoreboard) RegistryOption {
+	return func(cfg *RegistryConfig) error {
+		cfg.PeerScoreboard = scoreboard
+		return nil
+	}
+}
+
+// WithEgressRateLimit limits the bytes per second served to all peers combined.
+// A limit of zero disables the limit.
+func WithEgressRateLimit(bytesPerSecond int64) RegistryOption {
+	return func(cfg *RegistryConfig) error {
+		cfg.EgressRateLimit = bytesPerSecond
+		return nil
+	}
+}
+
+// WithClientEgressRateLimit limits the bytes per second served to each individual peer.
+// A limit of zero disables the limit.
+func WithClientEgressRateLimit(bytesPerSecond int64) RegistryOption {
+	return func(cfg *RegistryConfig) error {
+		cfg.ClientEgressLimit = bytesPerSecond
+		return nil
+	}
+}
+
+// WithMaxConcurrentUploads limits the amount of blobs served to peers at the same time.
+// Requests above the limit are rejected so that the peer fetches from another peer.
+// A limit of zero disables the limit.
+func WithMaxConcurrentUploads(maxUploads int) RegistryOption {
+	return func(cfg *RegistryConfig) error {
+		cfg.MaxUploads = maxUploads
+		return nil
+	}
+}
+
+// WithChunkedFetch fetches blobs larger than the chunk size as byte ranges from multiple peers concurrently.
+// At most concurrency chunks are fetched or buffered at the same time for a single blob.
+// A chunk size of zero disables chunked fetching.
+func WithChunkedFetch(chunkSize int64, concurrency int) RegistryOption {
+	return func(cfg *RegistryConfig) error {
+		cfg.ChunkSize = chunkSize
+		cfg.ChunkConcurrency = concurrency
+		return nil
+	}
+}
+
+// WithPeerTLS enables mutual TLS for requests between peers.
+// Content is fetched from peers over TLS with the given client configuration, which should present a client certificate.
+// Mirrored requests from peers are rejected unless they are made over TLS with a verified client certificate.
+func WithPeerTLS(tlsConfig *tls.Config) RegistryOption {
+	return func(cfg *RegistryConfig) error {
+		cfg.PeerTLSConfig = tlsConfig
+		return nil
+	}
+}
+
+// WithPeerIdentity enables verification of the peer identity when fetching from peers.
+// The identity of the TLS connection has to match the host of the peer returned by the router.
+// Mirrored requests from peers are authenticated with the identity instead of a verified certificate chain,
+// the identity has to belong to a peer connected to the router as anyone can create a certificate with an identity.
+// Requires peer TLS and connected peers to be set.
+func WithPeerIdentity(peerIdentity PeerIdentityFunc, peerConnected PeerConnectedFunc) RegistryOption {
+	return func(cfg *RegistryConfig) error {
+		cfg.PeerIdentity = peerIdentity
+		cfg.PeerConnected = peerConnected
+		return nil
+	}
+}
+
+// WithDefaultRegistry sets the registry of requests which do not set the ns parameter.
+// Container runtimes which only mirror a single registry, like Docker Engine, do not set the parameter.
+func WithDefaultRegistry(registry string) RegistryOption {
+	return func(cfg *RegistryConfig) error {
+		cfg.DefaultRegistry = registry
+		return nil
+	}
+}
+
+// WithRegistryPathPrefix sets if requests which do not set the ns parameter have the registry as the first repository path component.
+// Container runtimes which cannot set the parameter, like CRI-O, prefix the mirror location with the registry instead.
+func WithRegistryPathPrefix(enabled bool) RegistryOption {
+	return func(cfg *RegistryConfig) error {
+		cfg.RegistryPathPrefix = enabled
+		return nil
+	}
+}
+
 func WithUserinfo(userinfo *url.Userinfo) RegistryOption {
 	return func(cfg *RegistryConfig) error {
 		cfg.Userinfo = userinfo
@@ -81,22 +282,46 @@ type Statistics struct {
 }
 
 type Registry struct {
-	bufferPool     *sync.Pool
-	hedger         *resilient.Hedger
-	ociStore       oci.Store
-	ociClient      *oci.Client
-	router         routing.Router
-	userinfo       *url.Userinfo
-	filters        []oci.Filter
-	resolveTimeout time.Duration
-	resolveRetries int
-	stats          Statistics
+	bufferPool           *sync.Pool
+	hedger               *resilient.Hedger
+	ociStore             oci.Store
+	cacheStore           oci.WritableStore
+	ingestStore          oci.IngestStore
+	ociClient            *oci.Client
+	peerClient           *oci.Client
+	peerIdentity         PeerIdentityFunc
+	peerConnected        PeerConnectedFunc
+	router               routing.Router
+	userinfo             *url.Userinfo
+	defaultRegistry      string
+	registryPathPrefix   bool
+	peerID               string
+	claims               sync.Map
+	quarantine           sync.Map
+	peerAllowlist        *routing.Allowlist
+	egressShaper         *egressShaper
+	loadMeter            *loadMeter
+	peerLoadTracker      *routing.LoadTracker
+	peerScoreboard       *routing.Scoreboard
+	filters              []oci.Filter
+	resolveTimeout       time.Duration
+	claimTimeout         time.Duration
+	peerQuarantine       time.Duration
+	chunkSize            int64
+	resolveRetries       int
+	chunkConcurrency     int
+	upstreamFallback     bool
+	upstreamCoordination bool
+	peerTLS              bool
+	stats                Statistics
 }
 
 func NewRegistry(ociStore oci.Store, router routing.Router, opts ...RegistryOption) (*Registry, error) {
 	cfg := RegistryConfig{
 		ResolveRetries: 3,
 		ResolveTimeout: 20 * time.Millisecond,
+		ClaimTimeout:   10 * time.Second,
+		PeerQuarantine: 5 * time.Minute,
 	}
 	err := option.Apply(&cfg, opts...)
 	if err != nil {
@@ -109,6 +334,46 @@ func NewRegistry(ociStore oci.Store, router routing.Router, opts ...RegistryOpti
 		}
 		cfg.OCIClient = ociClient
 	}
+	if cfg.ChunkSize > 0 && cfg.ChunkConcurrency <= 0 {
+		return nil, errors.New("chunked fetch requires a concurrency of at least one")
+	}
+	if cfg.PeerIdentity != nil && cfg.PeerTLSConfig == nil {
+		return nil, errors.New("peer identity requires peer TLS to be enabled")
+	}
+	if cfg.PeerIdentity != nil && cfg.PeerConnected == nil {
+		return nil, errors.New("peer identity requires connected peers to authenticate requests")
+	}
+	peerClient := cfg.OCIClient
+	if cfg.PeerTLSConfig != nil {
+		var err error
+		peerClient, err = oci.NewClient(oci.WithTLSConfig(cfg.PeerTLSConfig))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var cacheStore oci.WritableStore
+	if cfg.MirrorCache {
+		writableStore, ok := ociStore.(oci.WritableStore)
+		if !ok {
+			return nil, errors.New("mirror cache requires a writable OCI store")
+		}
+		cacheStore = writableStore
+	}
+	if cfg.UpstreamCoordination && (!cfg.MirrorCache || !cfg.UpstreamFallback) {
+		return nil, errors.New("upstream coordination requires mirror cache and upstream fallback to be enabled")
+	}
+	var ingestStore oci.IngestStore
+	if cfg.IngestStreaming {
+		if !cfg.MirrorCache {
+			return nil, errors.New("ingest streaming requires mirror cache to be enabled")
+		}
+		ingestOCIStore, ok := ociStore.(oci.IngestStore)
+		if !ok {
+			return nil, errors.New("ingest streaming requires an OCI store which can serve ingested content")
+		}
+		ingestStore = ingestOCIStore
+	}
 
 	bufferPool := &sync.Pool{
 		New: func() any {
@@ -118,16 +383,36 @@ func NewRegistry(ociStore oci.Store, router routing.Router, opts ...RegistryOpti
 	}
 
 	r := &Registry{
-		ociStore:       ociStore,
-		router:         router,
-		ociClient:      cfg.OCIClient,
-		resolveRetries: cfg.ResolveRetries,
-		filters:        cfg.Filters,
-		resolveTimeout: cfg.ResolveTimeout,
-		userinfo:       cfg.Userinfo,
-		bufferPool:     bufferPool,
-		stats:          Statistics{},
-		hedger:         resilient.NewHedger([]float64{80, 85, 90}, 50*time.Millisecond),
+		ociStore:             ociStore,
+		cacheStore:           cacheStore,
+		ingestStore:          ingestStore,
+		router:               router,
+		ociClient:            cfg.OCIClient,
+		peerClient:           peerClient,
+		peerIdentity:         cfg.PeerIdentity,
+		peerConnected:        cfg.PeerConnected,
+		resolveRetries:       cfg.ResolveRetries,
+		filters:              cfg.Filters,
+		resolveTimeout:       cfg.ResolveTimeout,
+		claimTimeout:         cfg.ClaimTimeout,
+		peerQuarantine:       cfg.PeerQuarantine,
+		peerAllowlist:        cfg.PeerAllowlist,
+		egressShaper:         newEgressShaper(cfg.EgressRateLimit, cfg.ClientEgressLimit, cfg.MaxUploads),
+		loadMeter:            newLoadMeter(),
+		peerLoadTracker:      cfg.PeerLoadTracker,
+		peerScoreboard:       cfg.PeerScoreboard,
+		chunkSize:            cfg.ChunkSize,
+		chunkConcurrency:     cfg.ChunkConcurrency,
+		userinfo:             cfg.Userinfo,
+		defaultRegistry:      cfg.DefaultRegistry,
+		registryPathPrefix:   cfg.RegistryPathPrefix,
+		peerID:               cfg.PeerID,
+		upstreamFallback:     cfg.UpstreamFallback,
+		upstreamCoordination: cfg.UpstreamCoordination,
+		peerTLS:              cfg.PeerTLSConfig != nil,
+		bufferPool:           bufferPool,
+		stats:                Statistics{},
+		hedger:               resilient.NewHedger([]float64{80, 85, 90}, 50*time.Millisecond),
 	}
 	return r, nil
 }
@@ -176,6 +461,16 @@ func (r *Registry) registryHandler(rw httpx.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	// All requests which are not from the local host have to present a verified client certificate when mutual TLS is enabled.
+	if r.peerTLS && !isLoopback(req) {
+		err := r.authenticatePeer(req)
+		if err != nil {
+			respErr := oci.NewDistributionError(oci.ErrCodeUnauthorized, "requests which are not local require a verified client certificate", nil)
+			rw.WriteError(http.StatusUnauthorized, errors.Join(respErr, err))
+			return
+		}
+	}
+
 	// Quickly return 200 for /v2 to indicate that registry supports v2.
 	if path.Clean(req.URL.Path) == "/v2" {
 		rw.SetAttrs(HandlerAttrKey, "v2")
@@ -183,6 +478,27 @@ func (r *Registry) registryHandler(rw httpx.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	// Requests without a registry have the registry prefixed to the repository.
+	if r.registryPathPrefix && !req.URL.Query().Has("ns") {
+		registry, repoPath, ok := strings.Cut(strings.TrimPrefix(req.URL.Path, "/v2/"), "/")
+		if ok {
+			req = req.Clone(req.Context())
+			query := req.URL.Query()
+			query.Set("ns", registry)
+			req.URL.RawQuery = query.Encode()
+			req.URL.Path = "/v2/" + repoPath
+			req.URL.RawPath = ""
+		}
+	}
+
+	// Requests without a registry are for the default registry.
+	if r.defaultRegistry != "" && !req.URL.Query().Has("ns") {
+		req = req.Clone(req.Context())
+		query := req.URL.Query()
+		query.Set("ns", r.defaultRegistry)
+		req.URL.RawQuery = query.Encode()
+	}
+
 	// Parse out path components from request.
 	dist, err := oci.ParseDistributionPath(req)
 	if err != nil {
@@ -199,6 +515,10 @@ func (r *Registry) registryHandler(rw httpx.ResponseWriter, req *http.Request) {
 	}
 
 	// Request with mirror header are proxied.
+	if req.Header.Get(HeaderSpegelMirrored) == "true" && dist.Digest != "" {
+		// Wait for claimed upstream fetches to complete before serving the content.
+		r.waitForClaim(req.Context(), dist.Digest)
+	}
 	if req.Header.Get(HeaderSpegelMirrored) != "true" {
 		// If content is present locally we should skip the mirroring and just serve it.
 		var ociErr error
@@ -213,13 +533,23 @@ func (r *Registry) registryHandler(rw httpx.ResponseWriter, req *http.Request) {
 		}
 	}
 
+	// Peers are informed of the current load so that they can prefer less loaded peers.
+	if req.Header.Get(HeaderSpegelMirrored) == "true" {
+		rw.Header().Set(HeaderSpegelLoad, r.loadMeter.Load().String())
+	}
+
 	// Serve registry endpoints.
 	switch dist.Kind {
 	case oci.DistributionKindManifest:
 		r.manifestHandler(req.Context(), dist, rw)
 		return
 	case oci.DistributionKindBlob:
-		r.blobHandler(req.Context(), dist, rw)
+		// Peer traffic is identified by the remote address as the mirror header is controlled by the client.
+		client := ""
+		if !isLoopback(req) {
+			client = clientHost(req)
+		}
+		r.blobHandler(req.Context(), dist, rw, client)
 		return
 	default:
 		// This should never happen as it would be caught when parsing the path.
@@ -228,22 +558,68 @@ func (r *Registry) registryHandler(rw httpx.ResponseWriter, req *http.Request) {
 	}
 }
 
+// clientHost returns the host of the remote address of the request.
+func clientHost(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
+
+// isLoopback returns true if the request was made from a loopback address.
+func isLoopback(req *http.Request) bool {
+	addrPort, err := netip.ParseAddrPort(req.RemoteAddr)
+	if err != nil {
+		return false
+	}
+	return addrPort.Addr().Unmap().IsLoopback()
+}
+
+// authenticatePeer verifies the client certificate of a request.
+func (r *Registry) authenticatePeer(req *http.Request) error {
+	if req.TLS == nil {
+		return errors.New("request was not made over TLS")
+	}
+	if r.peerIdentity != nil {
+		identity, err := r.peerIdentity(*req.TLS)
+		if err != nil {
+			return err
+		}
+		if !r.peerConnected(identity) {
+			return fmt.Errorf("peer %s is not connected to the router", identity)
+		}
+		return nil
+	}
+	if len(req.TLS.VerifiedChains) == 0 {
+		return errors.New("client certificate has not been verified")
+	}
+	return nil
+}
+
 func (r *Registry) mirrorHandler(ctx context.Context, dist oci.DistributionPath, rw httpx.ResponseWriter) {
 	rw.SetAttrs(HandlerAttrKey, "mirror")
 
 	log := logr.FromContextOrDiscard(ctx).WithValues("ref", dist.Identifier(), "path", dist.URL().Path)
 	ctx = logr.NewContext(ctx, log)
 
+	upstream := false
 	defer func() {
-		if rw.Error() == nil {
+		switch {
+		case rw.Error() != nil:
+			metrics.MirrorRequestsTotal.WithLabelValues(dist.Registry, "miss").Inc()
+		case upstream:
+			metrics.MirrorRequestsTotal.WithLabelValues(dist.Registry, "upstream").Inc()
+		default:
 			metrics.MirrorRequestsTotal.WithLabelValues(dist.Registry, "hit").Inc()
 			metrics.MirrorLastSuccessTimestamp.SetToCurrentTime()
 			r.stats.MirrorLastSuccess.Store(time.Now().Unix())
-		} else {
-			metrics.MirrorRequestsTotal.WithLabelValues(dist.Registry, "miss").Inc()
 		}
 	}()
 
+	// Upstream fetches should not be limited by the peer timeout.
+	upstreamCtx := ctx
+
 	// Set max duration for non blob requests.
 	if dist.Method == http.MethodHead || dist.Kind == oci.DistributionKindManifest {
 		var cancel context.CancelFunc
@@ -258,16 +634,94 @@ func (r *Registry) mirrorHandler(ctx context.Context, dist oci.DistributionPath,
 		return
 	}
 
+	// Only complete content can be written to the cache.
+	cacheable := r.cacheStore != nil && dist.Method == http.MethodGet && dist.Range == nil
+	var cw *cacheWriter
+	defer func() {
+		if cw == nil {
+			return
+		}
+		err := cw.Close()
+		if err != nil {
+			log.Error(err, "could not close cache writer")
+		}
+		if cw.advertised && !cw.committed {
+			r.withdrawIngest(ctx, cw.desc.Digest)
+		}
+	}()
+
+	// Complete blobs are verified while they are streamed, content from all attempts is written through the same verifier.
+	// After a digest mismatch the content is fetched again and compared with what was read before to find the wrong source.
+	verify := dist.Method == http.MethodGet && dist.Kind == oci.DistributionKindBlob && dist.Range == nil
+	var verifier *digestVerifier
+	singleSource := false
+
 	// Retry requests until success or timeout.
 	for {
 		done := func() bool {
 			res, err := r.raceFetch(ctx, iter, dist)
+			if err != nil && r.upstreamFallback {
+				log.Info("falling back to upstream registry", "reason", err.Error())
+				var upstreamErr error
+				var release func()
+				res, release, upstreamErr = r.upstreamFetch(upstreamCtx, dist, cacheable && cw == nil)
+				if upstreamErr != nil {
+					err = errors.Join(err, upstreamErr)
+				} else {
+					// Claims are released after the content has been committed to the cache.
+					defer release()
+					err = nil
+					upstream = res.peer.Host == ""
+					rw.SetAttrs("upstream", upstream)
+				}
+			}
 			if err != nil {
 				rw.WriteError(http.StatusNotFound, err)
 				return true
 			}
 			defer httpx.DrainAndClose(res.rc)
 
+			// Manifests are verified before any data is written to the response.
+			if dist.Method == http.MethodGet && dist.Kind == oci.DistributionKindManifest {
+				b, err := readManifest(res, dist.Digest)
+				if err != nil {
+					if res.peer.Host == "" {
+						respErr := oci.NewDistributionError(oci.ErrCodeManifestUnknown, fmt.Sprintf("could not get manifest %s", dist.Identifier()), nil)
+						rw.WriteError(http.StatusNotFound, errors.Join(respErr, err))
+						return true
+					}
+					log.Error(err, "manifest from peer is invalid", "peer", res.peer.Host)
+					if errors.Is(err, errDigestMismatch) {
+						r.quarantinePeer(ctx, res.peer)
+					}
+					iter.Remove(res.peer)
+					return false
+				}
+				res.rc = io.NopCloser(bytes.NewReader(b))
+			}
+
+			if cacheable && cw == nil {
+				ref := dist.Reference
+				ref.Tag = ""
+				ref.Digest = res.desc.Digest
+				contentWriter, err := r.cacheStore.Writer(ctx, ref, res.desc)
+				if err != nil {
+					log.Error(err, "could not create cache writer")
+					cacheable = false
+				} else {
+					cw = &cacheWriter{ContentWriter: contentWriter, desc: res.desc}
+					// Advertise blobs while they are written so that peers can stream them.
+					if r.ingestStore != nil && dist.Kind == oci.DistributionKindBlob {
+						err := r.router.Advertise(ctx, []string{res.desc.Digest.String()})
+						if err != nil {
+							log.Error(err, "could not advertise ingested content")
+						} else {
+							cw.advertised = true
+						}
+					}
+				}
+			}
+
 			if !rw.HeadersWritten() {
 				oci.WriteDescriptorToHeader(res.desc, rw.Header())
 
@@ -295,11 +749,78 @@ func (r *Registry) mirrorHandler(ctx context.Context, dist oci.DistributionPath,
 				return true
 			}
 
+			// Large blobs are fetched in chunks from multiple peers, starting with the response from the first peer.
+			var cr *chunkedReader
+			source := func(int64) (routing.Peer, int64) {
+				return res.peer, res.desc.Size
+			}
+			if crng, ok := r.chunkRange(dist, res); ok && !singleSource {
+				cr = r.newChunkedReader(ctx, iter, dist, res, crng)
+				defer cr.Close()
+				res.rc = cr
+				source = cr.Source
+			}
+
 			// Copy the data to the response writer.
 			//nolint: errcheck // Ignore
 			buf := r.bufferPool.Get().(*[]byte)
 			defer r.bufferPool.Put(buf)
-			n, err := io.CopyBuffer(rw, res.rc, *buf)
+			var dst io.Writer = rw
+			if cw != nil {
+				dst = cw.Tee(rw)
+			}
+			if verify {
+				if verifier == nil {
+					verifier = newDigestVerifier(dist.Digest, res.desc.Size)
+				}
+				dst = verifier.Writer(dst, source)
+			}
+			n, err := io.CopyBuffer(dst, res.rc, *buf)
+			if res.peer.Host != "" {
+				locality := res.peer.Metadata.Locality
+				if locality == "" {
+					locality = routing.LocalityUnknown
+				}
+				metrics.MirrorPeerReceivedBytesTotal.WithLabelValues(string(locality)).Add(float64(n))
+			}
+			if err == nil && verifier != nil {
+				err = verifier.Verify()
+				// Sources of previous attempts are only known to be wrong once other content has been verified.
+				for _, peer := range verifier.Mismatched() {
+					r.quarantinePeer(ctx, peer)
+					iter.Remove(peer)
+				}
+			}
+			if errors.Is(err, errSentContentMismatch) {
+				log.Error(err, "aborting mirrored blob response")
+				return true
+			}
+			if errors.Is(err, errDigestMismatch) {
+				sources := verifier.Sources()
+				if len(sources) == 1 {
+					if sources[0].Host == "" {
+						log.Error(err, "aborting mirrored blob response")
+						return true
+					}
+					// Content read from a single peer which does not match the digest is known to be wrong.
+					r.quarantinePeer(ctx, sources[0])
+					iter.Remove(sources[0])
+				} else {
+					// The next attempt is read from a single peer so that the wrong content can be attributed.
+					singleSource = true
+				}
+				log.Error(err, "retrying mirrored blob from another peer", "sources", len(sources))
+				verifier = verifier.Retry()
+				dist = dist.Clone()
+				dist.Range = nil
+				return false
+			}
+			if err == nil && cw != nil {
+				err := cw.Commit(ctx)
+				if err != nil {
+					log.Error(err, "could not commit mirrored content to cache")
+				}
+			}
 			if err != nil {
 				switch dist.Kind {
 				case oci.DistributionKindManifest:
@@ -326,6 +847,60 @@ func (r *Registry) mirrorHandler(ctx context.Context, dist oci.DistributionPath,
 	}
 }
 
+// cacheWriter writes mirrored content to a content writer without affecting the response.
+// Writing to the cache stops after the first error.
+type cacheWriter struct {
+	oci.ContentWriter
+	err        error
+	desc       ocispec.Descriptor
+	advertised bool
+	committed  bool
+}
+
+// Tee returns a writer that writes to w and to the cache.
+func (c *cacheWriter) Tee(w io.Writer) io.Writer {
+	return writerFunc(func(p []byte) (int, error) {
+		n, err := w.Write(p)
+		if c.err == nil && n > 0 {
+			_, c.err = c.ContentWriter.Write(p[:n])
+		}
+		return n, err
+	})
+}
+
+// Commit commits the written content if no previous write has failed.
+func (c *cacheWriter) Commit(ctx context.Context) error {
+	if c.err != nil {
+		return c.err
+	}
+	err := c.ContentWriter.Commit(ctx)
+	if err != nil {
+		return err
+	}
+	c.committed = true
+	return nil
+}
+
+// withdrawIngest withdraws the advertisement of content which was never committed.
+// Content committed by other writers in the meantime is still advertised.
+func (r *Registry) withdrawIngest(ctx context.Context, dgst digest.Digest) {
+	ctx = context.WithoutCancel(ctx)
+	_, err := r.ociStore.Descriptor(ctx, dgst)
+	if err == nil {
+		return
+	}
+	err = r.router.Withdraw(ctx, []string{dgst.String()})
+	if err != nil {
+		logr.FromContextOrDiscard(ctx).Error(err, "could not withdraw ingested content")
+	}
+}
+
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) {
+	return f(p)
+}
+
 type mirrorErrorDetails struct {
 	Attempts int `json:"attempts"`
 }
@@ -352,7 +927,15 @@ func (r *Registry) raceFetch(ctx context.Context, iterator *routing.Iterator, di
 		oci.DistributionKindManifest: oci.ErrCodeManifestUnknown,
 	}[dist.Kind]
 
-	fetchCh, immediateCh := fetchChannel(ctx, r.hedger, iterator)
+	// Hedges are timed by the latency of the peer the hedge will be sent to.
+	hedgeKey := func() resilient.HedgeKey {
+		key := resilient.HedgeKey{Kind: string(dist.Kind)}
+		if peer, ok := iterator.Next(); ok {
+			key.Peer = peer.Host
+		}
+		return key
+	}
+	fetchCh, immediateCh := fetchChannel(ctx, r.hedger, iterator, hedgeKey)
 	resCh := make(chan fetchResponse)
 	failureCh := make(chan fetchFailure)
 
@@ -375,7 +958,12 @@ func (r *Registry) raceFetch(ctx context.Context, iterator *routing.Iterator, di
 			exhaustedCh = iterator.Exhausted()
 		}
 		if len(fetchCtxs) > 0 && raceTimeoutCh == nil {
-			raceTimeoutCh = time.After(max(r.hedger.HighestPercentileDuration()*2, 100*time.Millisecond))
+			// Inflight fetches are given time based on the latency of the slowest peer being fetched from.
+			raceTimeout := time.Duration(0)
+			for host := range fetchCtxs {
+				raceTimeout = max(raceTimeout, r.hedger.HighestPercentileDuration(resilient.HedgeKey{Kind: string(dist.Kind), Peer: host}))
+			}
+			raceTimeoutCh = time.After(max(raceTimeout*2, 100*time.Millisecond))
 		}
 
 		select {
@@ -396,6 +984,18 @@ func (r *Registry) raceFetch(ctx context.Context, iterator *routing.Iterator, di
 				immediateCh <- false
 				continue
 			}
+			if r.isQuarantined(peer) {
+				iterator.Remove(peer)
+				immediateCh <- false
+				continue
+			}
+			peer, ok = r.allowedPeer(peer)
+			if !ok {
+				log.Info("skipping peer with no allowed addresses", "peer", peer.Host, "addresses", peer.Addresses)
+				iterator.Remove(peer)
+				immediateCh <- false
+				continue
+			}
 
 			errDetails.Attempts += 1
 
@@ -405,27 +1005,7 @@ func (r *Registry) raceFetch(ctx context.Context, iterator *routing.Iterator, di
 
 			go func() {
 				start := time.Now()
-				res, err := httpx.HappyEyeballs(fetchCtx, peer.Addresses, func(ctx context.Context, ipAddr netip.Addr) (fetchResponse, error) {
-					mirror := &url.URL{
-						Scheme: dist.Scheme,
-						Host:   netip.AddrPortFrom(ipAddr, peer.Metadata.RegistryPort).String(),
-					}
-					fetchOpts := []oci.FetchOption{
-						oci.WithFetchHeader(HeaderSpegelMirrored, "true"),
-						oci.WithFetchMirror(mirror),
-						oci.WithFetchUserinfo(r.userinfo),
-					}
-					rc, desc, err := r.ociClient.Fetch(ctx, dist, fetchOpts...)
-					if err != nil {
-						return fetchResponse{}, err
-					}
-					res := fetchResponse{
-						peer: peer,
-						desc: desc,
-						rc:   rc,
-					}
-					return res, nil
-				})
+				res, err := r.peerFetch(fetchCtx, peer, dist)
 				if err != nil {
 					if fetchCtx.Err() != nil {
 						iterator.Release(peer)
@@ -433,6 +1013,7 @@ func (r *Registry) raceFetch(ctx context.Context, iterator *routing.Iterator, di
 					}
 
 					iterator.Remove(peer)
+					r.recordPeerFailure(peer, err)
 
 					failure := fetchFailure{
 						peer: peer,
@@ -446,8 +1027,9 @@ func (r *Registry) raceFetch(ctx context.Context, iterator *routing.Iterator, di
 				}
 
 				iterator.Release(peer)
+				r.recordPeerSuccess(peer, time.Since(start))
 
-				err = r.hedger.Observe(time.Since(start))
+				err = r.hedger.Observe(resilient.HedgeKey{Kind: string(dist.Kind), Peer: peer.Host}, time.Since(start))
 				if err != nil {
 					log.Error(err, "could not observe fetch duration for hedger")
 				}
@@ -476,6 +1058,303 @@ func (r *Registry) raceFetch(ctx context.Context, iterator *routing.Iterator, di
 	}
 }
 
+// upstreamFetch fetches the content directly from the registry it originates from.
+// With upstream coordination enabled the content is fetched from a peer that has claimed the upstream fetch.
+// If no such peer exists and claim is true this node claims the upstream fetch before fetching from upstream.
+// Peers which claimed at the same time are discovered after claiming, the peer with the lowest ID fetches from upstream.
+// The returned function releases the claim and has to be called when the content has been written to the cache.
+func (r *Registry) upstreamFetch(ctx context.Context, dist oci.DistributionPath, claim bool) (fetchResponse, func(), error) {
+	log := logr.FromContextOrDiscard(ctx)
+
+	release := func() {}
+	if r.upstreamCoordination && dist.Digest != "" && dist.Method == http.MethodGet {
+		res, err := r.claimFetch(ctx, dist, func(peer routing.Peer) bool {
+			return peer.Host != r.peerID
+		})
+		if err == nil {
+			return res, release, nil
+		}
+		log.Info("could not fetch from claiming peer", "reason", err.Error())
+		if claim {
+			release, err = r.claim(ctx, dist.Digest)
+			if err != nil {
+				log.Error(err, "could not claim upstream fetch")
+				release = func() {}
+			} else if r.peerID != "" {
+				res, err := r.claimFetch(ctx, dist, func(peer routing.Peer) bool {
+					return peer.Host < r.peerID
+				})
+				if err == nil {
+					release()
+					return res, func() {}, nil
+				}
+			}
+		}
+	}
+
+	upstreamDist := dist.Clone()
+	upstreamDist.Scheme = "https"
+	rc, desc, err := r.ociClient.Fetch(ctx, upstreamDist)
+	if err != nil {
+		release()
+		return fetchResponse{}, func() {}, err
+	}
+	res := fetchResponse{
+		desc: desc,
+		rc:   rc,
+	}
+	return res, release, nil
+}
+
+// claimFetch fetches the content from a peer which has claimed the upstream fetch.
+// Only claiming peers accepted by the filter are fetched from.
+func (r *Registry) claimFetch(ctx context.Context, dist oci.DistributionPath, filter func(peer routing.Peer) bool) (fetchResponse, error) {
+	lookupCtx, lookupCancel := context.WithCancel(ctx)
+	defer lookupCancel()
+	iter, err := r.router.Lookup(lookupCtx, claimKey(dist.Digest), r.resolveRetries)
+	if err != nil {
+		return fetchResponse{}, err
+	}
+	timer := time.NewTimer(r.claimTimeout)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return fetchResponse{}, ctx.Err()
+		case <-iter.Exhausted():
+			return fetchResponse{}, errors.New("no peer has claimed the upstream fetch")
+		case <-timer.C:
+			return fetchResponse{}, errors.New("waited too long for a peer which has claimed the upstream fetch")
+		case <-iter.Ready():
+		}
+		peer, ok := iter.Acquire()
+		if !ok {
+			continue
+		}
+		if !filter(peer) {
+			iter.Remove(peer)
+			continue
+		}
+		if r.isQuarantined(peer) {
+			iter.Remove(peer)
+			continue
+		}
+		allowedPeer, ok := r.allowedPeer(peer)
+		if !ok {
+			iter.Remove(peer)
+			continue
+		}
+		res, err := r.peerFetch(ctx, allowedPeer, dist)
+		iter.Release(peer)
+		if err != nil {
+			return fetchResponse{}, fmt.Errorf("could not fetch from peer %s which has claimed the upstream fetch: %w", peer.Host, err)
+		}
+		return res, nil
+	}
+}
+
+// peerFetch fetches the content from the peer, racing the peer addresses.
+func (r *Registry) peerFetch(ctx context.Context, peer routing.Peer, dist oci.DistributionPath) (fetchResponse, error) {
+	scheme := dist.Scheme
+	if r.peerTLS {
+		scheme = "https"
+	}
+	return httpx.HappyEyeballs(ctx, peer.Addresses, func(ctx context.Context, ipAddr netip.Addr) (fetchResponse, error) {
+		mirror := &url.URL{
+			Scheme: scheme,
+			Host:   netip.AddrPortFrom(ipAddr, peer.Metadata.RegistryPort).String(),
+		}
+		fetchOpts := []oci.FetchOption{
+			oci.WithFetchHeader(HeaderSpegelMirrored, "true"),
+			oci.WithFetchMirror(mirror),
+			oci.WithFetchUserinfo(r.userinfo),
+		}
+		if r.peerLoadTracker != nil {
+			fetchOpts = append(fetchOpts, oci.WithFetchResponseHeader(func(header http.Header) {
+				load, err := routing.ParsePeerLoad(header.Get(HeaderSpegelLoad))
+				if err != nil {
+					return
+				}
+				r.peerLoadTracker.Update(peer.Host, load)
+			}))
+		}
+		// Connections are reused between requests so the identity is verified for every request.
+		var identityErr error
+		if r.peerIdentity != nil {
+			identityErr = errPeerIdentityUnverified
+			trace := &httptrace.ClientTrace{
+				GotConn: func(info httptrace.GotConnInfo) {
+					// The first failed verification is kept if multiple connections are used.
+					if identityErr != nil && !errors.Is(identityErr, errPeerIdentityUnverified) {
+						return
+					}
+					identityErr = r.verifyPeerIdentity(info.Conn, peer)
+				},
+			}
+			ctx = httptrace.WithClientTrace(ctx, trace)
+		}
+		rc, desc, err := r.peerClient.Fetch(ctx, dist, fetchOpts...)
+		if err != nil {
+			return fetchResponse{}, err
+		}
+		if identityErr != nil {
+			return fetchResponse{}, errors.Join(identityErr, rc.Close())
+		}
+		res := fetchResponse{
+			peer: peer,
+			desc: desc,
+			rc:   rc,
+		}
+		return res, nil
+	})
+}
+
+var errPeerIdentityUnverified = errors.New("peer identity has not been verified")
+
+func (r *Registry) verifyPeerIdentity(conn net.Conn, peer routing.Peer) error {
+	tlsConn, ok := conn.(*tls.Conn)
+	if !ok {
+		return fmt.Errorf("connection to peer %s is not using TLS", peer.Host)
+	}
+	identity, err := r.peerIdentity(tlsConn.ConnectionState())
+	if err != nil {
+		return err
+	}
+	if identity != peer.Host {
+		return fmt.Errorf("peer identity %s does not match expected peer %s", identity, peer.Host)
+	}
+	return nil
+}
+
+// claim advertises that this node is fetching the content from upstream.
+// Mirrored requests for the content will wait until the claim is released.
+func (r *Registry) claim(ctx context.Context, dgst digest.Digest) (func(), error) {
+	doneCh := make(chan any)
+	_, loaded := r.claims.LoadOrStore(dgst, doneCh)
+	if loaded {
+		return nil, fmt.Errorf("upstream fetch for %s is already claimed", dgst)
+	}
+	err := r.router.Advertise(ctx, []string{claimKey(dgst)})
+	if err != nil {
+		r.claims.Delete(dgst)
+		return nil, err
+	}
+	release := func() {
+		r.claims.Delete(dgst)
+		close(doneCh)
+		// Withdraw even if the request context has been cancelled.
+		err := r.router.Withdraw(context.WithoutCancel(ctx), []string{claimKey(dgst)})
+		if err != nil {
+			logr.FromContextOrDiscard(ctx).Error(err, "could not withdraw upstream claim")
+		}
+	}
+	return release, nil
+}
+
+// waitForClaim blocks until the claim of the digest is released.
+// With ingest streaming enabled it returns as soon as the content is being written.
+// A stuck claim is waited on at most the claim timeout, after which the requesting peer falls back to upstream.
+func (r *Registry) waitForClaim(ctx context.Context, dgst digest.Digest) {
+	v, ok := r.claims.Load(dgst)
+	if !ok {
+		return
+	}
+	//nolint: errcheck // Only channels are stored.
+	doneCh := v.(chan any)
+	var tickCh <-chan time.Time
+	if r.ingestStore != nil {
+		ticker := time.NewTicker(10 * time.Millisecond)
+		defer ticker.Stop()
+		tickCh = ticker.C
+	}
+	timer := time.NewTimer(r.claimTimeout)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+			logr.FromContextOrDiscard(ctx).Info("waited too long for upstream claim to be released", "digest", dgst)
+			return
+		case <-doneCh:
+			return
+		case <-tickCh:
+			_, err := r.ingestStore.IngestDescriptor(ctx, dgst)
+			if err == nil {
+				return
+			}
+		}
+	}
+}
+
+// quarantinePeer excludes the peer from fetches until the quarantine period has passed.
+func (r *Registry) quarantinePeer(ctx context.Context, peer routing.Peer) {
+	if r.peerQuarantine <= 0 || peer.Host == "" {
+		return
+	}
+	r.quarantine.Store(peer.Host, time.Now().Add(r.peerQuarantine))
+	logr.FromContextOrDiscard(ctx).Info("quarantined peer which served invalid content", "peer", peer.Host, "duration", r.peerQuarantine)
+}
+
+// recordPeerSuccess records a successful fetch from the peer in the scoreboard.
+func (r *Registry) recordPeerSuccess(peer routing.Peer, latency time.Duration) {
+	if r.peerScoreboard == nil {
+		return
+	}
+	r.peerScoreboard.RecordSuccess(peer.Host, latency)
+}
+
+// recordPeerFailure records a failed fetch from the peer in the scoreboard.
+// Peers rejecting requests because they are saturated are not considered unhealthy.
+func (r *Registry) recordPeerFailure(peer routing.Peer, err error) {
+	if r.peerScoreboard == nil {
+		return
+	}
+	if statusErr, ok := errors.AsType[*httpx.StatusError](err); ok && statusErr.StatusCode == http.StatusServiceUnavailable {
+		return
+	}
+	r.peerScoreboard.RecordFailure(peer.Host, err)
+}
+
+// allowedPeer returns the peer with only the addresses in the allowlist, and false if no address is allowed.
+func (r *Registry) allowedPeer(peer routing.Peer) (routing.Peer, bool) {
+	if r.peerAllowlist == nil {
+		return peer, true
+	}
+	allowed := routing.Peer{
+		Host:     peer.Host,
+		Metadata: peer.Metadata,
+	}
+	for _, addr := range peer.Addresses {
+		if !r.peerAllowlist.Allowed(addr) {
+			continue
+		}
+		allowed.Addresses = append(allowed.Addresses, addr)
+	}
+	if len(allowed.Addresses) == 0 {
+		return peer, false
+	}
+	return allowed, true
+}
+
+func (r *Registry) isQuarantined(peer routing.Peer) bool {
+	v, ok := r.quarantine.Load(peer.Host)
+	if !ok {
+		return false
+	}
+	//nolint: errcheck // Only times are stored.
+	expiry := v.(time.Time)
+	if time.Now().Before(expiry) {
+		return true
+	}
+	r.quarantine.CompareAndDelete(peer.Host, v)
+	return false
+}
+
+func claimKey(dgst digest.Digest) string {
+	return "claim/" + dgst.String()
+}
+
 func (r *Registry) manifestHandler(ctx context.Context, dist oci.DistributionPath, rw httpx.ResponseWriter) {
 	rw.SetAttrs(HandlerAttrKey, "manifest")
 
@@ -524,10 +1403,19 @@ func (r *Registry) manifestHandler(ctx context.Context, dist oci.DistributionPat
 	}
 }
 
-func (r *Registry) blobHandler(ctx context.Context, dist oci.DistributionPath, rw httpx.ResponseWriter) {
+// blobHandler serves the blob from the local store.
+// Blobs served to a peer client are shaped by the egress limits.
+func (r *Registry) blobHandler(ctx context.Context, dist oci.DistributionPath, rw httpx.ResponseWriter, client string) {
 	rw.SetAttrs(HandlerAttrKey, "blob")
 
+	// Content which is still being written is only served to peers, as local requests are mirrored when content is missing.
 	desc, err := r.ociStore.Descriptor(ctx, dist.Digest)
+	ingest := false
+	if errors.Is(err, oci.ErrNotFound) && r.ingestStore != nil {
+		desc, err = r.ingestStore.IngestDescriptor(ctx, dist.Digest)
+		ingest = err == nil
+		rw.SetAttrs("ingest", ingest)
+	}
 	if err != nil {
 		respErr := oci.NewDistributionError(oci.ErrCodeBlobUnknown, fmt.Sprintf("could not get blob %s", dist.Digest), nil)
 		rw.WriteError(http.StatusNotFound, errors.Join(respErr, err))
@@ -573,7 +1461,27 @@ func (r *Registry) blobHandler(ctx context.Context, dist oci.DistributionPath, r
 		return
 	}
 
-	rc, err := r.ociStore.Open(ctx, dist.Digest)
+	shaped := client != "" && r.egressShaper != nil
+	if shaped {
+		release, ok := r.egressShaper.Acquire()
+		if !ok {
+			respErr := oci.NewDistributionError(oci.ErrCodeTooManyRequests, fmt.Sprintf("too many concurrent uploads to serve blob %s", dist.Digest), nil)
+			rw.WriteError(http.StatusServiceUnavailable, respErr)
+			return
+		}
+		defer release()
+	}
+	if client != "" {
+		done := r.loadMeter.Start()
+		defer done()
+	}
+
+	var rc io.ReadSeekCloser
+	if ingest {
+		rc, err = r.ingestStore.OpenIngest(ctx, dist.Digest)
+	} else {
+		rc, err = r.ociStore.Open(ctx, dist.Digest)
+	}
 	if err != nil {
 		respErr := oci.NewDistributionError(oci.ErrCodeBlobUnknown, fmt.Sprintf("could not get reader for blob %s", dist.Digest), nil)
 		rw.WriteError(http.StatusNotFound, errors.Join(respErr, err))
@@ -589,15 +1497,22 @@ func (r *Registry) blobHandler(ctx context.Context, dist oci.DistributionPath, r
 		}
 		src = io.LimitReader(rc, crng.Length())
 	}
+	var dst io.Writer = rw
+	if client != "" {
+		dst = r.loadMeter.Writer(dst)
+	}
+	if shaped {
+		dst = r.egressShaper.Writer(ctx, dst, client)
+	}
 	rw.WriteHeader(status)
-	_, err = io.Copy(rw, src)
+	_, err = io.Copy(dst, src)
 	if err != nil {
 		logr.FromContextOrDiscard(ctx).Error(err, "failed to write blob")
 		return
 	}
 }
 
-func fetchChannel(ctx context.Context, hedger *resilient.Hedger, iterator *routing.Iterator) (<-chan any, chan<- bool) {
+func fetchChannel(ctx context.Context, hedger *resilient.Hedger, iterator *routing.Iterator, hedgeKey func() resilient.HedgeKey) (<-chan any, chan<- bool) {
 	fetchCh := make(chan any)
 	immediateCh := make(chan bool, hedger.Size()+1)
 	immediateCh <- false
@@ -606,7 +1521,7 @@ func fetchChannel(ctx context.Context, hedger *resilient.Hedger, iterator *routi
 		defer cancel()
 
 		hedgeCount := 0
-		hedgeCh := hedger.Channel(ctx)
+		hedgeCh := hedger.Channel(ctx, hedgeKey)
 		for {
 			select {
 			case <-ctx.Done():
@@ -1,7 +1,11 @@
 package registry
 
 import (
+	"bytes"
 	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
 	"io"
 	"net"
@@ -9,13 +13,20 @@ import (
 	"net/http/httptest"
 	"net/netip"
 	"net/url"
+	"path/filepath"
 	"regexp"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"testing/synctest"
 	"time"
 
 	"github.com/go-logr/logr"
 	"github.com/go-openapi/testify/v2/require"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
 	"github.com/opencontainers/go-digest"
 	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
 	"go.uber.org/goleak"
@@ -41,6 +52,10 @@ func TestRegistryOptions(t *testing.T) {
 	}
 	ociClient, err := oci.NewClient()
 	require.NoError(t, err)
+	allowlist, err := routing.NewAllowlist(t.Context(), routing.StaticAllowlistSource{})
+	require.NoError(t, err)
+	loadTracker := routing.NewLoadTracker()
+	scoreboard := routing.NewScoreboard()
 
 	opts := []RegistryOption{
 		WithResolveRetries(5),
@@ -48,6 +63,24 @@ func TestRegistryOptions(t *testing.T) {
 		WithResolveTimeout(10 * time.Minute),
 		WithUserinfo(url.UserPassword("foo", "bar")),
 		WithOCIClient(ociClient),
+		WithMirrorCache(true),
+		WithUpstreamFallback(true),
+		WithUpstreamCoordination(true),
+		WithUpstreamClaimTimeout(time.Minute),
+		WithPeerID("self"),
+		WithIngestStreaming(true),
+		WithPeerQuarantine(time.Hour),
+		WithPeerTLS(&tls.Config{MinVersion: tls.VersionTLS13}),
+		WithPeerIdentity(routing.PeerIdentity, func(string) bool { return true }),
+		WithPeerAllowlist(allowlist),
+		WithPeerLoadTracker(loadTracker),
+		WithPeerScoreboard(scoreboard),
+		WithEgressRateLimit(1024),
+		WithClientEgressRateLimit(512),
+		WithMaxConcurrentUploads(10),
+		WithChunkedFetch(4096, 4),
+		WithDefaultRegistry("docker.io"),
+		WithRegistryPathPrefix(true),
 	}
 	cfg := RegistryConfig{}
 	err = option.Apply(&cfg, opts...)
@@ -57,6 +90,194 @@ func TestRegistryOptions(t *testing.T) {
 	require.EqualT(t, 10*time.Minute, cfg.ResolveTimeout)
 	require.Equal(t, ociClient, cfg.OCIClient)
 	require.EqualT(t, "foo:bar", cfg.Userinfo.String())
+	require.True(t, cfg.MirrorCache)
+	require.True(t, cfg.UpstreamFallback)
+	require.True(t, cfg.UpstreamCoordination)
+	require.EqualT(t, time.Minute, cfg.ClaimTimeout)
+	require.EqualT(t, "self", cfg.PeerID)
+	require.True(t, cfg.IngestStreaming)
+	require.EqualT(t, time.Hour, cfg.PeerQuarantine)
+	require.EqualT(t, tls.VersionTLS13, cfg.PeerTLSConfig.MinVersion)
+	require.NotNil(t, cfg.PeerIdentity)
+	require.NotNil(t, cfg.PeerConnected)
+	require.Equal(t, allowlist, cfg.PeerAllowlist)
+	require.Equal(t, loadTracker, cfg.PeerLoadTracker)
+	require.Equal(t, scoreboard, cfg.PeerScoreboard)
+	require.EqualT(t, int64(1024), cfg.EgressRateLimit)
+	require.EqualT(t, int64(512), cfg.ClientEgressLimit)
+	require.EqualT(t, 10, cfg.MaxUploads)
+	require.EqualT(t, int64(4096), cfg.ChunkSize)
+	require.EqualT(t, 4, cfg.ChunkConcurrency)
+	require.EqualT(t, "docker.io", cfg.DefaultRegistry)
+	require.True(t, cfg.RegistryPathPrefix)
+}
+
+func TestDefaultRegistry(t *testing.T) {
+	t.Parallel()
+
+	peerStore := oci.NewMemory()
+	manifestDesc := ocispec.Descriptor{Digest: digest.Digest("sha256:dff9de10919148711140d349bf03f1a99eb06f94b03e51715ccebfa7cdc518e2"), MediaType: "application/vnd.oci.image.index.v1+json"}
+	img, err := oci.NewImage("docker.io", "library/nginx", "latest", manifestDesc.Digest)
+	require.NoError(t, err)
+	peerStore.AddImage(img)
+	err = peerStore.Write(&img, manifestDesc, []byte(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.index.v1+json","manifests":[]}`))
+	require.NoError(t, err)
+	blobDesc := ocispec.Descriptor{Digest: digest.Digest("sha256:c8dc81dabe7ad5e801191aade7c87fb806d0ef9ce9b699d2e9598337f57f14d0"), MediaType: "dummy"}
+	err = peerStore.Write(nil, blobDesc, []byte("Lorem Ipsum Dolor"))
+	require.NoError(t, err)
+	peerReg, err := NewRegistry(peerStore, routing.NewMemoryRouter(map[string][]routing.Peer{}, routing.Peer{}))
+	require.NoError(t, err)
+	peerSvr := httptest.NewServer(peerReg.Handler(logr.Discard()))
+	t.Cleanup(func() {
+		peerSvr.Close()
+	})
+	addrPort := netip.MustParseAddrPort(peerSvr.Listener.Addr().String())
+	peer := routing.Peer{
+		Host:      "peer",
+		Addresses: []netip.Addr{addrPort.Addr()},
+		Metadata: routing.PeerMetadata{
+			RegistryPort: addrPort.Port(),
+		},
+	}
+
+	resolver := map[string][]routing.Peer{
+		"docker.io/library/nginx:latest": {peer},
+		manifestDesc.Digest.String():     {peer},
+		blobDesc.Digest.String():         {peer},
+	}
+	filters := []oci.Filter{oci.RegistryWhitelistFilter{Whitelist: []string{"docker.io"}}}
+	router := routing.NewMemoryRouter(resolver, routing.Peer{})
+
+	// Docker does not set the namespace parameter when requesting from a registry mirror.
+	reg, err := NewRegistry(oci.NewMemory(), router, WithRegistryFilters(filters))
+	require.NoError(t, err)
+	rw := httptest.NewRecorder()
+	req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "http://127.0.0.1:5000/v2/library/nginx/manifests/latest", nil)
+	reg.Handler(logr.Discard()).ServeHTTP(rw, req)
+	require.EqualT(t, http.StatusNotFound, rw.Result().StatusCode)
+
+	reg, err = NewRegistry(oci.NewMemory(), router, WithRegistryFilters(filters), WithDefaultRegistry("docker.io"))
+	require.NoError(t, err)
+	handler := reg.Handler(logr.Discard())
+
+	tests := []struct {
+		url          string
+		expectedBody string
+	}{
+		{
+			url:          "http://127.0.0.1:5000/v2/library/nginx/manifests/latest",
+			expectedBody: `{"schemaVersion":2,"mediaType":"application/vnd.oci.image.index.v1+json","manifests":[]}`,
+		},
+		{
+			url:          "http://127.0.0.1:5000/v2/library/nginx/manifests/" + manifestDesc.Digest.String(),
+			expectedBody: `{"schemaVersion":2,"mediaType":"application/vnd.oci.image.index.v1+json","manifests":[]}`,
+		},
+		{
+			url:          "http://127.0.0.1:5000/v2/library/nginx/blobs/" + blobDesc.Digest.String(),
+			expectedBody: "Lorem Ipsum Dolor",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			t.Parallel()
+
+			rw := httptest.NewRecorder()
+			req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, tt.url, nil)
+			handler.ServeHTTP(rw, req)
+			require.EqualT(t, http.StatusOK, rw.Result().StatusCode)
+			require.EqualT(t, tt.expectedBody, rw.Body.String())
+		})
+	}
+
+	// An explicit namespace is not overridden by the default registry.
+	rw = httptest.NewRecorder()
+	req = httptest.NewRequestWithContext(t.Context(), http.MethodGet, "http://127.0.0.1:5000/v2/library/nginx/manifests/latest?ns=ghcr.io", nil)
+	handler.ServeHTTP(rw, req)
+	require.EqualT(t, http.StatusNotFound, rw.Result().StatusCode)
+}
+
+func TestRegistryPathPrefix(t *testing.T) {
+	t.Parallel()
+
+	peerStore := oci.NewMemory()
+	manifestDesc := ocispec.Descriptor{Digest: digest.Digest("sha256:dff9de10919148711140d349bf03f1a99eb06f94b03e51715ccebfa7cdc518e2"), MediaType: "application/vnd.oci.image.index.v1+json"}
+	img, err := oci.NewImage("docker.io", "library/nginx", "latest", manifestDesc.Digest)
+	require.NoError(t, err)
+	peerStore.AddImage(img)
+	err = peerStore.Write(&img, manifestDesc, []byte(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.index.v1+json","manifests":[]}`))
+	require.NoError(t, err)
+	blobDesc := ocispec.Descriptor{Digest: digest.Digest("sha256:c8dc81dabe7ad5e801191aade7c87fb806d0ef9ce9b699d2e9598337f57f14d0"), MediaType: "dummy"}
+	err = peerStore.Write(nil, blobDesc, []byte("Lorem Ipsum Dolor"))
+	require.NoError(t, err)
+	peerReg, err := NewRegistry(peerStore, routing.NewMemoryRouter(map[string][]routing.Peer{}, routing.Peer{}))
+	require.NoError(t, err)
+	peerSvr := httptest.NewServer(peerReg.Handler(logr.Discard()))
+	t.Cleanup(func() {
+		peerSvr.Close()
+	})
+	addrPort := netip.MustParseAddrPort(peerSvr.Listener.Addr().String())
+	peer := routing.Peer{
+		Host:      "peer",
+		Addresses: []netip.Addr{addrPort.Addr()},
+		Metadata: routing.PeerMetadata{
+			RegistryPort: addrPort.Port(),
+		},
+	}
+
+	resolver := map[string][]routing.Peer{
+		"docker.io/library/nginx:latest": {peer},
+		manifestDesc.Digest.String():     {peer},
+		blobDesc.Digest.String():         {peer},
+	}
+	filters := []oci.Filter{oci.RegistryWhitelistFilter{Whitelist: []string{"docker.io"}}}
+	router := routing.NewMemoryRouter(resolver, routing.Peer{})
+
+	// CRI-O prefixes the registry to the repository instead of setting the namespace parameter.
+	reg, err := NewRegistry(oci.NewMemory(), router, WithRegistryFilters(filters))
+	require.NoError(t, err)
+	rw := httptest.NewRecorder()
+	req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "http://127.0.0.1:5000/v2/docker.io/library/nginx/manifests/latest", nil)
+	reg.Handler(logr.Discard()).ServeHTTP(rw, req)
+	require.EqualT(t, http.StatusNotFound, rw.Result().StatusCode)
+
+	reg, err = NewRegistry(oci.NewMemory(), router, WithRegistryFilters(filters), WithRegistryPathPrefix(true))
+	require.NoError(t, err)
+	handler := reg.Handler(logr.Discard())
+
+	tests := []struct {
+		url          string
+		expectedBody string
+	}{
+		{
+			url:          "http://127.0.0.1:5000/v2/docker.io/library/nginx/manifests/latest",
+			expectedBody: `{"schemaVersion":2,"mediaType":"application/vnd.oci.image.index.v1+json","manifests":[]}`,
+		},
+		{
+			url:          "http://127.0.0.1:5000/v2/docker.io/library/nginx/manifests/" + manifestDesc.Digest.String(),
+			expectedBody: `{"schemaVersion":2,"mediaType":"application/vnd.oci.image.index.v1+json","manifests":[]}`,
+		},
+		{
+			url:          "http://127.0.0.1:5000/v2/docker.io/library/nginx/blobs/" + blobDesc.Digest.String(),
+			expectedBody: "Lorem Ipsum Dolor",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			t.Parallel()
+
+			rw := httptest.NewRecorder()
+			req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, tt.url, nil)
+			handler.ServeHTTP(rw, req)
+			require.EqualT(t, http.StatusOK, rw.Result().StatusCode)
+			require.EqualT(t, tt.expectedBody, rw.Body.String())
+		})
+	}
+
+	// Repositories are not split when the namespace is set explicitly.
+	rw = httptest.NewRecorder()
+	req = httptest.NewRequestWithContext(t.Context(), http.MethodGet, "http://127.0.0.1:5000/v2/docker.io/library/nginx/manifests/latest?ns=docker.io", nil)
+	handler.ServeHTTP(rw, req)
+	require.EqualT(t, http.StatusNotFound, rw.Result().StatusCode)
 }
 
 func TestProbeHandlers(t *testing.T) {
@@ -519,6 +740,318 @@ func TestRegistryHandler(t *testing.T) {
 	}
 }
 
+func TestMirrorCache(t *testing.T) {
+	t.Parallel()
+
+	_, err := NewRegistry(struct{ oci.Store }{oci.NewMemory()}, nil, WithMirrorCache(true))
+	require.EqualError(t, err, "mirror cache requires a writable OCI store")
+
+	peerStore := oci.NewMemory()
+	blobDesc := ocispec.Descriptor{Digest: digest.Digest("sha256:c8dc81dabe7ad5e801191aade7c87fb806d0ef9ce9b699d2e9598337f57f14d0"), MediaType: "dummy"}
+	err = peerStore.Write(nil, blobDesc, []byte("Lorem Ipsum Dolor"))
+	require.NoError(t, err)
+	peerReg, err := NewRegistry(&flakyStore{Memory: peerStore}, routing.NewMemoryRouter(map[string][]routing.Peer{}, routing.Peer{}))
+	require.NoError(t, err)
+	peerSvr := httptest.NewServer(peerReg.Handler(logr.Discard()))
+	t.Cleanup(func() {
+		peerSvr.Close()
+	})
+	addrPort := netip.MustParseAddrPort(peerSvr.Listener.Addr().String())
+	peer := routing.Peer{
+		Host:      "peer",
+		Addresses: []netip.Addr{addrPort.Addr()},
+		Metadata: routing.PeerMetadata{
+			RegistryPort: addrPort.Port(),
+		},
+	}
+
+	resolver := map[string][]routing.Peer{
+		blobDesc.Digest.String(): {peer},
+	}
+	localStore := oci.NewMemory()
+	reg, err := NewRegistry(localStore, routing.NewMemoryRouter(resolver, routing.Peer{}), WithMirrorCache(true))
+	require.NoError(t, err)
+	handler := reg.Handler(logr.Discard())
+
+	// Head and range requests should not be cached.
+	for _, method := range []string{http.MethodHead, http.MethodGet} {
+		rw := httptest.NewRecorder()
+		req := httptest.NewRequestWithContext(t.Context(), method, "http://example.com/v2/foo/bar/blobs/"+blobDesc.Digest.String()+"?ns=docker.io", nil)
+		req.Header.Set(httpx.HeaderRange, "bytes=0-4")
+		handler.ServeHTTP(rw, req)
+		require.EqualT(t, http.StatusPartialContent, rw.Result().StatusCode)
+		_, err = localStore.Descriptor(t.Context(), blobDesc.Digest)
+		require.ErrorIs(t, err, oci.ErrNotFound)
+	}
+
+	// Content should be written even when the copy is resumed.
+	rw := httptest.NewRecorder()
+	req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "http://example.com/v2/foo/bar/blobs/"+blobDesc.Digest.String()+"?ns=docker.io", nil)
+	handler.ServeHTTP(rw, req)
+	require.EqualT(t, http.StatusOK, rw.Result().StatusCode)
+	require.EqualT(t, "Lorem Ipsum Dolor", rw.Body.String())
+	desc, err := localStore.Descriptor(t.Context(), blobDesc.Digest)
+	require.NoError(t, err)
+	require.EqualT(t, int64(17), desc.Size)
+	require.EqualT(t, "dummy", desc.MediaType)
+}
+
+func TestUpstreamFallback(t *testing.T) {
+	t.Parallel()
+
+	upstreamStore := oci.NewMemory()
+	blobDesc := ocispec.Descriptor{Digest: digest.Digest("sha256:c8dc81dabe7ad5e801191aade7c87fb806d0ef9ce9b699d2e9598337f57f14d0"), MediaType: "dummy"}
+	err := upstreamStore.Write(nil, blobDesc, []byte("Lorem Ipsum Dolor"))
+	require.NoError(t, err)
+	upstreamReg, err := NewRegistry(upstreamStore, routing.NewMemoryRouter(map[string][]routing.Peer{}, routing.Peer{}))
+	require.NoError(t, err)
+	upstreamSvr := httptest.NewTLSServer(upstreamReg.Handler(logr.Discard()))
+	t.Cleanup(func() {
+		upstreamSvr.Close()
+	})
+	pool := x509.NewCertPool()
+	pool.AddCert(upstreamSvr.Certificate())
+	ociClient, err := oci.NewClient(oci.WithTLS(pool, nil))
+	require.NoError(t, err)
+
+	target := fmt.Sprintf("http://example.com/v2/foo/bar/blobs/%s?ns=%s", blobDesc.Digest, upstreamSvr.Listener.Addr().String())
+	router := routing.NewMemoryRouter(map[string][]routing.Peer{}, routing.Peer{})
+
+	reg, err := NewRegistry(oci.NewMemory(), router, WithOCIClient(ociClient))
+	require.NoError(t, err)
+	rw := httptest.NewRecorder()
+	req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, target, nil)
+	reg.Handler(logr.Discard()).ServeHTTP(rw, req)
+	require.EqualT(t, http.StatusNotFound, rw.Result().StatusCode)
+
+	reg, err = NewRegistry(oci.NewMemory(), router, WithOCIClient(ociClient), WithUpstreamFallback(true))
+	require.NoError(t, err)
+	rw = httptest.NewRecorder()
+	req = httptest.NewRequestWithContext(t.Context(), http.MethodGet, target, nil)
+	reg.Handler(logr.Discard()).ServeHTTP(rw, req)
+	require.EqualT(t, http.StatusOK, rw.Result().StatusCode)
+	require.EqualT(t, "Lorem Ipsum Dolor", rw.Body.String())
+	require.EqualT(t, blobDesc.Digest.String(), rw.Header().Get(oci.HeaderDockerDigest))
+
+	rw = httptest.NewRecorder()
+	req = httptest.NewRequestWithContext(t.Context(), http.MethodGet, "http://example.com/v2/foo/bar/blobs/sha256:03ffdf45276dd38ffac79b0e9c6c14d89d9113ad783d5922580f4c66a3305591?ns="+upstreamSvr.Listener.Addr().String(), nil)
+	reg.Handler(logr.Discard()).ServeHTTP(rw, req)
+	require.EqualT(t, http.StatusNotFound, rw.Result().StatusCode)
+	require.Contains(t, rw.Body.String(), "BLOB_UNKNOWN")
+}
+
+func TestUpstreamCoordination(t *testing.T) {
+	t.Parallel()
+
+	_, err := NewRegistry(oci.NewMemory(), nil, WithUpstreamCoordination(true), WithMirrorCache(true))
+	require.EqualError(t, err, "upstream coordination requires mirror cache and upstream fallback to be enabled")
+
+	blob := []byte("Lorem Ipsum Dolor")
+	dgst := digest.FromBytes(blob)
+	upstreamRequests := atomic.Int32{}
+	upstreamReceivedCh := make(chan any)
+	upstreamUnblockCh := make(chan any)
+	upstreamSvr := httptest.NewTLSServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if upstreamRequests.Add(1) == 1 {
+			close(upstreamReceivedCh)
+			<-upstreamUnblockCh
+		}
+		rw.Header().Set(httpx.HeaderContentType, "dummy")
+		rw.Header().Set(httpx.HeaderContentLength, strconv.Itoa(len(blob)))
+		rw.Header().Set(oci.HeaderDockerDigest, dgst.String())
+		//nolint: errcheck // Ignore.
+		rw.Write(blob)
+	}))
+	t.Cleanup(func() {
+		upstreamSvr.Close()
+	})
+	pool := x509.NewCertPool()
+	pool.AddCert(upstreamSvr.Certificate())
+	ociClient, err := oci.NewClient(oci.WithTLS(pool, nil))
+	require.NoError(t, err)
+	opts := []RegistryOption{
+		WithOCIClient(ociClient),
+		WithMirrorCache(true),
+		WithUpstreamFallback(true),
+		WithUpstreamCoordination(true),
+	}
+
+	resolver := map[string][]routing.Peer{}
+	leaderReg, err := NewRegistry(oci.NewMemory(), routing.NewMemoryRouter(resolver, routing.Peer{}), opts...)
+	require.NoError(t, err)
+	leaderMirroredCh := make(chan any)
+	leaderHandler := leaderReg.Handler(logr.Discard())
+	leaderSvr := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.Header.Get(HeaderSpegelMirrored) == "true" {
+			close(leaderMirroredCh)
+		}
+		leaderHandler.ServeHTTP(rw, req)
+	}))
+	t.Cleanup(func() {
+		leaderSvr.Close()
+	})
+	addrPort := netip.MustParseAddrPort(leaderSvr.Listener.Addr().String())
+	leaderPeer := routing.Peer{
+		Host:      "leader",
+		Addresses: []netip.Addr{addrPort.Addr()},
+		Metadata: routing.PeerMetadata{
+			RegistryPort: addrPort.Port(),
+		},
+	}
+	leaderRouter := routing.NewMemoryRouter(resolver, leaderPeer)
+	leaderReg.router = leaderRouter
+	followerReg, err := NewRegistry(oci.NewMemory(), routing.NewMemoryRouter(resolver, routing.Peer{Host: "follower"}), opts...)
+	require.NoError(t, err)
+
+	target := fmt.Sprintf("http://example.com/v2/foo/bar/blobs/%s?ns=%s", dgst, upstreamSvr.Listener.Addr().String())
+	leaderRw := httptest.NewRecorder()
+	leaderDoneCh := make(chan any)
+	go func() {
+		defer close(leaderDoneCh)
+		req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, target, nil)
+		leaderHandler.ServeHTTP(leaderRw, req)
+	}()
+	<-upstreamReceivedCh
+	_, ok := leaderRouter.Get(claimKey(dgst))
+	require.True(t, ok)
+
+	followerRw := httptest.NewRecorder()
+	followerDoneCh := make(chan any)
+	go func() {
+		defer close(followerDoneCh)
+		req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, target, nil)
+		followerReg.Handler(logr.Discard()).ServeHTTP(followerRw, req)
+	}()
+	<-leaderMirroredCh
+	close(upstreamUnblockCh)
+	<-leaderDoneCh
+	<-followerDoneCh
+
+	require.EqualT(t, http.StatusOK, leaderRw.Result().StatusCode)
+	require.EqualT(t, string(blob), leaderRw.Body.String())
+	require.EqualT(t, http.StatusOK, followerRw.Result().StatusCode)
+	require.EqualT(t, string(blob), followerRw.Body.String())
+	require.EqualT(t, int32(1), upstreamRequests.Load())
+	peers, _ := leaderRouter.Get(claimKey(dgst))
+	require.Empty(t, peers)
+}
+
+// concurrentClaimRouter simulates a peer which claims the same keys at the same time.
+type concurrentClaimRouter struct {
+	*routing.MemoryRouter
+	peer routing.Peer
+}
+
+func (c *concurrentClaimRouter) Advertise(ctx context.Context, keys []string) error {
+	for _, key := range keys {
+		c.Add(key, c.peer)
+	}
+	return c.MemoryRouter.Advertise(ctx, keys)
+}
+
+func TestUpstreamClaim(t *testing.T) {
+	t.Parallel()
+
+	blob := []byte("Lorem Ipsum Dolor")
+	dgst := digest.FromBytes(blob)
+	upstreamRequests := atomic.Int32{}
+	upstreamSvr := httptest.NewTLSServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		upstreamRequests.Add(1)
+		rw.Header().Set(httpx.HeaderContentType, "dummy")
+		rw.Header().Set(httpx.HeaderContentLength, strconv.Itoa(len(blob)))
+		rw.Header().Set(oci.HeaderDockerDigest, dgst.String())
+		//nolint: errcheck // Ignore.
+		rw.Write(blob)
+	}))
+	t.Cleanup(func() {
+		upstreamSvr.Close()
+	})
+	pool := x509.NewCertPool()
+	pool.AddCert(upstreamSvr.Certificate())
+	ociClient, err := oci.NewClient(oci.WithTLS(pool, nil))
+	require.NoError(t, err)
+	opts := []RegistryOption{
+		WithOCIClient(ociClient),
+		WithMirrorCache(true),
+		WithUpstreamFallback(true),
+		WithUpstreamCoordination(true),
+		WithUpstreamClaimTimeout(50 * time.Millisecond),
+	}
+	target := fmt.Sprintf("http://example.com/v2/foo/bar/blobs/%s?ns=%s", dgst, upstreamSvr.Listener.Addr().String())
+
+	claimStore := oci.NewMemory()
+	err = claimStore.Write(nil, ocispec.Descriptor{Digest: dgst, MediaType: "dummy"}, blob)
+	require.NoError(t, err)
+	claimReg, err := NewRegistry(claimStore, routing.NewMemoryRouter(map[string][]routing.Peer{}, routing.Peer{}))
+	require.NoError(t, err)
+	claimSvr := httptest.NewServer(claimReg.Handler(logr.Discard()))
+	t.Cleanup(func() {
+		claimSvr.Close()
+	})
+	addrPort := netip.MustParseAddrPort(claimSvr.Listener.Addr().String())
+	newClaimPeer := func(host string) routing.Peer {
+		return routing.Peer{
+			Host:      host,
+			Addresses: []netip.Addr{addrPort.Addr()},
+			Metadata: routing.PeerMetadata{
+				RegistryPort: addrPort.Port(),
+			},
+		}
+	}
+
+	// Peers claiming at the same time defer to the peer with the lowest ID.
+	tests := []struct {
+		name                     string
+		peerID                   string
+		claimPeer                string
+		expectedUpstreamRequests int32
+	}{
+		{
+			name:                     "other peer has lower ID",
+			peerID:                   "b",
+			claimPeer:                "a",
+			expectedUpstreamRequests: 0,
+		},
+		{
+			name:                     "other peer has higher ID",
+			peerID:                   "a",
+			claimPeer:                "b",
+			expectedUpstreamRequests: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstreamRequests.Store(0)
+			router := &concurrentClaimRouter{
+				MemoryRouter: routing.NewMemoryRouter(map[string][]routing.Peer{}, routing.Peer{Host: tt.peerID}),
+				peer:         newClaimPeer(tt.claimPeer),
+			}
+			reg, err := NewRegistry(oci.NewMemory(), router, append(opts, WithPeerID(tt.peerID))...)
+			require.NoError(t, err)
+			rw := httptest.NewRecorder()
+			req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, target, nil)
+			reg.Handler(logr.Discard()).ServeHTTP(rw, req)
+			require.EqualT(t, http.StatusOK, rw.Result().StatusCode)
+			require.EqualT(t, string(blob), rw.Body.String())
+			require.EqualT(t, tt.expectedUpstreamRequests, upstreamRequests.Load())
+		})
+	}
+
+	// Mirrored requests stop waiting for a stuck claim after the claim timeout.
+	reg, err := NewRegistry(oci.NewMemory(), routing.NewMemoryRouter(map[string][]routing.Peer{}, routing.Peer{}), opts...)
+	require.NoError(t, err)
+	release, err := reg.claim(t.Context(), dgst)
+	require.NoError(t, err)
+	t.Cleanup(release)
+	rw := httptest.NewRecorder()
+	req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, target, nil)
+	req.Header.Set(HeaderSpegelMirrored, "true")
+	start := time.Now()
+	reg.Handler(logr.Discard()).ServeHTTP(rw, req)
+	require.EqualT(t, http.StatusNotFound, rw.Result().StatusCode)
+	require.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+}
+
 type flakyStore struct {
 	*oci.Memory
 }
@@ -564,20 +1097,1019 @@ func (f *flakyReadSeekCloser) Read(p []byte) (int, error) {
 	return n, err
 }
 
-func TestFetchChannel(t *testing.T) {
+func TestPeerVerification(t *testing.T) {
 	t.Parallel()
 
-	synctest.Test(t, func(t *testing.T) {
-		ctx, cancel := context.WithCancel(t.Context())
-		defer cancel()
+	manifest := []byte(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.index.v1+json","manifests":[]}`)
+	manifestDesc := ocispec.Descriptor{Digest: digest.FromBytes(manifest), MediaType: ocispec.MediaTypeImageIndex}
+	blob := []byte("Lorem Ipsum Dolor")
+	blobDesc := ocispec.Descriptor{Digest: digest.FromBytes(blob), MediaType: "dummy"}
+	largeBlob := bytes.Repeat([]byte("Lorem Ipsum Dolor"), 10*1024)
+	largeBlobDesc := ocispec.Descriptor{Digest: digest.FromBytes(largeBlob), MediaType: "dummy"}
 
-		hedger := resilient.NewHedger([]float64{50, 90, 99}, time.Second)
+	newPeer := func(t *testing.T, host string, store oci.Store) routing.Peer {
+		t.Helper()
+
+		peerReg, err := NewRegistry(store, routing.NewMemoryRouter(map[string][]routing.Peer{}, routing.Peer{}))
+		require.NoError(t, err)
+		peerSvr := httptest.NewServer(peerReg.Handler(logr.Discard()))
+		t.Cleanup(func() {
+			peerSvr.Close()
+		})
+		addrPort := netip.MustParseAddrPort(peerSvr.Listener.Addr().String())
+		return routing.Peer{
+			Host:      host,
+			Addresses: []netip.Addr{addrPort.Addr()},
+			Metadata: routing.PeerMetadata{
+				RegistryPort: addrPort.Port(),
+			},
+		}
+	}
+	goodStore := oci.NewMemory()
+	corruptStore := &corruptStore{Memory: oci.NewMemory()}
+	for _, store := range []*oci.Memory{goodStore, corruptStore.Memory} {
+		err := store.Write(nil, manifestDesc, manifest)
+		require.NoError(t, err)
+		err = store.Write(nil, blobDesc, blob)
+		require.NoError(t, err)
+		err = store.Write(nil, largeBlobDesc, largeBlob)
+		require.NoError(t, err)
+	}
+	goodPeer := newPeer(t, "good", goodStore)
+	corruptPeer := newPeer(t, "corrupt", corruptStore)
+
+	//nolint: govet // Prioritize readability in tests.
+	tests := []struct {
+		name               string
+		distributionKind   oci.DistributionKind
+		dgst               digest.Digest
+		peers              []routing.Peer
+		expectedStatus     int
+		expectedBody       []byte
+		expectedQuarantine bool
+	}{
+		{
+			name:               "corrupt manifest should not be served",
+			distributionKind:   oci.DistributionKindManifest,
+			dgst:               manifestDesc.Digest,
+			peers:              []routing.Peer{corruptPeer},
+			expectedStatus:     http.StatusNotFound,
+			expectedBody:       []byte(`{"errors":[{"code":"MANIFEST_UNKNOWN","detail":{"attempts":0},"message":"could not find peer for ` + manifestDesc.Digest.String() + `"}]}`),
+			expectedQuarantine: true,
+		},
+		{
+			name:             "corrupt manifest should be retried with another peer",
+			distributionKind: oci.DistributionKindManifest,
+			dgst:             manifestDesc.Digest,
+			peers:            []routing.Peer{corruptPeer, goodPeer},
+			expectedStatus:   http.StatusOK,
+			expectedBody:     manifest,
+		},
+		{
+			name:               "corrupt blob should not be served",
+			distributionKind:   oci.DistributionKindBlob,
+			dgst:               blobDesc.Digest,
+			peers:              []routing.Peer{corruptPeer},
+			expectedStatus:     http.StatusOK,
+			expectedBody:       []byte{},
+			expectedQuarantine: true,
+		},
+		{
+			name:             "corrupt blob should be retried with another peer",
+			distributionKind: oci.DistributionKindBlob,
+			dgst:             blobDesc.Digest,
+			peers:            []routing.Peer{corruptPeer, goodPeer},
+			expectedStatus:   http.StatusOK,
+			expectedBody:     blob,
+		},
+		{
+			name:               "corrupt large blob should be aborted before last part",
+			distributionKind:   oci.DistributionKindBlob,
+			dgst:               largeBlobDesc.Digest,
+			peers:              []routing.Peer{corruptPeer},
+			expectedStatus:     http.StatusOK,
+			expectedQuarantine: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			resolver := map[string][]routing.Peer{
+				tt.dgst.String(): tt.peers,
+			}
+			localStore := oci.NewMemory()
+			reg, err := NewRegistry(localStore, routing.NewMemoryRouter(resolver, routing.Peer{}), WithMirrorCache(true))
+			require.NoError(t, err)
+			handler := reg.Handler(logr.Discard())
+
+			ctx, cancel := context.WithTimeout(t.Context(), 5*time.Second)
+			defer cancel()
+			target := fmt.Sprintf("http://example.com/v2/foo/bar/%s/%s?ns=docker.io", tt.distributionKind, tt.dgst)
+			rw := httptest.NewRecorder()
+			req := httptest.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+			handler.ServeHTTP(rw, req)
+
+			require.EqualT(t, tt.expectedStatus, rw.Result().StatusCode)
+			if tt.expectedBody != nil {
+				require.SliceEqualT(t, tt.expectedBody, rw.Body.Bytes())
+			} else {
+				require.Less(t, rw.Body.Len(), len(largeBlob))
+				require.NotEmpty(t, rw.Body.Bytes())
+			}
+			// The corrupt peer is only guaranteed to be used when it is the only peer.
+			if tt.expectedQuarantine {
+				require.TrueT(t, reg.isQuarantined(corruptPeer))
+			}
+			require.FalseT(t, reg.isQuarantined(goodPeer))
+			_, err = localStore.Descriptor(t.Context(), tt.dgst)
+			if tt.expectedQuarantine {
+				require.ErrorIs(t, err, oci.ErrNotFound)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestPeerVerificationRetry(t *testing.T) {
+	t.Parallel()
+
+	// The corrupt byte is within the last part which is only written after verification.
+	blob := make([]byte, 4*1024*1024)
+	_, err := rand.Read(blob)
+	require.NoError(t, err)
+	blobDesc := ocispec.Descriptor{Digest: digest.FromBytes(blob), MediaType: "dummy"}
+	corruptStore := &corruptStore{Memory: oci.NewMemory(), offset: len(blob) - 1}
+	err = corruptStore.Write(nil, blobDesc, blob)
+	require.NoError(t, err)
+	goodStore := oci.NewMemory()
+	err = goodStore.Write(nil, blobDesc, blob)
+	require.NoError(t, err)
+
+	newPeer := func(t *testing.T, host string, handler http.Handler) routing.Peer {
+		t.Helper()
+
+		peerSvr := httptest.NewServer(handler)
+		t.Cleanup(func() {
+			peerSvr.Close()
+		})
+		addrPort := netip.MustParseAddrPort(peerSvr.Listener.Addr().String())
+		return routing.Peer{
+			Host:      host,
+			Addresses: []netip.Addr{addrPort.Addr()},
+			Metadata: routing.PeerMetadata{
+				RegistryPort: addrPort.Port(),
+			},
+		}
+	}
+	corruptReg, err := NewRegistry(corruptStore, routing.NewMemoryRouter(map[string][]routing.Peer{}, routing.Peer{}))
+	require.NoError(t, err)
+	corruptServedCh := make(chan any)
+	corruptServed := sync.OnceFunc(func() {
+		close(corruptServedCh)
+	})
+	corruptPeer := newPeer(t, "corrupt", http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		defer corruptServed()
+		corruptReg.Handler(logr.Discard()).ServeHTTP(rw, req)
+	}))
+	goodReg, err := NewRegistry(goodStore, routing.NewMemoryRouter(map[string][]routing.Peer{}, routing.Peer{}))
+	require.NoError(t, err)
+	goodRequests := atomic.Int32{}
+	goodPeer := newPeer(t, "good", http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		// The corrupt peer always serves the blob first.
+		select {
+		case <-req.Context().Done():
+			return
+		case <-corruptServedCh:
+		}
+		goodRequests.Add(1)
+		goodReg.Handler(logr.Discard()).ServeHTTP(rw, req)
+	}))
+
+	resolver := map[string][]routing.Peer{
+		blobDesc.Digest.String(): {corruptPeer, goodPeer},
+	}
+	reg, err := NewRegistry(oci.NewMemory(), routing.NewMemoryRouter(resolver, routing.Peer{}))
+	require.NoError(t, err)
+	ctx, cancel := context.WithTimeout(t.Context(), 5*time.Second)
+	defer cancel()
+	rw := httptest.NewRecorder()
+	req := httptest.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("http://example.com/v2/foo/bar/blobs/%s?ns=docker.io", blobDesc.Digest), nil)
+	reg.Handler(logr.Discard()).ServeHTTP(rw, req)
+
+	require.EqualT(t, http.StatusOK, rw.Result().StatusCode)
+	require.True(t, bytes.Equal(blob, rw.Body.Bytes()))
+	require.Positive(t, goodRequests.Load())
+	require.TrueT(t, reg.isQuarantined(corruptPeer))
+	require.FalseT(t, reg.isQuarantined(goodPeer))
+}
+
+func TestDigestVerifier(t *testing.T) {
+	t.Parallel()
+
+	content := []byte("Lorem ipsum dolor sit amet, consectetur adipiscing elit, sed do eiusmod tempor incididunt ut labore.")
+	dgst := digest.FromBytes(content)
+	corruptAt := func(offset int) []byte {
+		b := bytes.Clone(content)
+		b[offset] ^= 0xff
+		return b
+	}
+	first := routing.Peer{Host: "first"}
+	second := routing.Peer{Host: "second"}
+	third := routing.Peer{Host: "third"}
+	split := func(offset int64) (routing.Peer, int64) {
+		if offset < 50 {
+			return first, 50
+		}
+		return second, int64(len(content))
+	}
+	single := func(int64) (routing.Peer, int64) {
+		return third, int64(len(content))
+	}
+
+	tests := []struct {
+		name               string
+		corrupt            []byte
+		expectedBody       []byte
+		expectedMismatched []routing.Peer
+		expectedErr        error
+	}{
+		{
+			name:               "wrong content not yet sent",
+			corrupt:            corruptAt(len(content) - 1),
+			expectedBody:       content,
+			expectedMismatched: []routing.Peer{second},
+		},
+		{
+			name:               "wrong content already sent",
+			corrupt:            corruptAt(0),
+			expectedBody:       corruptAt(0)[:50],
+			expectedMismatched: []routing.Peer{first},
+			expectedErr:        errSentContentMismatch,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			buf := &bytes.Buffer{}
+			verifier := newDigestVerifier(dgst, int64(len(content)))
+			w := verifier.Writer(buf, split)
+			_, err := w.Write(tt.corrupt[:50])
+			require.NoError(t, err)
+			_, err = w.Write(tt.corrupt[50:])
+			require.ErrorIs(t, err, errDigestMismatch)
+			require.ErrorIs(t, verifier.Verify(), errDigestMismatch)
+			require.Equal(t, []routing.Peer{first, second}, verifier.Sources())
+			require.Empty(t, verifier.Mismatched())
+
+			verifier = verifier.Retry()
+			w = verifier.Writer(buf, single)
+			for chunk := range slices.Chunk(content, 30) {
+				n, err := w.Write(chunk)
+				require.NoError(t, err)
+				require.EqualT(t, len(chunk), n)
+			}
+			err = verifier.Verify()
+			if tt.expectedErr != nil {
+				require.ErrorIs(t, err, tt.expectedErr)
+			} else {
+				require.NoError(t, err)
+			}
+			require.Equal(t, tt.expectedBody, buf.Bytes())
+			require.Equal(t, []routing.Peer{third}, verifier.Sources())
+			require.Equal(t, tt.expectedMismatched, verifier.Mismatched())
+		})
+	}
+}
+
+func TestPeerQuarantine(t *testing.T) {
+	t.Parallel()
+
+	peer := routing.Peer{Host: "peer"}
+
+	reg, err := NewRegistry(oci.NewMemory(), nil, WithPeerQuarantine(0))
+	require.NoError(t, err)
+	reg.quarantinePeer(t.Context(), peer)
+	require.FalseT(t, reg.isQuarantined(peer))
+
+	reg, err = NewRegistry(oci.NewMemory(), nil, WithPeerQuarantine(time.Minute))
+	require.NoError(t, err)
+	reg.quarantinePeer(t.Context(), routing.Peer{})
+	require.FalseT(t, reg.isQuarantined(routing.Peer{}))
+	reg.quarantinePeer(t.Context(), peer)
+	require.TrueT(t, reg.isQuarantined(peer))
+	reg.quarantine.Store(peer.Host, time.Now().Add(-time.Second))
+	require.FalseT(t, reg.isQuarantined(peer))
+	_, ok := reg.quarantine.Load(peer.Host)
+	require.FalseT(t, ok)
+}
+
+func TestPeerAllowlist(t *testing.T) {
+	t.Parallel()
+
+	blobDesc := ocispec.Descriptor{Digest: digest.Digest("sha256:c8dc81dabe7ad5e801191aade7c87fb806d0ef9ce9b699d2e9598337f57f14d0"), MediaType: "dummy"}
+	peerStore := oci.NewMemory()
+	err := peerStore.Write(nil, blobDesc, []byte("Lorem Ipsum Dolor"))
+	require.NoError(t, err)
+	peerReg, err := NewRegistry(peerStore, routing.NewMemoryRouter(map[string][]routing.Peer{}, routing.Peer{}))
+	require.NoError(t, err)
+	peerSvr := httptest.NewServer(peerReg.Handler(logr.Discard()))
+	t.Cleanup(func() {
+		peerSvr.Close()
+	})
+	addrPort := netip.MustParseAddrPort(peerSvr.Listener.Addr().String())
+	peer := routing.Peer{
+		Host:      "peer",
+		Addresses: []netip.Addr{netip.MustParseAddr("10.0.0.1"), addrPort.Addr()},
+		Metadata: routing.PeerMetadata{
+			RegistryPort: addrPort.Port(),
+		},
+	}
+	resolver := map[string][]routing.Peer{
+		blobDesc.Digest.String(): {peer},
+	}
+	target := fmt.Sprintf("http://example.com/v2/foo/bar/blobs/%s?ns=docker.io", blobDesc.Digest)
+
+	tests := []struct {
+		name           string
+		prefix         string
+		expectedStatus int
+	}{
+		{
+			name:           "allowed address",
+			prefix:         "127.0.0.0/8",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "no allowed address",
+			prefix:         "192.168.0.0/16",
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			allowlist, err := routing.NewAllowlist(t.Context(), routing.StaticAllowlistSource{netip.MustParsePrefix(tt.prefix)})
+			require.NoError(t, err)
+			reg, err := NewRegistry(oci.NewMemory(), routing.NewMemoryRouter(resolver, routing.Peer{}), WithPeerAllowlist(allowlist))
+			require.NoError(t, err)
+
+			// Only the allowed address should remain for fetching.
+			allowedPeer, ok := reg.allowedPeer(peer)
+			require.EqualT(t, tt.expectedStatus == http.StatusOK, ok)
+			if ok {
+				require.SliceEqualT(t, []netip.Addr{addrPort.Addr()}, allowedPeer.Addresses)
+			}
+
+			rw := httptest.NewRecorder()
+			req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, target, nil)
+			reg.Handler(logr.Discard()).ServeHTTP(rw, req)
+			require.EqualT(t, tt.expectedStatus, rw.Result().StatusCode)
+		})
+	}
+}
+
+func TestEgressShaper(t *testing.T) {
+	t.Parallel()
+
+	require.Nil(t, newEgressShaper(0, 0, 0))
+
+	shaper := newEgressShaper(0, 0, 1)
+	release, ok := shaper.Acquire()
+	require.TrueT(t, ok)
+	_, ok = shaper.Acquire()
+	require.FalseT(t, ok)
+	release()
+	release, ok = shaper.Acquire()
+	require.TrueT(t, ok)
+	release()
+	buf := &bytes.Buffer{}
+	require.Equal(t, io.Writer(buf), shaper.Writer(t.Context(), buf, "foo"))
+
+	synctest.Test(t, func(t *testing.T) {
+		// The bucket starts full so only the bytes above the burst are delayed.
+		shaper := newEgressShaper(64*1024, 0, 0)
+		buf := &bytes.Buffer{}
+		start := time.Now()
+		n, err := shaper.Writer(t.Context(), buf, "foo").Write(make([]byte, 3*64*1024))
+		require.NoError(t, err)
+		require.EqualT(t, 3*64*1024, n)
+		require.EqualT(t, 2*time.Second, time.Since(start))
+	})
+
+	synctest.Test(t, func(t *testing.T) {
+		// Clients are limited independently of each other.
+		shaper := newEgressShaper(0, 32*1024, 0)
+		for _, client := range []string{"foo", "bar"} {
+			start := time.Now()
+			_, err := shaper.Writer(t.Context(), &bytes.Buffer{}, client).Write(make([]byte, 2*32*1024))
+			require.NoError(t, err)
+			require.EqualT(t, time.Second, time.Since(start))
+		}
+	})
+
+	synctest.Test(t, func(t *testing.T) {
+		shaper := newEgressShaper(32*1024, 0, 0)
+		ctx, cancel := context.WithTimeout(t.Context(), 500*time.Millisecond)
+		defer cancel()
+		n, err := shaper.Writer(ctx, &bytes.Buffer{}, "foo").Write(make([]byte, 2*32*1024))
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		require.EqualT(t, 32*1024, n)
+	})
+}
+
+func TestMaxConcurrentUploads(t *testing.T) {
+	t.Parallel()
+
+	blobDesc := ocispec.Descriptor{Digest: digest.Digest("sha256:c8dc81dabe7ad5e801191aade7c87fb806d0ef9ce9b699d2e9598337f57f14d0"), MediaType: "dummy"}
+	store := oci.NewMemory()
+	err := store.Write(nil, blobDesc, []byte("Lorem Ipsum Dolor"))
+	require.NoError(t, err)
+	reg, err := NewRegistry(store, routing.NewMemoryRouter(map[string][]routing.Peer{}, routing.Peer{}), WithMaxConcurrentUploads(1))
+	require.NoError(t, err)
+	target := fmt.Sprintf("http://example.com/v2/foo/bar/blobs/%s?ns=docker.io", blobDesc.Digest)
+
+	release, ok := reg.egressShaper.Acquire()
+	require.TrueT(t, ok)
+
+	// Requests from peers are rejected, with or without the mirror header, while local requests are still served.
+	for _, mirrored := range []bool{true, false} {
+		rw := httptest.NewRecorder()
+		req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, target, nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		if mirrored {
+			req.Header.Set(HeaderSpegelMirrored, "true")
+		}
+		reg.Handler(logr.Discard()).ServeHTTP(rw, req)
+		require.EqualT(t, http.StatusServiceUnavailable, rw.Result().StatusCode)
+		require.Contains(t, rw.Body.String(), string(oci.ErrCodeTooManyRequests))
+	}
+
+	rw := httptest.NewRecorder()
+	req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, target, nil)
+	req.RemoteAddr = "127.0.0.1:1234"
+	req.Header.Set(HeaderSpegelMirrored, "true")
+	reg.Handler(logr.Discard()).ServeHTTP(rw, req)
+	require.EqualT(t, http.StatusOK, rw.Result().StatusCode)
+
+	release()
+	rw = httptest.NewRecorder()
+	req = httptest.NewRequestWithContext(t.Context(), http.MethodGet, target, nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	req.Header.Set(HeaderSpegelMirrored, "true")
+	reg.Handler(logr.Discard()).ServeHTTP(rw, req)
+	require.EqualT(t, http.StatusOK, rw.Result().StatusCode)
+	require.EqualT(t, "Lorem Ipsum Dolor", rw.Body.String())
+}
+
+func TestLoadMeter(t *testing.T) {
+	t.Parallel()
+
+	synctest.Test(t, func(t *testing.T) {
+		meter := newLoadMeter()
+		require.EqualT(t, routing.PeerLoad{}, meter.Load())
+
+		done := meter.Start()
+		_, err := meter.Writer(io.Discard).Write(make([]byte, 2048))
+		require.NoError(t, err)
+		require.EqualT(t, routing.PeerLoad{Uploads: 1}, meter.Load())
+
+		// The rate is reported once the window has passed.
+		time.Sleep(2 * time.Second)
+		require.EqualT(t, routing.PeerLoad{Uploads: 1, EgressRate: 1024}, meter.Load())
+		done()
+		time.Sleep(time.Second)
+		require.EqualT(t, routing.PeerLoad{}, meter.Load())
+	})
+}
+
+func TestPeerLoad(t *testing.T) {
+	t.Parallel()
+
+	blobDesc := ocispec.Descriptor{Digest: digest.Digest("sha256:c8dc81dabe7ad5e801191aade7c87fb806d0ef9ce9b699d2e9598337f57f14d0"), MediaType: "dummy"}
+	peerStore := oci.NewMemory()
+	err := peerStore.Write(nil, blobDesc, []byte("Lorem Ipsum Dolor"))
+	require.NoError(t, err)
+	peerReg, err := NewRegistry(peerStore, routing.NewMemoryRouter(map[string][]routing.Peer{}, routing.Peer{}))
+	require.NoError(t, err)
+	peerSvr := httptest.NewServer(peerReg.Handler(logr.Discard()))
+	t.Cleanup(func() {
+		peerSvr.Close()
+	})
+	addrPort := netip.MustParseAddrPort(peerSvr.Listener.Addr().String())
+	peer := routing.Peer{
+		Host:      "peer",
+		Addresses: []netip.Addr{addrPort.Addr()},
+		Metadata: routing.PeerMetadata{
+			RegistryPort: addrPort.Port(),
+		},
+	}
+	resolver := map[string][]routing.Peer{
+		blobDesc.Digest.String(): {peer},
+	}
+	target := fmt.Sprintf("http://example.com/v2/foo/bar/blobs/%s?ns=docker.io", blobDesc.Digest)
+
+	// Mirrored requests are responded to with the current load.
+	done := peerReg.loadMeter.Start()
+	defer done()
+	rw := httptest.NewRecorder()
+	req := httptest.NewRequestWithContext(t.Context(), http.MethodHead, target, nil)
+	req.Header.Set(HeaderSpegelMirrored, "true")
+	peerReg.Handler(logr.Discard()).ServeHTTP(rw, req)
+	require.EqualT(t, http.StatusOK, rw.Result().StatusCode)
+	require.EqualT(t, "uploads=1;egress-rate=0", rw.Header().Get(HeaderSpegelLoad))
+
+	// Load reported by the peer is tracked when fetching from it.
+	loadTracker := routing.NewLoadTracker()
+	reg, err := NewRegistry(oci.NewMemory(), routing.NewMemoryRouter(resolver, routing.Peer{}), WithPeerLoadTracker(loadTracker))
+	require.NoError(t, err)
+	rw = httptest.NewRecorder()
+	req = httptest.NewRequestWithContext(t.Context(), http.MethodGet, target, nil)
+	reg.Handler(logr.Discard()).ServeHTTP(rw, req)
+	require.EqualT(t, http.StatusOK, rw.Result().StatusCode)
+	require.EqualT(t, routing.PeerLoad{Uploads: 1}, loadTracker.Get(peer.Host))
+}
+
+func TestPeerScoreboard(t *testing.T) {
+	t.Parallel()
+
+	blobDesc := ocispec.Descriptor{Digest: digest.Digest("sha256:c8dc81dabe7ad5e801191aade7c87fb806d0ef9ce9b699d2e9598337f57f14d0"), MediaType: "dummy"}
+	peerStore := oci.NewMemory()
+	err := peerStore.Write(nil, blobDesc, []byte("Lorem Ipsum Dolor"))
+	require.NoError(t, err)
+	peerReg, err := NewRegistry(peerStore, routing.NewMemoryRouter(map[string][]routing.Peer{}, routing.Peer{}))
+	require.NoError(t, err)
+
+	handlers := map[string]http.Handler{
+		"healthy": peerReg.Handler(logr.Discard()),
+		"broken": http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			rw.WriteHeader(http.StatusInternalServerError)
+		}),
+		"saturated": http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			rw.WriteHeader(http.StatusServiceUnavailable)
+		}),
+	}
+	peers := []routing.Peer{}
+	for host, handler := range handlers {
+		peerSvr := httptest.NewServer(handler)
+		t.Cleanup(func() {
+			peerSvr.Close()
+		})
+		addrPort := netip.MustParseAddrPort(peerSvr.Listener.Addr().String())
+		peers = append(peers, routing.Peer{
+			Host:      host,
+			Addresses: []netip.Addr{addrPort.Addr()},
+			Metadata: routing.PeerMetadata{
+				RegistryPort: addrPort.Port(),
+			},
+		})
+	}
+	target := fmt.Sprintf("http://example.com/v2/foo/bar/blobs/%s?ns=docker.io", blobDesc.Digest)
+
+	// Results are recorded for each peer fetched from, saturated peers are not considered unhealthy.
+	for _, peer := range peers {
+		scoreboard := routing.NewScoreboard()
+		resolver := map[string][]routing.Peer{
+			blobDesc.Digest.String(): {peer},
+		}
+		reg, err := NewRegistry(oci.NewMemory(), routing.NewMemoryRouter(resolver, routing.Peer{}), WithPeerScoreboard(scoreboard))
+		require.NoError(t, err)
+		rw := httptest.NewRecorder()
+		req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, target, nil)
+		reg.Handler(logr.Discard()).ServeHTTP(rw, req)
+
+		score, ok := scoreboard.Scores()[peer.Host]
+		switch peer.Host {
+		case "healthy":
+			require.EqualT(t, http.StatusOK, rw.Result().StatusCode)
+			require.TrueT(t, ok)
+			require.InDeltaT(t, 1, score.SuccessRate, 0.001)
+		case "broken":
+			require.EqualT(t, http.StatusNotFound, rw.Result().StatusCode)
+			require.TrueT(t, ok)
+			require.EqualT(t, 1, score.ConsecutiveFailures)
+			require.NotEmpty(t, score.LastError)
+		case "saturated":
+			require.EqualT(t, http.StatusNotFound, rw.Result().StatusCode)
+			require.FalseT(t, ok)
+		}
+	}
+}
+
+func TestChunkedFetch(t *testing.T) {
+	t.Parallel()
+
+	_, err := NewRegistry(oci.NewMemory(), nil, WithChunkedFetch(16, 0))
+	require.EqualError(t, err, "chunked fetch requires a concurrency of at least one")
+
+	b := make([]byte, 100)
+	_, err = rand.Read(b)
+	require.NoError(t, err)
+	blobDesc := ocispec.Descriptor{Digest: digest.FromBytes(b), Size: int64(len(b)), MediaType: "dummy"}
+	peerStore := oci.NewMemory()
+	err = peerStore.Write(nil, blobDesc, b)
+	require.NoError(t, err)
+	peerReg, err := NewRegistry(peerStore, routing.NewMemoryRouter(map[string][]routing.Peer{}, routing.Peer{}))
+	require.NoError(t, err)
+
+	peers := []routing.Peer{}
+	rangeRequests := map[string]*atomic.Int64{}
+	for _, host := range []string{"foo", "bar"} {
+		rangeRequests[host] = &atomic.Int64{}
+		peerSvr := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			if req.Header.Get(httpx.HeaderRange) != "" {
+				rangeRequests[host].Add(1)
+			}
+			peerReg.Handler(logr.Discard()).ServeHTTP(rw, req)
+		}))
+		t.Cleanup(func() {
+			peerSvr.Close()
+		})
+		addrPort := netip.MustParseAddrPort(peerSvr.Listener.Addr().String())
+		peers = append(peers, routing.Peer{
+			Host:      host,
+			Addresses: []netip.Addr{addrPort.Addr()},
+			Metadata: routing.PeerMetadata{
+				RegistryPort: addrPort.Port(),
+			},
+		})
+	}
+	// Chunks fetched from the failing peer are retried with the other peers.
+	failingSvr := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusInternalServerError)
+	}))
+	t.Cleanup(func() {
+		failingSvr.Close()
+	})
+	addrPort := netip.MustParseAddrPort(failingSvr.Listener.Addr().String())
+	peers = append(peers, routing.Peer{
+		Host:      "failing",
+		Addresses: []netip.Addr{addrPort.Addr()},
+		Metadata: routing.PeerMetadata{
+			RegistryPort: addrPort.Port(),
+		},
+	})
+	resolver := map[string][]routing.Peer{
+		blobDesc.Digest.String(): peers,
+	}
+	target := fmt.Sprintf("http://example.com/v2/foo/bar/blobs/%s?ns=docker.io", blobDesc.Digest)
+
+	tests := []struct {
+		name           string
+		rng            string
+		expectedBody   []byte
+		expectedStatus int
+	}{
+		{
+			name:           "complete blob",
+			expectedStatus: http.StatusOK,
+			expectedBody:   b,
+		},
+		{
+			name:           "range",
+			rng:            "bytes=10-70",
+			expectedStatus: http.StatusPartialContent,
+			expectedBody:   b[10:71],
+		},
+		{
+			name:           "range within single chunk",
+			rng:            "bytes=90-",
+			expectedStatus: http.StatusPartialContent,
+			expectedBody:   b[90:],
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			reg, err := NewRegistry(oci.NewMemory(), routing.NewMemoryRouter(resolver, routing.Peer{}), WithChunkedFetch(16, 3))
+			require.NoError(t, err)
+			rw := httptest.NewRecorder()
+			req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, target, nil)
+			if tt.rng != "" {
+				req.Header.Set(httpx.HeaderRange, tt.rng)
+			}
+			reg.Handler(logr.Discard()).ServeHTTP(rw, req)
+			require.EqualT(t, tt.expectedStatus, rw.Result().StatusCode)
+			require.Equal(t, tt.expectedBody, rw.Body.Bytes())
+		})
+	}
+
+	// Chunks are fetched from all peers which have the content.
+	t.Cleanup(func() {
+		for host, requests := range rangeRequests {
+			require.Positive(t, requests.Load(), host)
+		}
+	})
+}
+
+// corruptStore serves content which does not match its digest.
+type corruptStore struct {
+	*oci.Memory
+	offset int
+}
+
+func (s *corruptStore) Open(ctx context.Context, dgst digest.Digest) (io.ReadSeekCloser, error) {
+	rc, err := s.Memory.Open(ctx, dgst)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	b, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, err
+	}
+	b[s.offset] ^= 0xff
+	return &bytesReadSeekCloser{Reader: bytes.NewReader(b)}, nil
+}
+
+type bytesReadSeekCloser struct {
+	*bytes.Reader
+}
+
+func (*bytesReadSeekCloser) Close() error {
+	return nil
+}
+
+func TestPeerTLS(t *testing.T) {
+	t.Parallel()
+
+	certReloader, err := httpx.NewCertReloader(filepath.Join("..", "httpx", "testdata", "certs"))
+	require.NoError(t, err)
+
+	blobDesc := ocispec.Descriptor{Digest: digest.Digest("sha256:c8dc81dabe7ad5e801191aade7c87fb806d0ef9ce9b699d2e9598337f57f14d0"), MediaType: "dummy"}
+	peerStore := oci.NewMemory()
+	err = peerStore.Write(nil, blobDesc, []byte("Lorem Ipsum Dolor"))
+	require.NoError(t, err)
+	peerReg, err := NewRegistry(peerStore, routing.NewMemoryRouter(map[string][]routing.Peer{}, routing.Peer{}), WithPeerTLS(certReloader.ClientTLSConfig()))
+	require.NoError(t, err)
+	lis, err := (&net.ListenConfig{}).Listen(t.Context(), "tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	lis = httpx.NewTLSMuxListener(lis, certReloader.ServerTLSConfig())
+	peerSvr := &httptest.Server{
+		Listener: lis,
+		Config:   &http.Server{Handler: peerReg.Handler(logr.Discard())},
+	}
+	peerSvr.Start()
+	t.Cleanup(func() {
+		peerSvr.Close()
+	})
+	addrPort := netip.MustParseAddrPort(lis.Addr().String())
+	peer := routing.Peer{
+		Host:      "peer",
+		Addresses: []netip.Addr{addrPort.Addr()},
+		Metadata: routing.PeerMetadata{
+			RegistryPort: addrPort.Port(),
+		},
+	}
+	resolver := map[string][]routing.Peer{
+		blobDesc.Digest.String(): {peer},
+	}
+	target := fmt.Sprintf("http://example.com/v2/foo/bar/blobs/%s?ns=docker.io", blobDesc.Digest)
+
+	// Peers fetch with a client certificate.
+	reg, err := NewRegistry(oci.NewMemory(), routing.NewMemoryRouter(resolver, routing.Peer{}), WithPeerTLS(certReloader.ClientTLSConfig()))
+	require.NoError(t, err)
+	rw := httptest.NewRecorder()
+	req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, target, nil)
+	req.RemoteAddr = "127.0.0.1:1234"
+	reg.Handler(logr.Discard()).ServeHTTP(rw, req)
+	require.EqualT(t, http.StatusOK, rw.Result().StatusCode)
+	require.EqualT(t, "Lorem Ipsum Dolor", rw.Body.String())
+
+	// Only requests from loopback addresses do not require a client certificate, regardless of the mirrored header.
+	for _, mirrored := range []bool{false, true} {
+		for _, remoteAddr := range []string{"127.0.0.1:1234", "[::1]:1234", "10.0.0.1:1234"} {
+			rw := httptest.NewRecorder()
+			req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, target, nil)
+			req.RemoteAddr = remoteAddr
+			if mirrored {
+				req.Header.Set(HeaderSpegelMirrored, "true")
+			}
+			peerReg.Handler(logr.Discard()).ServeHTTP(rw, req)
+			if remoteAddr == "10.0.0.1:1234" {
+				require.EqualT(t, http.StatusUnauthorized, rw.Result().StatusCode)
+				continue
+			}
+			require.EqualT(t, http.StatusOK, rw.Result().StatusCode)
+		}
+	}
+
+	// Plain HTTP requests from other hosts are rejected.
+	rw = httptest.NewRecorder()
+	req = httptest.NewRequestWithContext(t.Context(), http.MethodGet, "/v2/", nil)
+	peerReg.Handler(logr.Discard()).ServeHTTP(rw, req)
+	require.EqualT(t, http.StatusUnauthorized, rw.Result().StatusCode)
+}
+
+func TestPeerIdentity(t *testing.T) {
+	t.Parallel()
+
+	connected := func(string) bool {
+		return true
+	}
+	_, err := NewRegistry(oci.NewMemory(), nil, WithPeerIdentity(routing.PeerIdentity, connected))
+	require.EqualError(t, err, "peer identity requires peer TLS to be enabled")
+	_, err = NewRegistry(oci.NewMemory(), nil, WithPeerTLS(&tls.Config{MinVersion: tls.VersionTLS13}), WithPeerIdentity(routing.PeerIdentity, nil))
+	require.EqualError(t, err, "peer identity requires connected peers to authenticate requests")
+
+	newPeerTLS := func(t *testing.T) (*routing.PeerTLS, string) {
+		t.Helper()
+
+		privKey, _, err := crypto.GenerateEd25519Key(rand.Reader)
+		require.NoError(t, err)
+		id, err := peer.IDFromPrivateKey(privKey)
+		require.NoError(t, err)
+		peerTLS, err := routing.NewPeerTLS(privKey)
+		require.NoError(t, err)
+		return peerTLS, id.String()
+	}
+	serverTLS, serverID := newPeerTLS(t)
+	clientTLS, clientID := newPeerTLS(t)
+	unknownTLS, _ := newPeerTLS(t)
+
+	blobDesc := ocispec.Descriptor{Digest: digest.Digest("sha256:c8dc81dabe7ad5e801191aade7c87fb806d0ef9ce9b699d2e9598337f57f14d0"), MediaType: "dummy"}
+	peerStore := oci.NewMemory()
+	err = peerStore.Write(nil, blobDesc, []byte("Lorem Ipsum Dolor"))
+	require.NoError(t, err)
+	// Only the client is connected to the router of the server.
+	serverConnected := func(id string) bool {
+		return id == clientID
+	}
+	peerReg, err := NewRegistry(peerStore, routing.NewMemoryRouter(map[string][]routing.Peer{}, routing.Peer{}), WithPeerTLS(serverTLS.ClientTLSConfig()), WithPeerIdentity(routing.PeerIdentity, serverConnected))
+	require.NoError(t, err)
+	lis, err := (&net.ListenConfig{}).Listen(t.Context(), "tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	lis = httpx.NewTLSMuxListener(lis, serverTLS.ServerTLSConfig())
+	peerHandler := peerReg.Handler(logr.Discard())
+	peerSvr := &httptest.Server{
+		Listener: lis,
+		Config: &http.Server{Handler: http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			// Requests from loopback are not authenticated.
+			req.RemoteAddr = "10.0.0.1:1234"
+			peerHandler.ServeHTTP(rw, req)
+		})},
+	}
+	peerSvr.Start()
+	t.Cleanup(func() {
+		peerSvr.Close()
+	})
+	addrPort := netip.MustParseAddrPort(lis.Addr().String())
+
+	tests := []struct {
+		name           string
+		peerTLS        *routing.PeerTLS
+		host           string
+		expectedStatus int
+	}{
+		{
+			name:           "matching identity",
+			peerTLS:        clientTLS,
+			host:           serverID,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "peer does not match server identity",
+			peerTLS:        clientTLS,
+			host:           "stale",
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "client is not connected to server",
+			peerTLS:        unknownTLS,
+			host:           serverID,
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			resolver := map[string][]routing.Peer{
+				blobDesc.Digest.String(): {
+					{
+						Host:      tt.host,
+						Addresses: []netip.Addr{addrPort.Addr()},
+						Metadata: routing.PeerMetadata{
+							RegistryPort: addrPort.Port(),
+						},
+					},
+				},
+			}
+			reg, err := NewRegistry(oci.NewMemory(), routing.NewMemoryRouter(resolver, routing.Peer{}), WithPeerTLS(tt.peerTLS.ClientTLSConfig()), WithPeerIdentity(routing.PeerIdentity, connected))
+			require.NoError(t, err)
+			rw := httptest.NewRecorder()
+			req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, fmt.Sprintf("http://example.com/v2/foo/bar/blobs/%s?ns=docker.io", blobDesc.Digest), nil)
+			req.RemoteAddr = "127.0.0.1:1234"
+			reg.Handler(logr.Discard()).ServeHTTP(rw, req)
+			require.EqualT(t, tt.expectedStatus, rw.Result().StatusCode)
+			if tt.expectedStatus == http.StatusOK {
+				require.EqualT(t, "Lorem Ipsum Dolor", rw.Body.String())
+			}
+		})
+	}
+}
+
+func TestIngestStreaming(t *testing.T) {
+	t.Parallel()
+
+	_, err := NewRegistry(oci.NewMemory(), nil, WithIngestStreaming(true))
+	require.EqualError(t, err, "ingest streaming requires mirror cache to be enabled")
+	_, err = NewRegistry(struct{ oci.WritableStore }{oci.NewMemory()}, nil, WithMirrorCache(true), WithIngestStreaming(true))
+	require.EqualError(t, err, "ingest streaming requires an OCI store which can serve ingested content")
+
+	b := []byte("Lorem Ipsum Dolor")
+	blobDesc := ocispec.Descriptor{Digest: digest.FromBytes(b), MediaType: "dummy", Size: int64(len(b))}
+	store := oci.NewMemory()
+	router := routing.NewMemoryRouter(map[string][]routing.Peer{}, routing.Peer{Host: "self"})
+	reg, err := NewRegistry(store, router, WithMirrorCache(true), WithIngestStreaming(true))
+	require.NoError(t, err)
+	handler := reg.Handler(logr.Discard())
+
+	cw, err := store.Writer(t.Context(), oci.Reference{Registry: "docker.io", Repository: "foo/bar", Digest: blobDesc.Digest}, blobDesc)
+	require.NoError(t, err)
+	_, err = cw.Write(b[:5])
+	require.NoError(t, err)
+
+	// Content being written is served to peers but not to local requests.
+	rw := httptest.NewRecorder()
+	req := httptest.NewRequestWithContext(t.Context(), http.MethodHead, "http://example.com/v2/foo/bar/blobs/"+blobDesc.Digest.String()+"?ns=docker.io", nil)
+	handler.ServeHTTP(rw, req)
+	require.EqualT(t, http.StatusNotFound, rw.Result().StatusCode)
+
+	rw = httptest.NewRecorder()
+	req = httptest.NewRequestWithContext(t.Context(), http.MethodGet, "http://example.com/v2/foo/bar/blobs/"+blobDesc.Digest.String()+"?ns=docker.io", nil)
+	req.Header.Set(HeaderSpegelMirrored, "true")
+	doneCh := make(chan any)
+	go func() {
+		handler.ServeHTTP(rw, req)
+		close(doneCh)
+	}()
+	select {
+	case <-doneCh:
+		t.Fatal("request should block until content is written")
+	case <-time.After(50 * time.Millisecond):
+	}
+	_, err = cw.Write(b[5:])
+	require.NoError(t, err)
+	err = cw.Commit(t.Context())
+	require.NoError(t, err)
+	err = cw.Close()
+	require.NoError(t, err)
+	<-doneCh
+	require.EqualT(t, http.StatusOK, rw.Result().StatusCode)
+	require.EqualT(t, string(b), rw.Body.String())
+
+	// Mirrored blobs are advertised while they are written.
+	peerStore := oci.NewMemory()
+	otherBlob := []byte("foobar")
+	otherDesc := ocispec.Descriptor{Digest: digest.FromBytes(otherBlob), MediaType: "dummy", Size: int64(len(otherBlob))}
+	err = peerStore.Write(nil, otherDesc, otherBlob)
+	require.NoError(t, err)
+	peerReg, err := NewRegistry(peerStore, routing.NewMemoryRouter(map[string][]routing.Peer{}, routing.Peer{}))
+	require.NoError(t, err)
+	peerSvr := httptest.NewServer(peerReg.Handler(logr.Discard()))
+	t.Cleanup(func() {
+		peerSvr.Close()
+	})
+	addrPort := netip.MustParseAddrPort(peerSvr.Listener.Addr().String())
+	peer := routing.Peer{
+		Host:      "peer",
+		Addresses: []netip.Addr{addrPort.Addr()},
+		Metadata: routing.PeerMetadata{
+			RegistryPort: addrPort.Port(),
+		},
+	}
+	router.Add(otherDesc.Digest.String(), peer)
+	rw = httptest.NewRecorder()
+	req = httptest.NewRequestWithContext(t.Context(), http.MethodGet, "http://example.com/v2/foo/bar/blobs/"+otherDesc.Digest.String()+"?ns=docker.io", nil)
+	handler.ServeHTTP(rw, req)
+	require.EqualT(t, http.StatusOK, rw.Result().StatusCode)
+	peers, ok := router.Get(otherDesc.Digest.String())
+	require.True(t, ok)
+	require.Contains(t, peers, routing.Peer{Host: "self"})
+}
+
+func TestFetchChannel(t *testing.T) {
+	t.Parallel()
+
+	synctest.Test(t, func(t *testing.T) {
+		ctx, cancel := context.WithCancel(t.Context())
+		defer cancel()
+
+		hedger := resilient.NewHedger([]float64{50, 90, 99}, time.Second)
+		hedgeKey := func() resilient.HedgeKey {
+			return resilient.HedgeKey{Kind: oci.DistributionKindBlob}
+		}
 
 		iterator := routing.NewIterator()
 		iterator.Add(routing.Peer{Host: "foo"})
 
 		// Fetch triggers immediately and after a fixed time.
-		fetchCh, _ := fetchChannel(ctx, hedger, iterator)
+		fetchCh, _ := fetchChannel(ctx, hedger, iterator, hedgeKey)
 
 		start := time.Now()
 		synctest.Wait()
@@ -594,7 +2126,7 @@ func TestFetchChannel(t *testing.T) {
 		}
 
 		// Fetch skips hedges when immediate are called.
-		fetchCh, immediateCh := fetchChannel(ctx, hedger, iterator)
+		fetchCh, immediateCh := fetchChannel(ctx, hedger, iterator, hedgeKey)
 		immediateCh <- true
 		immediateCh <- true
 		immediateCh <- false
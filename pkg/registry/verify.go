@@ -0,0 +1,240 @@
+package registry
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+
+	"github.com/opencontainers/go-digest"
+
+	"github.com/spegel-org/spegel/pkg/oci"
+	"github.com/spegel-org/spegel/pkg/routing"
+)
+
+var (
+	errDigestMismatch      = errors.New("content does not match digest")
+	errSentContentMismatch = errors.New("content already sent does not match verified content")
+)
+
+// readManifest reads the complete manifest and verifies it against the expected digest.
+// The digest of the descriptor is expected when the manifest is requested by tag.
+func readManifest(res fetchResponse, expected digest.Digest) ([]byte, error) {
+	if expected == "" {
+		expected = res.desc.Digest
+	}
+	if res.desc.Digest != expected {
+		return nil, fmt.Errorf("descriptor digest %s does not match %s: %w", res.desc.Digest, expected, errDigestMismatch)
+	}
+	err := expected.Validate()
+	if err != nil {
+		return nil, err
+	}
+	if res.desc.Size > oci.ManifestMaxSize {
+		return nil, fmt.Errorf("manifest size %d exceeds max size %d", res.desc.Size, oci.ManifestMaxSize)
+	}
+	b, err := io.ReadAll(io.LimitReader(res.rc, oci.ManifestMaxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(b)) != res.desc.Size || expected.Algorithm().FromBytes(b) != expected {
+		return nil, fmt.Errorf("manifest %s: %w", expected, errDigestMismatch)
+	}
+	return b, nil
+}
+
+// sourceFunc returns the source of the content at the offset and the offset up to which content is read from it.
+type sourceFunc func(offset int64) (routing.Peer, int64)
+
+// verifiedSegment is a contiguous range of content read from a single source.
+type verifiedSegment struct {
+	digester digest.Digester
+	peer     routing.Peer
+	start    int64
+	end      int64
+	sent     bool
+}
+
+// segmentComparison hashes content of a later attempt in the range of a segment from a previous attempt.
+type segmentComparison struct {
+	segment  *verifiedSegment
+	digester digest.Digester
+}
+
+func (c *segmentComparison) matches() bool {
+	return c.digester.Digest() == c.segment.digester.Digest()
+}
+
+// digestVerifier verifies content written to it in one or more parts.
+// The last part is only written when the complete content matches the digest.
+// Content is recorded in segments per source, so that the sources which served wrong content
+// can be identified once the content of a later attempt has been verified.
+type digestVerifier struct {
+	verifier    digest.Verifier
+	err         error
+	dgst        digest.Digest
+	prior       []*verifiedSegment
+	segments    []*verifiedSegment
+	comparisons []*segmentComparison
+	size        int64
+	offset      int64
+	sent        int64
+	diverged    bool
+}
+
+func newDigestVerifier(dgst digest.Digest, size int64) *digestVerifier {
+	return &digestVerifier{
+		verifier: dgst.Verifier(),
+		dgst:     dgst,
+		size:     size,
+	}
+}
+
+// Retry returns a verifier for another attempt at fetching the content.
+// Content already sent by previous attempts is compared with the new attempt instead of being written again.
+func (v *digestVerifier) Retry() *digestVerifier {
+	retry := newDigestVerifier(v.dgst, v.size)
+	retry.sent = v.sent
+	retry.prior = append(slices.Clone(v.prior), v.segments...)
+	for _, segment := range retry.prior {
+		retry.comparisons = append(retry.comparisons, &segmentComparison{segment: segment, digester: v.dgst.Algorithm().Digester()})
+	}
+	return retry
+}
+
+// Writer returns a writer that verifies content before writing it to w.
+// Writing stops after the first error.
+func (v *digestVerifier) Writer(w io.Writer, source sourceFunc) io.Writer {
+	return writerFunc(func(p []byte) (int, error) {
+		if v.err != nil {
+			return 0, v.err
+		}
+		skipped := 0
+		if v.offset < v.sent {
+			skipped = int(min(int64(len(p)), v.sent-v.offset))
+			v.record(p[:skipped], source, false)
+			p = p[skipped:]
+			// Content can only continue to be written if the content sent by previous attempts is the same.
+			if v.offset == v.sent {
+				v.diverged = slices.ContainsFunc(v.comparisons, func(c *segmentComparison) bool {
+					return c.segment.sent && !c.matches()
+				})
+			}
+		}
+		if len(p) == 0 {
+			return skipped, nil
+		}
+		if v.diverged {
+			v.record(p, source, false)
+			return skipped + len(p), nil
+		}
+		if v.offset+int64(len(p)) >= v.size {
+			// Verify the digest before writing the last part.
+			v.record(p, source, false)
+			if v.offset != v.size || !v.verifier.Verified() {
+				v.err = fmt.Errorf("blob %s: %w", v.dgst, errDigestMismatch)
+				return skipped, v.err
+			}
+			n, err := w.Write(p)
+			v.sent += int64(n)
+			v.err = err
+			return skipped + n, err
+		}
+		n, err := w.Write(p)
+		v.record(p[:n], source, true)
+		v.sent += int64(n)
+		v.err = err
+		return skipped + n, err
+	})
+}
+
+// record hashes the content read at the current offset.
+func (v *digestVerifier) record(p []byte, source sourceFunc, sent bool) {
+	//nolint: errcheck // Writing to a hash never returns an error.
+	v.verifier.Write(p)
+	end := v.offset + int64(len(p))
+	for _, c := range v.comparisons {
+		start := max(v.offset, c.segment.start)
+		stop := min(end, c.segment.end)
+		if start >= stop {
+			continue
+		}
+		//nolint: errcheck // Writing to a hash never returns an error.
+		c.digester.Hash().Write(p[start-v.offset : stop-v.offset])
+	}
+	for len(p) > 0 {
+		peer, sourceEnd := source(v.offset)
+		n := int64(len(p))
+		if sourceEnd > v.offset {
+			n = min(n, sourceEnd-v.offset)
+		}
+		var segment *verifiedSegment
+		if len(v.segments) > 0 {
+			segment = v.segments[len(v.segments)-1]
+		}
+		if segment == nil || segment.end != v.offset || segment.peer.Host != peer.Host || segment.sent != sent {
+			segment = &verifiedSegment{
+				digester: v.dgst.Algorithm().Digester(),
+				peer:     peer,
+				start:    v.offset,
+				end:      v.offset,
+				sent:     sent,
+			}
+			v.segments = append(v.segments, segment)
+		}
+		//nolint: errcheck // Writing to a hash never returns an error.
+		segment.digester.Hash().Write(p[:n])
+		segment.end += n
+		v.offset += n
+		p = p[n:]
+	}
+}
+
+// Verify returns an error if the content is incomplete or does not match the digest.
+// Verified content which differs from content already sent by a previous attempt is also an error.
+func (v *digestVerifier) Verify() error {
+	if v.err != nil {
+		return v.err
+	}
+	if v.offset < v.size {
+		return io.ErrUnexpectedEOF
+	}
+	// Empty content is never written so it has to be verified here.
+	if !v.verifier.Verified() {
+		v.err = fmt.Errorf("blob %s: %w", v.dgst, errDigestMismatch)
+		return v.err
+	}
+	if v.diverged {
+		v.err = fmt.Errorf("blob %s: %w", v.dgst, errSentContentMismatch)
+		return v.err
+	}
+	return nil
+}
+
+// Sources returns the sources which content has been read from in this attempt.
+func (v *digestVerifier) Sources() []routing.Peer {
+	sources := []routing.Peer{}
+	for _, segment := range v.segments {
+		if slices.ContainsFunc(sources, func(peer routing.Peer) bool { return peer.Host == segment.peer.Host }) {
+			continue
+		}
+		sources = append(sources, segment.peer)
+	}
+	return sources
+}
+
+// Mismatched returns the sources of previous attempts which served content different from the verified content.
+// Nothing is returned until the content of this attempt has been verified.
+func (v *digestVerifier) Mismatched() []routing.Peer {
+	if v.offset != v.size || !v.verifier.Verified() {
+		return nil
+	}
+	mismatched := []routing.Peer{}
+	for _, c := range v.comparisons {
+		if c.matches() || slices.ContainsFunc(mismatched, func(peer routing.Peer) bool { return peer.Host == c.segment.peer.Host }) {
+			continue
+		}
+		mismatched = append(mismatched, c.segment.peer)
+	}
+	return mismatched
+}
@@ -0,0 +1,143 @@
+package routing
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"slices"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/libp2p/go-libp2p/core/connmgr"
+	"github.com/libp2p/go-libp2p/core/control"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	ma "github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
+)
+
+const (
+	allowlistRefreshInterval = 30 * time.Second
+)
+
+// AllowlistSource provides the address prefixes of peers that are allowed.
+type AllowlistSource interface {
+	Prefixes(ctx context.Context) ([]netip.Prefix, error)
+}
+
+var _ AllowlistSource = StaticAllowlistSource{}
+
+// StaticAllowlistSource allows a fixed set of address prefixes.
+type StaticAllowlistSource []netip.Prefix
+
+func (s StaticAllowlistSource) Prefixes(ctx context.Context) ([]netip.Prefix, error) {
+	return s, nil
+}
+
+// Allowlist restricts peers to addresses within the prefixes of its sources.
+// The prefixes are refreshed periodically so that sources can reflect membership changes.
+type Allowlist struct {
+	prefixes atomic.Pointer[[]netip.Prefix]
+	sources  []AllowlistSource
+}
+
+// NewAllowlist creates an allowlist with the current prefixes of the sources.
+func NewAllowlist(ctx context.Context, sources ...AllowlistSource) (*Allowlist, error) {
+	if len(sources) == 0 {
+		return nil, errors.New("allowlist requires at least one source")
+	}
+	a := &Allowlist{
+		sources: sources,
+	}
+	err := a.Refresh(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// Run refreshes the prefixes until the context is cancelled.
+// The previous prefixes are kept when a refresh fails.
+func (a *Allowlist) Run(ctx context.Context) error {
+	log := logr.FromContextOrDiscard(ctx)
+
+	ticker := time.NewTicker(allowlistRefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			err := a.Refresh(ctx)
+			if err != nil {
+				log.Error(err, "could not refresh peer allowlist")
+			}
+		}
+	}
+}
+
+// Refresh replaces the prefixes with the current prefixes of all sources.
+func (a *Allowlist) Refresh(ctx context.Context) error {
+	prefixes := []netip.Prefix{}
+	for _, source := range a.sources {
+		sourcePrefixes, err := source.Prefixes(ctx)
+		if err != nil {
+			return err
+		}
+		for _, prefix := range sourcePrefixes {
+			prefixes = append(prefixes, prefix.Masked())
+		}
+	}
+	a.prefixes.Store(&prefixes)
+	return nil
+}
+
+// Allowed returns true if the address is within any of the prefixes.
+func (a *Allowlist) Allowed(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return slices.ContainsFunc(*a.prefixes.Load(), func(prefix netip.Prefix) bool {
+		return prefix.Contains(addr)
+	})
+}
+
+// AllowedMultiaddr returns true if the IP of the multiaddress is allowed.
+// Multiaddresses without an IP are never allowed.
+func (a *Allowlist) AllowedMultiaddr(maddr ma.Multiaddr) bool {
+	ip, err := manet.ToIP(maddr)
+	if err != nil {
+		return false
+	}
+	addr, ok := netip.AddrFromSlice(ip)
+	if !ok {
+		return false
+	}
+	return a.Allowed(addr)
+}
+
+var _ connmgr.ConnectionGater = &allowlistGater{}
+
+// allowlistGater rejects connections to and from addresses which are not allowed.
+type allowlistGater struct {
+	allowlist *Allowlist
+}
+
+func (g *allowlistGater) InterceptPeerDial(p peer.ID) bool {
+	return true
+}
+
+func (g *allowlistGater) InterceptAddrDial(p peer.ID, maddr ma.Multiaddr) bool {
+	return g.allowlist.AllowedMultiaddr(maddr)
+}
+
+func (g *allowlistGater) InterceptAccept(addrs network.ConnMultiaddrs) bool {
+	return g.allowlist.AllowedMultiaddr(addrs.RemoteMultiaddr())
+}
+
+func (g *allowlistGater) InterceptSecured(dir network.Direction, p peer.ID, addrs network.ConnMultiaddrs) bool {
+	return true
+}
+
+func (g *allowlistGater) InterceptUpgraded(conn network.Conn) (bool, control.DisconnectReason) {
+	return true, 0
+}
@@ -0,0 +1,115 @@
+package routing
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/go-openapi/testify/v2/require"
+	"github.com/libp2p/go-libp2p/core/peer"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+type errorAllowlistSource struct{}
+
+func (errorAllowlistSource) Prefixes(ctx context.Context) ([]netip.Prefix, error) {
+	return nil, errors.New("source error")
+}
+
+func TestAllowlist(t *testing.T) {
+	t.Parallel()
+
+	_, err := NewAllowlist(t.Context())
+	require.EqualError(t, err, "allowlist requires at least one source")
+	_, err = NewAllowlist(t.Context(), StaticAllowlistSource{}, errorAllowlistSource{})
+	require.EqualError(t, err, "source error")
+
+	allowlist, err := NewAllowlist(t.Context(), StaticAllowlistSource{netip.MustParsePrefix("10.0.0.0/16")}, StaticAllowlistSource{netip.MustParsePrefix("fd00::1/128")})
+	require.NoError(t, err)
+
+	//nolint: govet // Prioritize readability in tests.
+	tests := []struct {
+		addr     string
+		expected bool
+	}{
+		{addr: "10.0.0.1", expected: true},
+		{addr: "10.0.255.255", expected: true},
+		{addr: "::ffff:10.0.1.1", expected: true},
+		{addr: "10.1.0.1", expected: false},
+		{addr: "fd00::1", expected: true},
+		{addr: "fd00::2", expected: false},
+	}
+	for _, tt := range tests {
+		require.EqualT(t, tt.expected, allowlist.Allowed(netip.MustParseAddr(tt.addr)), tt.addr)
+	}
+
+	require.TrueT(t, allowlist.AllowedMultiaddr(ma.StringCast("/ip4/10.0.0.1/tcp/5001")))
+	require.TrueT(t, allowlist.AllowedMultiaddr(ma.StringCast("/ip6/fd00::1/udp/5001/quic-v1")))
+	require.FalseT(t, allowlist.AllowedMultiaddr(ma.StringCast("/ip4/192.168.1.1/tcp/5001")))
+	require.FalseT(t, allowlist.AllowedMultiaddr(ma.StringCast("/dns4/example.com/tcp/5001")))
+}
+
+func TestAllowlistGater(t *testing.T) {
+	t.Parallel()
+
+	primaryAllowlist, err := NewAllowlist(t.Context(), StaticAllowlistSource{netip.MustParsePrefix("127.0.0.0/8")})
+	require.NoError(t, err)
+	primaryRouter, err := NewP2PRouter(t.Context(), "127.0.0.1:0", NewStaticBootstrapper(nil), "9090", WithAllowlist(primaryAllowlist))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		require.NoError(t, primaryRouter.host.Close())
+	})
+	primaryInfo := peer.AddrInfo{ID: primaryRouter.host.ID(), Addrs: primaryRouter.host.Network().ListenAddresses()}
+
+	tests := []struct {
+		name      string
+		prefix    string
+		expectErr bool
+	}{
+		{
+			name:   "allowed",
+			prefix: "127.0.0.0/8",
+		},
+		{
+			name:      "dial not allowed",
+			prefix:    "10.0.0.0/8",
+			expectErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			allowlist, err := NewAllowlist(t.Context(), StaticAllowlistSource{netip.MustParsePrefix(tt.prefix)})
+			require.NoError(t, err)
+			router, err := NewP2PRouter(t.Context(), "127.0.0.1:0", NewStaticBootstrapper(nil), "9090", WithAllowlist(allowlist))
+			require.NoError(t, err)
+			t.Cleanup(func() {
+				require.NoError(t, router.host.Close())
+			})
+			ctx, cancel := context.WithTimeout(t.Context(), 5*time.Second)
+			defer cancel()
+			err = router.host.Connect(ctx, primaryInfo)
+			if tt.expectErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+
+	// Connections from peers outside the allowlist are not accepted.
+	deniedAllowlist, err := NewAllowlist(t.Context(), StaticAllowlistSource{netip.MustParsePrefix("10.0.0.0/8")})
+	require.NoError(t, err)
+	deniedRouter, err := NewP2PRouter(t.Context(), "127.0.0.1:0", NewStaticBootstrapper(nil), "9090", WithAllowlist(deniedAllowlist))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		require.NoError(t, deniedRouter.host.Close())
+	})
+	ctx, cancel := context.WithTimeout(t.Context(), 5*time.Second)
+	defer cancel()
+	err = primaryRouter.host.Connect(ctx, peer.AddrInfo{ID: deniedRouter.host.ID(), Addrs: deniedRouter.host.Network().ListenAddresses()})
+	require.Error(t, err)
+}
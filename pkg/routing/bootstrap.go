@@ -15,6 +15,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/go-logr/logr"
 	"github.com/libp2p/go-libp2p/core/peer"
 	ma "github.com/multiformats/go-multiaddr"
 	manet "github.com/multiformats/go-multiaddr/net"
@@ -34,6 +35,14 @@ type Bootstrapper interface {
 	Get(ctx context.Context) ([]peer.AddrInfo, error)
 }
 
+// NotifyingBootstrapper is a Bootstrapper which signals when the bootstrap peers change.
+// The router bootstraps again when signaled instead of waiting for the periodic bootstrap.
+type NotifyingBootstrapper interface {
+	Bootstrapper
+	// Changed returns a channel which receives a value when the bootstrap peers have changed.
+	Changed() <-chan any
+}
+
 var _ Bootstrapper = &StaticBootstrapper{}
 
 type StaticBootstrapper struct {
@@ -76,6 +85,103 @@ func (b *StaticBootstrapper) Add(peer peer.AddrInfo) {
 	b.peers = append(b.peers, peer)
 }
 
+var _ NotifyingBootstrapper = &MultiBootstrapper{}
+
+// MultiBootstrapper combines the peers of multiple bootstrappers in order.
+// Bootstrappers which fail are skipped so that a single misconfigured source does not isolate the peer.
+type MultiBootstrapper struct {
+	changedCh     chan any
+	bootstrappers []Bootstrapper
+}
+
+func NewMultiBootstrapper(bootstrappers ...Bootstrapper) *MultiBootstrapper {
+	return &MultiBootstrapper{
+		bootstrappers: bootstrappers,
+		changedCh:     make(chan any, 1),
+	}
+}
+
+// Run runs all bootstrappers, an error is only returned if all of them fail.
+func (b *MultiBootstrapper) Run(ctx context.Context, addrInfo peer.AddrInfo) error {
+	log := logr.FromContextOrDiscard(ctx)
+
+	// Changes are forwarded until all bootstrappers have stopped running.
+	forwardCtx, forwardCancel := context.WithCancel(ctx)
+	forwardWg := sync.WaitGroup{}
+
+	errs := make([]error, len(b.bootstrappers))
+	runWg := sync.WaitGroup{}
+	for i, bs := range b.bootstrappers {
+		runWg.Go(func() {
+			err := bs.Run(ctx, addrInfo)
+			if err != nil {
+				log.Error(err, "bootstrapper stopped running", "index", i)
+				errs[i] = err
+			}
+		})
+		notifier, ok := bs.(NotifyingBootstrapper)
+		if !ok {
+			continue
+		}
+		forwardWg.Go(func() {
+			for {
+				select {
+				case <-forwardCtx.Done():
+					return
+				case <-notifier.Changed():
+					select {
+					case b.changedCh <- nil:
+					default:
+					}
+				}
+			}
+		})
+	}
+	runWg.Wait()
+	forwardCancel()
+	forwardWg.Wait()
+	if !slices.Contains(errs, nil) {
+		return errors.Join(errs...)
+	}
+	return nil
+}
+
+// Get returns the deduplicated peers of all bootstrappers, keeping the order of the bootstrappers.
+// An error is only returned if all bootstrappers fail.
+func (b *MultiBootstrapper) Get(ctx context.Context) ([]peer.AddrInfo, error) {
+	errs := []error{}
+	addrInfos := []peer.AddrInfo{}
+	for _, bs := range b.bootstrappers {
+		bsAddrInfos, err := bs.Get(ctx)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		for _, addrInfo := range bsAddrInfos {
+			exists := slices.ContainsFunc(addrInfos, func(existing peer.AddrInfo) bool {
+				if existing.ID != "" || addrInfo.ID != "" {
+					return existing.ID == addrInfo.ID
+				}
+				return slices.EqualFunc(existing.Addrs, addrInfo.Addrs, func(a, b ma.Multiaddr) bool {
+					return a.Equal(b)
+				})
+			})
+			if exists {
+				continue
+			}
+			addrInfos = append(addrInfos, addrInfo)
+		}
+	}
+	if len(errs) == len(b.bootstrappers) {
+		return nil, errors.Join(errs...)
+	}
+	return addrInfos, nil
+}
+
+func (b *MultiBootstrapper) Changed() <-chan any {
+	return b.changedCh
+}
+
 var _ Bootstrapper = &DNSBootstrapper{}
 
 type DNSBootstrapper struct {
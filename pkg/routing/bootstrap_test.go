@@ -9,6 +9,7 @@ import (
 	"crypto/x509/pkix"
 	"encoding/json"
 	"encoding/pem"
+	"errors"
 	"math/big"
 	"net"
 	"net/http"
@@ -56,6 +57,93 @@ func TestStaticBootstrap(t *testing.T) {
 	require.NoError(t, err)
 }
 
+type errorBootstrapper struct {
+	changedCh chan any
+}
+
+func (b *errorBootstrapper) Run(ctx context.Context, addrInfo peer.AddrInfo) error {
+	return errors.New("run error")
+}
+
+func (b *errorBootstrapper) Get(ctx context.Context) ([]peer.AddrInfo, error) {
+	return nil, errors.New("get error")
+}
+
+func (b *errorBootstrapper) Changed() <-chan any {
+	return b.changedCh
+}
+
+func TestMultiBootstrap(t *testing.T) {
+	t.Parallel()
+
+	errorBs := &errorBootstrapper{changedCh: make(chan any)}
+	firstBs := NewStaticBootstrapper([]peer.AddrInfo{
+		{
+			ID:    "foo",
+			Addrs: []ma.Multiaddr{ma.StringCast("/ip4/192.168.1.1")},
+		},
+		{
+			Addrs: []ma.Multiaddr{ma.StringCast("/ip4/192.168.1.2")},
+		},
+	})
+	secondBs := NewStaticBootstrapper([]peer.AddrInfo{
+		{
+			ID:    "foo",
+			Addrs: []ma.Multiaddr{ma.StringCast("/ip4/192.168.1.3")},
+		},
+		{
+			Addrs: []ma.Multiaddr{ma.StringCast("/ip4/192.168.1.2")},
+		},
+		{
+			ID:    "bar",
+			Addrs: []ma.Multiaddr{ma.StringCast("/ip4/192.168.1.4")},
+		},
+	})
+	bs := NewMultiBootstrapper(errorBs, firstBs, secondBs)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	group := errgroup.WithContext(ctx)
+	group.Go(func(ctx context.Context) error {
+		return bs.Run(ctx, peer.AddrInfo{})
+	})
+
+	bsPeers, err := bs.Get(t.Context())
+	require.NoError(t, err)
+	expected := []peer.AddrInfo{
+		{
+			ID:    "foo",
+			Addrs: []ma.Multiaddr{ma.StringCast("/ip4/192.168.1.1")},
+		},
+		{
+			Addrs: []ma.Multiaddr{ma.StringCast("/ip4/192.168.1.2")},
+		},
+		{
+			ID:    "bar",
+			Addrs: []ma.Multiaddr{ma.StringCast("/ip4/192.168.1.4")},
+		},
+	}
+	require.Equal(t, expected, bsPeers)
+
+	// Changes should be forwarded from notifying bootstrappers.
+	errorBs.changedCh <- nil
+	select {
+	case <-bs.Changed():
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected change to be forwarded")
+	}
+
+	cancel()
+	err = group.Wait()
+	require.NoError(t, err)
+
+	// Errors are only returned when all bootstrappers fail.
+	bs = NewMultiBootstrapper(errorBs, &errorBootstrapper{})
+	_, err = bs.Get(t.Context())
+	require.EqualError(t, err, "get error\nget error")
+	err = bs.Run(t.Context(), peer.AddrInfo{})
+	require.EqualError(t, err, "run error\nrun error")
+}
+
 func TestDNSBootstrap(t *testing.T) {
 	t.Parallel()
 
@@ -15,9 +15,41 @@ type Peer struct {
 
 // PeerMetadata contains additional information for the peer.
 type PeerMetadata struct {
+	Topology     Topology
+	Locality     Locality
 	RegistryPort uint16
 }
 
+type IteratorConfig struct {
+	LoadTracker    *LoadTracker
+	Scoreboard     *Scoreboard
+	TopologyPolicy TopologyPolicy
+}
+
+// IteratorOption configures the iterator, options cannot fail so that creating an iterator never returns an error.
+type IteratorOption func(cfg *IteratorConfig)
+
+// WithLoadTracker weights the selection of peers by the load they report.
+func WithLoadTracker(tracker *LoadTracker) IteratorOption {
+	return func(cfg *IteratorConfig) {
+		cfg.LoadTracker = tracker
+	}
+}
+
+// WithScoreboard excludes peers which are not allowed by their circuit breaker from being added.
+func WithScoreboard(scoreboard *Scoreboard) IteratorOption {
+	return func(cfg *IteratorConfig) {
+		cfg.Scoreboard = scoreboard
+	}
+}
+
+// WithTopologyPolicy sets the policy used to prefer peers based on their locality.
+func WithTopologyPolicy(policy TopologyPolicy) IteratorOption {
+	return func(cfg *IteratorConfig) {
+		cfg.TopologyPolicy = policy
+	}
+}
+
 // Iterator maintains track of peers for a given lookup.
 type Iterator struct {
 	acquired    map[string]any
@@ -26,11 +58,24 @@ type Iterator struct {
 	exhaustedCh chan any
 	readyCh     chan any
 	lastUpdate  time.Time
+	loads       *LoadTracker
+	scoreboard  *Scoreboard
+	policy      TopologyPolicy
 	mx          sync.RWMutex
 	closed      bool
 }
 
-func NewIterator() *Iterator {
+func NewIterator(opts ...IteratorOption) *Iterator {
+	cfg := IteratorConfig{
+		TopologyPolicy: TopologyPolicyNone,
+	}
+	for _, opt := range opts {
+		if opt == nil {
+			continue
+		}
+		opt(&cfg)
+	}
+
 	return &Iterator{
 		acquired:    map[string]any{},
 		peers:       map[string]Peer{},
@@ -38,6 +83,9 @@ func NewIterator() *Iterator {
 		exhaustedCh: make(chan any),
 		readyCh:     make(chan any),
 		lastUpdate:  time.Now(),
+		loads:       cfg.LoadTracker,
+		scoreboard:  cfg.Scoreboard,
+		policy:      cfg.TopologyPolicy,
 		closed:      false,
 	}
 }
@@ -60,10 +108,15 @@ func (it *Iterator) Count() int {
 
 // Add adds a peer to the iterator.
 // If iterator was previously empty the iterator will become ready.
+// Peers with an open circuit in the scoreboard are not added.
 func (it *Iterator) Add(peer Peer) {
 	it.mx.Lock()
 	defer it.mx.Unlock()
 
+	if it.scoreboard != nil && !it.scoreboard.Allow(peer.Host) {
+		return
+	}
+
 	peerCount := len(it.peers)
 	it.peers[peer.Host] = peer
 	if len(it.peers) != peerCount && len(it.peers) == 1 {
@@ -92,35 +145,66 @@ func (it *Iterator) Remove(peer Peer) {
 	}
 }
 
-// Acquire gets the least used peer in the iterator.
+// Acquire gets the least used peer in the iterator which has not been acquired.
+// Peers with a preferred locality according to the topology policy are selected first.
+// Uploads reported by peers count as usage, with the egress rate breaking ties.
 // If all peers have been acquired the iterator becomes not ready.
 func (it *Iterator) Acquire() (Peer, bool) {
 	it.mx.Lock()
 	defer it.mx.Unlock()
 
+	peer, ok := it.next()
+	if !ok {
+		return Peer{}, false
+	}
+	it.usage[peer.Host] += 1
+	it.acquired[peer.Host] = nil
+
+	// No longer ready if all peers have been acquired.
+	if len(it.peers) == len(it.acquired) {
+		it.readyCh = make(chan any)
+	}
+
+	return peer, true
+}
+
+// Next returns the peer which would be acquired next without acquiring it.
+// Peers which are equally preferred are selected in random order, so a different peer with the same preference may be acquired.
+func (it *Iterator) Next() (Peer, bool) {
+	it.mx.RLock()
+	defer it.mx.RUnlock()
+
+	return it.next()
+}
+
+func (it *Iterator) next() (Peer, bool) {
 	// If empty or all peers have been acquired.
 	if len(it.peers) == 0 || len(it.peers) == len(it.acquired) {
 		return Peer{}, false
 	}
 
-	// Select the least used peer.
+	// Select the least used peer with the best rank.
 	peer := Peer{}
+	rank := -1
 	count := -1
+	egressRate := int64(0)
 	for _, v := range it.peers {
-		if count == -1 || it.usage[v.Host] < count {
+		if _, ok := it.acquired[v.Host]; ok {
+			continue
+		}
+		vRank := it.policy.rank(v.Metadata.Locality)
+		vLoad := PeerLoad{}
+		if it.loads != nil {
+			vLoad = it.loads.Get(v.Host)
+		}
+		vCount := it.usage[v.Host] + vLoad.Uploads
+		if count == -1 || vRank < rank || (vRank == rank && (vCount < count || (vCount == count && vLoad.EgressRate < egressRate))) {
 			peer = v
-			count = it.usage[v.Host]
+			rank = vRank
+			count = vCount
+			egressRate = vLoad.EgressRate
 		}
-
-	}
-	it.usage[peer.Host] += 1
-	it.acquired[peer.Host] = nil
-
-	// No longer ready if all peers have been acquired.
-	if len(it.peers) == len(it.acquired) {
-		it.readyCh = make(chan any)
 	}
-
 	return peer, true
 }
 
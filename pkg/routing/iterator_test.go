@@ -131,3 +131,146 @@ func TestIterator(t *testing.T) {
 		require.EqualT(t, 5*time.Second, iter.TimeSinceUpdate())
 	})
 }
+
+func TestIteratorTopologyPolicy(t *testing.T) {
+	t.Parallel()
+
+	peers := []Peer{
+		{Host: "remote", Metadata: PeerMetadata{Locality: LocalityRemote}},
+		{Host: "region", Metadata: PeerMetadata{Locality: LocalityRegion}},
+		{Host: "zone", Metadata: PeerMetadata{Locality: LocalityZone}},
+		{Host: "unknown", Metadata: PeerMetadata{Locality: LocalityUnknown}},
+	}
+
+	//nolint: govet // Prioritize readability in tests.
+	tests := []struct {
+		name     string
+		policy   TopologyPolicy
+		expected []string
+	}{
+		{
+			name:     "zone",
+			policy:   TopologyPolicyZone,
+			expected: []string{"zone", "region"},
+		},
+		{
+			name:     "region",
+			policy:   TopologyPolicyRegion,
+			expected: []string{"region", "zone"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			iter := NewIterator(WithTopologyPolicy(tt.policy))
+			for _, peer := range peers {
+				iter.Add(peer)
+			}
+
+			// Peers are acquired by rank, the order within a rank depends on usage.
+			acquired := []string{}
+			for range len(tt.expected) {
+				peer, ok := iter.Acquire()
+				require.TrueT(t, ok)
+				acquired = append(acquired, peer.Host)
+			}
+			require.ElementsMatch(t, tt.expected, acquired)
+			for range 2 {
+				peer, ok := iter.Acquire()
+				require.TrueT(t, ok)
+				require.Contains(t, []string{"remote", "unknown"}, peer.Host)
+			}
+			_, ok := iter.Acquire()
+			require.FalseT(t, ok)
+		})
+	}
+
+	// Preferred peers are acquired again even if other peers are less used.
+	iter := NewIterator(WithTopologyPolicy(TopologyPolicyZone))
+	for _, peer := range peers {
+		iter.Add(peer)
+	}
+	peer, ok := iter.Acquire()
+	require.TrueT(t, ok)
+	require.EqualT(t, "zone", peer.Host)
+	iter.Release(peer)
+	peer, ok = iter.Acquire()
+	require.TrueT(t, ok)
+	require.EqualT(t, "zone", peer.Host)
+}
+
+func TestIteratorNext(t *testing.T) {
+	t.Parallel()
+
+	tracker := NewLoadTracker()
+	tracker.Update("busy", PeerLoad{Uploads: 5})
+	iter := NewIterator(WithLoadTracker(tracker))
+	_, ok := iter.Next()
+	require.FalseT(t, ok)
+	for _, host := range []string{"busy", "idle"} {
+		iter.Add(Peer{Host: host})
+	}
+
+	// Next does not acquire the peer.
+	for _, host := range []string{"idle", "busy"} {
+		peer, ok := iter.Next()
+		require.TrueT(t, ok)
+		require.EqualT(t, host, peer.Host)
+		peer, ok = iter.Next()
+		require.TrueT(t, ok)
+		require.EqualT(t, host, peer.Host)
+		peer, ok = iter.Acquire()
+		require.TrueT(t, ok)
+		require.EqualT(t, host, peer.Host)
+	}
+	_, ok = iter.Next()
+	require.FalseT(t, ok)
+}
+
+func TestIteratorLoadTracker(t *testing.T) {
+	t.Parallel()
+
+	tracker := NewLoadTracker()
+	tracker.Update("busy", PeerLoad{Uploads: 5})
+	tracker.Update("fast", PeerLoad{Uploads: 1, EgressRate: 10})
+	tracker.Update("slow", PeerLoad{Uploads: 1, EgressRate: 1000})
+	iter := NewIterator(WithLoadTracker(tracker))
+	for _, host := range []string{"busy", "slow", "fast"} {
+		iter.Add(Peer{Host: host})
+	}
+
+	// Reported uploads count as usage with the egress rate breaking ties.
+	expected := []string{"fast", "slow", "busy"}
+	for _, host := range expected {
+		peer, ok := iter.Acquire()
+		require.TrueT(t, ok)
+		require.EqualT(t, host, peer.Host)
+	}
+	for _, host := range expected {
+		iter.Release(Peer{Host: host})
+	}
+	for range 4 {
+		peer, ok := iter.Acquire()
+		require.TrueT(t, ok)
+		require.NotEqual(t, "busy", peer.Host)
+		iter.Release(peer)
+	}
+}
+
+func TestIteratorScoreboard(t *testing.T) {
+	t.Parallel()
+
+	scoreboard := NewScoreboard()
+	for range scoreboardFailureThreshold {
+		scoreboard.RecordFailure("broken", nil)
+	}
+	iter := NewIterator(WithScoreboard(scoreboard))
+	iter.Add(Peer{Host: "broken"})
+	require.EqualT(t, 0, iter.Count())
+	iter.Add(Peer{Host: "healthy"})
+	require.EqualT(t, 1, iter.Count())
+	peer, ok := iter.Acquire()
+	require.TrueT(t, ok)
+	require.EqualT(t, "healthy", peer.Host)
+}
@@ -0,0 +1,210 @@
+package routing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/netip"
+	"slices"
+	"sync"
+
+	"github.com/go-logr/logr"
+	"github.com/libp2p/go-libp2p/core/peer"
+	ma "github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	discoveryinformers "k8s.io/client-go/informers/discovery/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+var _ AllowlistSource = &KubernetesNodeSource{}
+
+// KubernetesNodeSource allows the addresses and Pod CIDRs of the Nodes in the cluster.
+// Pod CIDRs are included as peers which do not use host networking are addressed by their Pod IP.
+type KubernetesNodeSource struct {
+	client kubernetes.Interface
+}
+
+func NewKubernetesNodeSource(client kubernetes.Interface) *KubernetesNodeSource {
+	return &KubernetesNodeSource{
+		client: client,
+	}
+}
+
+func (s *KubernetesNodeSource) Prefixes(ctx context.Context) ([]netip.Prefix, error) {
+	nodes, err := s.client.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	prefixes := []netip.Prefix{}
+	for _, node := range nodes.Items {
+		for _, nodeAddr := range node.Status.Addresses {
+			if nodeAddr.Type != corev1.NodeInternalIP && nodeAddr.Type != corev1.NodeExternalIP {
+				continue
+			}
+			addr, err := netip.ParseAddr(nodeAddr.Address)
+			if err != nil {
+				return nil, fmt.Errorf("invalid address %s for node %s: %w", nodeAddr.Address, node.Name, err)
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+		}
+		for _, podCIDR := range node.Spec.PodCIDRs {
+			prefix, err := netip.ParsePrefix(podCIDR)
+			if err != nil {
+				return nil, fmt.Errorf("invalid Pod CIDR %s for node %s: %w", podCIDR, node.Name, err)
+			}
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	return prefixes, nil
+}
+
+// KubernetesNodeTopology returns the topology from the well-known region and zone labels of the Node.
+func KubernetesNodeTopology(ctx context.Context, client kubernetes.Interface, nodeName string) (Topology, error) {
+	node, err := client.CoreV1().Nodes().Get(ctx, nodeName, metav1.GetOptions{})
+	if err != nil {
+		return Topology{}, err
+	}
+	topology := Topology{
+		Region: node.Labels[corev1.LabelTopologyRegion],
+		Zone:   node.Labels[corev1.LabelTopologyZone],
+	}
+	return topology, nil
+}
+
+var _ NotifyingBootstrapper = &KubernetesBootstrapper{}
+
+// KubernetesBootstrapper bootstraps with the endpoints of a Kubernetes service.
+// EndpointSlices are watched so that changes in membership are signaled immediately.
+type KubernetesBootstrapper struct {
+	client      kubernetes.Interface
+	changedCh   chan any
+	namespace   string
+	serviceName string
+	addrInfos   []peer.AddrInfo
+	synced      bool
+	mx          sync.RWMutex
+}
+
+func NewKubernetesBootstrapper(client kubernetes.Interface, namespace, serviceName string) *KubernetesBootstrapper {
+	return &KubernetesBootstrapper{
+		client:      client,
+		namespace:   namespace,
+		serviceName: serviceName,
+		changedCh:   make(chan any, 1),
+	}
+}
+
+func (b *KubernetesBootstrapper) Run(ctx context.Context, addrInfo peer.AddrInfo) error {
+	log := logr.FromContextOrDiscard(ctx)
+
+	selfAddrs, err := toIPAddrs(addrInfo.Addrs)
+	if err != nil {
+		return err
+	}
+	informer := discoveryinformers.NewFilteredEndpointSliceInformer(b.client, b.namespace, 0, cache.Indexers{}, func(opts *metav1.ListOptions) {
+		opts.LabelSelector = fmt.Sprintf("%s=%s", discoveryv1.LabelServiceName, b.serviceName)
+	})
+	update := func() {
+		err := b.update(informer.GetStore().List(), selfAddrs)
+		if err != nil {
+			log.Error(err, "could not update bootstrap peers from EndpointSlices")
+		}
+	}
+	_, err = informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj any) {
+			update()
+		},
+		UpdateFunc: func(oldObj, newObj any) {
+			update()
+		},
+		DeleteFunc: func(obj any) {
+			update()
+		},
+	})
+	if err != nil {
+		return err
+	}
+	go informer.RunWithContext(ctx)
+	if !cache.WaitForCacheSync(ctx.Done(), informer.HasSynced) {
+		return nil
+	}
+	b.mx.Lock()
+	b.synced = true
+	b.mx.Unlock()
+	update()
+	<-ctx.Done()
+	return nil
+}
+
+func (b *KubernetesBootstrapper) Get(ctx context.Context) ([]peer.AddrInfo, error) {
+	b.mx.RLock()
+	defer b.mx.RUnlock()
+	if !b.synced {
+		return nil, errors.New("bootstrap peers have not been synced from EndpointSlices")
+	}
+	return b.addrInfos, nil
+}
+
+func (b *KubernetesBootstrapper) Changed() <-chan any {
+	return b.changedCh
+}
+
+// update sets the addresses of the ready endpoints, excluding the addresses of the local peer.
+func (b *KubernetesBootstrapper) update(objs []any, selfAddrs []netip.Addr) error {
+	ipAddrs := []netip.Addr{}
+	for _, obj := range objs {
+		endpointSlice, ok := obj.(*discoveryv1.EndpointSlice)
+		if !ok {
+			continue
+		}
+		for _, endpoint := range endpointSlice.Endpoints {
+			if endpoint.Conditions.Ready != nil && !*endpoint.Conditions.Ready {
+				continue
+			}
+			if endpoint.Conditions.Terminating != nil && *endpoint.Conditions.Terminating {
+				continue
+			}
+			for _, address := range endpoint.Addresses {
+				ipAddr, err := netip.ParseAddr(address)
+				if err != nil {
+					return err
+				}
+				if slices.Contains(selfAddrs, ipAddr) || slices.Contains(ipAddrs, ipAddr) {
+					continue
+				}
+				ipAddrs = append(ipAddrs, ipAddr)
+			}
+		}
+	}
+	slices.SortFunc(ipAddrs, func(a, b netip.Addr) int {
+		return a.Compare(b)
+	})
+	addrInfos := []peer.AddrInfo{}
+	for _, ipAddr := range ipAddrs {
+		addr, err := manet.FromIPAndZone(ipAddr.AsSlice(), ipAddr.Zone())
+		if err != nil {
+			return err
+		}
+		addrInfos = append(addrInfos, peer.AddrInfo{Addrs: []ma.Multiaddr{addr}})
+	}
+
+	b.mx.Lock()
+	defer b.mx.Unlock()
+	changed := !slices.EqualFunc(b.addrInfos, addrInfos, func(a, b peer.AddrInfo) bool {
+		return a.Addrs[0].Equal(b.Addrs[0])
+	})
+	b.addrInfos = addrInfos
+	// Changes before the initial sync are part of the initial bootstrap.
+	if !changed || !b.synced {
+		return nil
+	}
+	select {
+	case b.changedCh <- nil:
+	default:
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+package routing
+
+import (
+	"context"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/go-openapi/testify/v2/assert"
+	"github.com/go-openapi/testify/v2/require"
+	"github.com/libp2p/go-libp2p/core/peer"
+	ma "github.com/multiformats/go-multiaddr"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/kvick-org/pkg/errgroup"
+)
+
+func TestKubernetesNodeSource(t *testing.T) {
+	t.Parallel()
+
+	nodes := []corev1.Node{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "node-a"},
+			Spec: corev1.NodeSpec{
+				PodCIDRs: []string{"10.244.0.0/24", "fd00:10:244::/64"},
+			},
+			Status: corev1.NodeStatus{
+				Addresses: []corev1.NodeAddress{
+					{Type: corev1.NodeInternalIP, Address: "192.168.1.10"},
+					{Type: corev1.NodeHostName, Address: "node-a"},
+				},
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "node-b"},
+			Status: corev1.NodeStatus{
+				Addresses: []corev1.NodeAddress{
+					{Type: corev1.NodeInternalIP, Address: "fd00::b"},
+					{Type: corev1.NodeExternalIP, Address: "203.0.113.5"},
+					{Type: corev1.NodeInternalDNS, Address: "node-b.local"},
+				},
+			},
+		},
+	}
+	clientset := fake.NewClientset(&nodes[0], &nodes[1])
+	source := NewKubernetesNodeSource(clientset)
+	prefixes, err := source.Prefixes(t.Context())
+	require.NoError(t, err)
+	expected := []netip.Prefix{
+		netip.MustParsePrefix("192.168.1.10/32"),
+		netip.MustParsePrefix("10.244.0.0/24"),
+		netip.MustParsePrefix("fd00:10:244::/64"),
+		netip.MustParsePrefix("fd00::b/128"),
+		netip.MustParsePrefix("203.0.113.5/32"),
+	}
+	require.SliceEqualT(t, expected, prefixes)
+
+	invalid := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-c"},
+		Spec: corev1.NodeSpec{
+			PodCIDRs: []string{"foo"},
+		},
+	}
+	clientset = fake.NewClientset(invalid)
+	source = NewKubernetesNodeSource(clientset)
+	_, err = source.Prefixes(t.Context())
+	require.ErrorContains(t, err, "invalid Pod CIDR foo for node node-c")
+}
+
+func TestKubernetesNodeTopology(t *testing.T) {
+	t.Parallel()
+
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "node-a",
+			Labels: map[string]string{
+				corev1.LabelTopologyRegion: "eu-west-1",
+				corev1.LabelTopologyZone:   "eu-west-1a",
+			},
+		},
+	}
+	clientset := fake.NewClientset(node)
+	topology, err := KubernetesNodeTopology(t.Context(), clientset, "node-a")
+	require.NoError(t, err)
+	require.EqualT(t, Topology{Region: "eu-west-1", Zone: "eu-west-1a"}, topology)
+
+	_, err = KubernetesNodeTopology(t.Context(), clientset, "node-b")
+	require.Error(t, err)
+}
+
+func TestKubernetesBootstrapper(t *testing.T) {
+	t.Parallel()
+
+	ready := true
+	notReady := false
+	endpointSlice := &discoveryv1.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "spegel-bootstrap-abc",
+			Namespace: "spegel",
+			Labels: map[string]string{
+				discoveryv1.LabelServiceName: "spegel-bootstrap",
+			},
+		},
+		Endpoints: []discoveryv1.Endpoint{
+			{Addresses: []string{"10.0.0.2"}},
+			{Addresses: []string{"10.0.0.1"}, Conditions: discoveryv1.EndpointConditions{Ready: &ready}},
+			{Addresses: []string{"10.0.0.3"}, Conditions: discoveryv1.EndpointConditions{Ready: &notReady}},
+			{Addresses: []string{"10.0.0.4"}, Conditions: discoveryv1.EndpointConditions{Terminating: &ready}},
+			{Addresses: []string{"10.0.0.5"}},
+		},
+	}
+	otherEndpointSlice := &discoveryv1.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "other-abc",
+			Namespace: "spegel",
+			Labels: map[string]string{
+				discoveryv1.LabelServiceName: "other",
+			},
+		},
+		Endpoints: []discoveryv1.Endpoint{
+			{Addresses: []string{"10.0.1.1"}},
+		},
+	}
+	clientset := fake.NewClientset(endpointSlice, otherEndpointSlice)
+	bs := NewKubernetesBootstrapper(clientset, "spegel", "spegel-bootstrap")
+
+	_, err := bs.Get(t.Context())
+	require.EqualError(t, err, "bootstrap peers have not been synced from EndpointSlices")
+
+	ctx, cancel := context.WithCancel(t.Context())
+	group := errgroup.WithContext(ctx)
+	group.Go(func(ctx context.Context) error {
+		self := peer.AddrInfo{Addrs: []ma.Multiaddr{ma.StringCast("/ip4/10.0.0.5/tcp/5001")}}
+		return bs.Run(ctx, self)
+	})
+
+	require.EventuallyWith(t, func(c *assert.CollectT) {
+		addrInfos, err := bs.Get(t.Context())
+		require.NoError(c, err)
+		require.Len(c, addrInfos, 2)
+		require.EqualT(c, "/ip4/10.0.0.1", addrInfos[0].Addrs[0].String())
+		require.EqualT(c, "/ip4/10.0.0.2", addrInfos[1].Addrs[0].String())
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// Membership changes should be signaled.
+	newEndpointSlice := &discoveryv1.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "spegel-bootstrap-def",
+			Namespace: "spegel",
+			Labels: map[string]string{
+				discoveryv1.LabelServiceName: "spegel-bootstrap",
+			},
+		},
+		Endpoints: []discoveryv1.Endpoint{
+			{Addresses: []string{"fd00::1"}},
+		},
+	}
+	_, err = clientset.DiscoveryV1().EndpointSlices("spegel").Create(t.Context(), newEndpointSlice, metav1.CreateOptions{})
+	require.NoError(t, err)
+	select {
+	case <-bs.Changed():
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected bootstrap peers to change")
+	}
+	addrInfos, err := bs.Get(t.Context())
+	require.NoError(t, err)
+	require.Len(t, addrInfos, 3)
+	require.EqualT(t, "/ip6/fd00::1", addrInfos[2].Addrs[0].String())
+
+	cancel()
+	err = group.Wait()
+	require.NoError(t, err)
+}
@@ -0,0 +1,104 @@
+package routing
+
+import (
+	"fmt"
+	"maps"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	peerLoadTTL        = 30 * time.Second
+	peerLoadMaxPeers   = 1024
+	peerLoadUploadsKey = "uploads"
+	peerLoadEgressKey  = "egress-rate"
+)
+
+// PeerLoad is the load reported by a peer when serving content.
+type PeerLoad struct {
+	// Uploads is the amount of content currently being served.
+	Uploads int
+	// EgressRate is the rate content is served at in bytes per second.
+	EgressRate int64
+}
+
+// String formats the load as a list of key value pairs.
+func (l PeerLoad) String() string {
+	return fmt.Sprintf("%s=%d;%s=%d", peerLoadUploadsKey, l.Uploads, peerLoadEgressKey, l.EgressRate)
+}
+
+// ParsePeerLoad parses a load formatted with PeerLoad.String.
+// Unknown keys are ignored so that additional signals can be added.
+func ParsePeerLoad(s string) (PeerLoad, error) {
+	load := PeerLoad{}
+	for kv := range strings.SplitSeq(s, ";") {
+		k, v, ok := strings.Cut(strings.TrimSpace(kv), "=")
+		if !ok {
+			return PeerLoad{}, fmt.Errorf("invalid peer load %s", s)
+		}
+		switch k {
+		case peerLoadUploadsKey:
+			uploads, err := strconv.Atoi(v)
+			if err != nil {
+				return PeerLoad{}, err
+			}
+			load.Uploads = uploads
+		case peerLoadEgressKey:
+			egressRate, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				return PeerLoad{}, err
+			}
+			load.EgressRate = egressRate
+		}
+	}
+	return load, nil
+}
+
+// LoadTracker keeps the most recent load reported by each peer.
+// Loads which have not been updated recently are considered unknown.
+type LoadTracker struct {
+	loads map[string]trackedLoad
+	mx    sync.RWMutex
+}
+
+type trackedLoad struct {
+	updated time.Time
+	load    PeerLoad
+}
+
+func NewLoadTracker() *LoadTracker {
+	return &LoadTracker{
+		loads: map[string]trackedLoad{},
+	}
+}
+
+// Update sets the load reported by the peer.
+func (t *LoadTracker) Update(host string, load PeerLoad) {
+	t.mx.Lock()
+	defer t.mx.Unlock()
+
+	now := time.Now()
+	if len(t.loads) >= peerLoadMaxPeers {
+		maps.DeleteFunc(t.loads, func(_ string, tl trackedLoad) bool {
+			return now.Sub(tl.updated) > peerLoadTTL
+		})
+	}
+	t.loads[host] = trackedLoad{
+		updated: now,
+		load:    load,
+	}
+}
+
+// Get returns the load of the peer, which is zero if it is unknown.
+func (t *LoadTracker) Get(host string) PeerLoad {
+	t.mx.RLock()
+	defer t.mx.RUnlock()
+
+	tl, ok := t.loads[host]
+	if !ok || time.Since(tl.updated) > peerLoadTTL {
+		return PeerLoad{}
+	}
+	return tl.load
+}
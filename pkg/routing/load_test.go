@@ -0,0 +1,56 @@
+package routing
+
+import (
+	"strconv"
+	"testing"
+	"testing/synctest"
+	"time"
+
+	"github.com/go-openapi/testify/v2/require"
+)
+
+func TestPeerLoad(t *testing.T) {
+	t.Parallel()
+
+	load := PeerLoad{Uploads: 3, EgressRate: 1024}
+	require.EqualT(t, "uploads=3;egress-rate=1024", load.String())
+	parsedLoad, err := ParsePeerLoad(load.String())
+	require.NoError(t, err)
+	require.EqualT(t, load, parsedLoad)
+
+	parsedLoad, err = ParsePeerLoad("uploads=1; foo=bar")
+	require.NoError(t, err)
+	require.EqualT(t, PeerLoad{Uploads: 1}, parsedLoad)
+
+	_, err = ParsePeerLoad("")
+	require.EqualError(t, err, "invalid peer load ")
+	_, err = ParsePeerLoad("uploads=foo")
+	require.Error(t, err)
+	_, err = ParsePeerLoad("egress-rate=foo")
+	require.Error(t, err)
+}
+
+func TestLoadTracker(t *testing.T) {
+	t.Parallel()
+
+	synctest.Test(t, func(t *testing.T) {
+		tracker := NewLoadTracker()
+		require.EqualT(t, PeerLoad{}, tracker.Get("foo"))
+
+		load := PeerLoad{Uploads: 2, EgressRate: 100}
+		tracker.Update("foo", load)
+		require.EqualT(t, load, tracker.Get("foo"))
+		require.EqualT(t, PeerLoad{}, tracker.Get("bar"))
+
+		// Stale loads are unknown.
+		time.Sleep(peerLoadTTL + time.Second)
+		require.EqualT(t, PeerLoad{}, tracker.Get("foo"))
+
+		// Stale loads are removed when the max amount of peers is reached.
+		for i := range peerLoadMaxPeers {
+			tracker.Update(strconv.Itoa(i), load)
+		}
+		require.Len(t, tracker.loads, peerLoadMaxPeers)
+		require.EqualT(t, load, tracker.Get("0"))
+	})
+}
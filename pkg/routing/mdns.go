@@ -0,0 +1,200 @@
+package routing
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/zeroconf/v2"
+	ma "github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
+)
+
+const (
+	mdnsServiceName   = "_spegel._udp"
+	mdnsDomain        = "local"
+	mdnsDNSAddrPrefix = "dnsaddr="
+	mdnsTTL           = 2 * time.Minute
+)
+
+var _ NotifyingBootstrapper = &MDNSBootstrapper{}
+
+// MDNSBootstrapper announces and discovers peers on the local network with multicast DNS.
+// Peers are announced as DNS-SD services with their addresses in TXT records.
+type MDNSBootstrapper struct {
+	peers     map[peer.ID]mdnsPeer
+	changedCh chan any
+	mx        sync.RWMutex
+}
+
+type mdnsPeer struct {
+	expiry   time.Time
+	addrInfo peer.AddrInfo
+}
+
+func NewMDNSBootstrapper() *MDNSBootstrapper {
+	return &MDNSBootstrapper{
+		peers:     map[peer.ID]mdnsPeer{},
+		changedCh: make(chan any, 1),
+	}
+}
+
+func (b *MDNSBootstrapper) Run(ctx context.Context, addrInfo peer.AddrInfo) error {
+	log := logr.FromContextOrDiscard(ctx)
+
+	if addrInfo.ID == "" {
+		return errors.New("mDNS bootstrap requires the peer ID to be set")
+	}
+	ips, port, txts, err := mdnsRecords(addrInfo)
+	if err != nil {
+		return err
+	}
+	server, err := zeroconf.RegisterProxy(addrInfo.ID.String(), mdnsServiceName, mdnsDomain, port, addrInfo.ID.String(), ips, txts, nil, zeroconf.TTL(uint32(mdnsTTL.Seconds())))
+	if err != nil {
+		return err
+	}
+	defer server.Shutdown()
+
+	// Entries are sent until browsing stops, after which the entry channel is closed.
+	entryCh := make(chan *zeroconf.ServiceEntry)
+	browseErrCh := make(chan error, 1)
+	go func() {
+		browseErrCh <- zeroconf.Browse(ctx, mdnsServiceName, mdnsDomain, entryCh)
+	}()
+	for {
+		select {
+		case err := <-browseErrCh:
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		case entry, ok := <-entryCh:
+			if !ok {
+				entryCh = nil
+				continue
+			}
+			err := b.add(entry, addrInfo.ID)
+			if err != nil {
+				log.Error(err, "could not add peer discovered with mDNS", "instance", entry.Instance)
+			}
+		}
+	}
+}
+
+func (b *MDNSBootstrapper) Get(ctx context.Context) ([]peer.AddrInfo, error) {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	now := time.Now()
+	maps.DeleteFunc(b.peers, func(_ peer.ID, p mdnsPeer) bool {
+		return now.After(p.expiry)
+	})
+	addrInfos := []peer.AddrInfo{}
+	for _, id := range slices.Sorted(maps.Keys(b.peers)) {
+		addrInfos = append(addrInfos, b.peers[id].addrInfo)
+	}
+	return addrInfos, nil
+}
+
+func (b *MDNSBootstrapper) Changed() <-chan any {
+	return b.changedCh
+}
+
+// add stores the peers in the TXT records of the entry until the entry expires.
+// Discovering a peer which is not already known signals that the bootstrap peers have changed.
+func (b *MDNSBootstrapper) add(entry *zeroconf.ServiceEntry, self peer.ID) error {
+	addrs := []ma.Multiaddr{}
+	for _, txt := range entry.Text {
+		addrStr, ok := strings.CutPrefix(txt, mdnsDNSAddrPrefix)
+		if !ok {
+			continue
+		}
+		addr, err := ma.NewMultiaddr(addrStr)
+		if err != nil {
+			return err
+		}
+		addrs = append(addrs, addr)
+	}
+	addrInfos, err := peer.AddrInfosFromP2pAddrs(addrs...)
+	if err != nil {
+		return err
+	}
+
+	b.mx.Lock()
+	defer b.mx.Unlock()
+	now := time.Now()
+	changed := false
+	for _, addrInfo := range addrInfos {
+		if addrInfo.ID == self {
+			continue
+		}
+		p, ok := b.peers[addrInfo.ID]
+		if !ok || now.After(p.expiry) {
+			changed = true
+		}
+		b.peers[addrInfo.ID] = mdnsPeer{
+			addrInfo: addrInfo,
+			expiry:   entry.Expiry,
+		}
+	}
+	if changed {
+		select {
+		case b.changedCh <- nil:
+		default:
+		}
+	}
+	return nil
+}
+
+// mdnsRecords returns the IPs, port, and TXT records to announce for the peer.
+// The port is required by DNS-SD while peers only use the addresses in the TXT records.
+// Loopback and link-local addresses are not announced as other peers cannot reach them.
+func mdnsRecords(addrInfo peer.AddrInfo) ([]string, int, []string, error) {
+	addrInfo.Addrs = slices.DeleteFunc(slices.Clone(addrInfo.Addrs), func(addr ma.Multiaddr) bool {
+		return manet.IsIPLoopback(addr) || manet.IsIP6LinkLocal(addr)
+	})
+	ips := []string{}
+	port := 0
+	for _, addr := range addrInfo.Addrs {
+		ip, err := manet.ToIP(addr)
+		if err != nil {
+			continue
+		}
+		if !slices.Contains(ips, ip.String()) {
+			ips = append(ips, ip.String())
+		}
+		if port != 0 {
+			continue
+		}
+		for _, code := range []int{ma.P_TCP, ma.P_UDP} {
+			portStr, err := addr.ValueForProtocol(code)
+			if err != nil {
+				continue
+			}
+			port, err = strconv.Atoi(portStr)
+			if err != nil {
+				return nil, 0, nil, err
+			}
+			break
+		}
+	}
+	if len(ips) == 0 || port == 0 {
+		return nil, 0, nil, errors.New("peer has no IP address with a port to announce")
+	}
+	p2pAddrs, err := peer.AddrInfoToP2pAddrs(&addrInfo)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	txts := []string{}
+	for _, p2pAddr := range p2pAddrs {
+		txts = append(txts, mdnsDNSAddrPrefix+p2pAddr.String())
+	}
+	return ips, port, txts, nil
+}
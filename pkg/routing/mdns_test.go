@@ -0,0 +1,117 @@
+package routing
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-openapi/testify/v2/require"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/zeroconf/v2"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+func TestMDNSRecords(t *testing.T) {
+	t.Parallel()
+
+	id := testPeerID(t)
+	addrInfo := peer.AddrInfo{
+		ID: id,
+		Addrs: []ma.Multiaddr{
+			ma.StringCast("/ip4/127.0.0.1/tcp/5001"),
+			ma.StringCast("/ip4/10.0.0.1/udp/5001/quic-v1"),
+			ma.StringCast("/ip4/10.0.0.1/tcp/5001"),
+			ma.StringCast("/ip6/::1/tcp/5001"),
+			ma.StringCast("/ip6/fe80::1/tcp/5001"),
+			ma.StringCast("/ip6/fd00::1/tcp/5001"),
+		},
+	}
+	ips, port, txts, err := mdnsRecords(addrInfo)
+	require.NoError(t, err)
+	require.SliceEqualT(t, []string{"10.0.0.1", "fd00::1"}, ips)
+	require.EqualT(t, 5001, port)
+	expectedTxts := []string{
+		"dnsaddr=/ip4/10.0.0.1/udp/5001/quic-v1/p2p/" + id.String(),
+		"dnsaddr=/ip4/10.0.0.1/tcp/5001/p2p/" + id.String(),
+		"dnsaddr=/ip6/fd00::1/tcp/5001/p2p/" + id.String(),
+	}
+	require.SliceEqualT(t, expectedTxts, txts)
+
+	_, _, _, err = mdnsRecords(peer.AddrInfo{ID: id, Addrs: []ma.Multiaddr{ma.StringCast("/ip4/10.0.0.1")}})
+	require.EqualError(t, err, "peer has no IP address with a port to announce")
+	_, _, _, err = mdnsRecords(peer.AddrInfo{ID: id, Addrs: []ma.Multiaddr{ma.StringCast("/ip4/127.0.0.1/tcp/5001")}})
+	require.EqualError(t, err, "peer has no IP address with a port to announce")
+}
+
+func TestMDNSBootstrapper(t *testing.T) {
+	t.Parallel()
+
+	self := testPeerID(t)
+	other := testPeerID(t)
+	expired := testPeerID(t)
+
+	bs := NewMDNSBootstrapper()
+	err := bs.Run(t.Context(), peer.AddrInfo{})
+	require.EqualError(t, err, "mDNS bootstrap requires the peer ID to be set")
+
+	entries := []*zeroconf.ServiceEntry{
+		{
+			Text: []string{
+				"dnsaddr=/ip4/10.0.0.1/tcp/5001/p2p/" + self.String(),
+			},
+			Expiry: time.Now().Add(time.Minute),
+		},
+		{
+			Text: []string{
+				"foo=bar",
+				"dnsaddr=/ip4/10.0.0.2/tcp/5001/p2p/" + other.String(),
+				"dnsaddr=/ip4/10.0.0.2/udp/5001/quic-v1/p2p/" + other.String(),
+			},
+			Expiry: time.Now().Add(time.Minute),
+		},
+		{
+			Text: []string{
+				"dnsaddr=/ip4/10.0.0.3/tcp/5001/p2p/" + expired.String(),
+			},
+			Expiry: time.Now().Add(-time.Second),
+		},
+	}
+	for _, entry := range entries {
+		err := bs.add(entry, self)
+		require.NoError(t, err)
+	}
+	select {
+	case <-bs.Changed():
+	default:
+		t.Fatal("expected bootstrap peers to change")
+	}
+
+	// Rediscovering a known peer should not signal a change.
+	err = bs.add(entries[1], self)
+	require.NoError(t, err)
+	select {
+	case <-bs.Changed():
+		t.Fatal("expected bootstrap peers to not change")
+	default:
+	}
+	err = bs.add(&zeroconf.ServiceEntry{Text: []string{"dnsaddr=foo"}}, self)
+	require.Error(t, err)
+
+	addrInfos, err := bs.Get(t.Context())
+	require.NoError(t, err)
+	require.Len(t, addrInfos, 1)
+	require.EqualT(t, other, addrInfos[0].ID)
+	require.Len(t, addrInfos[0].Addrs, 2)
+	require.EqualT(t, "/ip4/10.0.0.2/tcp/5001", addrInfos[0].Addrs[0].String())
+	require.EqualT(t, "/ip4/10.0.0.2/udp/5001/quic-v1", addrInfos[0].Addrs[1].String())
+}
+
+func testPeerID(t *testing.T) peer.ID {
+	t.Helper()
+
+	privKey, _, err := crypto.GenerateEd25519Key(nil)
+	require.NoError(t, err)
+	id, err := peer.IDFromPrivateKey(privKey)
+	require.NoError(t, err)
+	return id
+}
@@ -13,7 +13,9 @@ import (
 	"net/netip"
 	"os"
 	"path/filepath"
+	"slices"
 	"strconv"
+	"sync"
 	"time"
 
 	"golang.org/x/sync/singleflight"
@@ -26,10 +28,15 @@ import (
 	"github.com/libp2p/go-libp2p-kad-dht/provider"
 	"github.com/libp2p/go-libp2p-kad-dht/records"
 	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/event"
 	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
 	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/pnet"
 	"github.com/libp2p/go-libp2p/core/sec"
+	quic "github.com/libp2p/go-libp2p/p2p/transport/quic"
 	"github.com/libp2p/go-libp2p/p2p/transport/tcp"
+	"github.com/libp2p/go-libp2p/p2p/transport/websocket"
 	ma "github.com/multiformats/go-multiaddr"
 	manet "github.com/multiformats/go-multiaddr/net"
 	mc "github.com/multiformats/go-multicodec"
@@ -45,12 +52,27 @@ import (
 )
 
 const (
-	lookupCacheTTL = 5 * time.Second
+	lookupCacheTTL        = 5 * time.Second
+	peerCacheInterval     = 1 * time.Minute
+	cachedPeerDialTimeout = 5 * time.Second
+)
+
+const (
+	TransportTCP       = "tcp"
+	TransportQUIC      = "quic"
+	TransportWebSocket = "websocket"
 )
 
 type P2PRouterConfig struct {
 	DataDir           string
+	PSKPath           string
+	Allowlist         *Allowlist
+	LoadTracker       *LoadTracker
+	Scoreboard        *Scoreboard
+	Topology          Topology
+	TopologyPolicy    TopologyPolicy
 	Libp2pOpts        []libp2p.Option
+	Transports        []string
 	AdvertiseTTL      time.Duration
 	MaxReprovideDelay time.Duration
 }
@@ -64,6 +86,55 @@ func WithLibP2POptions(opts ...libp2p.Option) P2PRouterOption {
 	}
 }
 
+// WithTransports sets the transports used by the router, all transports listen on the same port.
+func WithTransports(transports ...string) P2PRouterOption {
+	return func(cfg *P2PRouterConfig) error {
+		cfg.Transports = transports
+		return nil
+	}
+}
+
+// WithPSKPath sets the path to a libp2p pre-shared key which is required by peers to connect to the router.
+func WithPSKPath(path string) P2PRouterOption {
+	return func(cfg *P2PRouterConfig) error {
+		cfg.PSKPath = path
+		return nil
+	}
+}
+
+// WithAllowlist rejects connections to and from peers with addresses which are not in the allowlist.
+func WithAllowlist(allowlist *Allowlist) P2PRouterOption {
+	return func(cfg *P2PRouterConfig) error {
+		cfg.Allowlist = allowlist
+		return nil
+	}
+}
+
+// WithTopology sets the topology of the router and the policy used to prefer peers by their locality.
+func WithTopology(topology Topology, policy TopologyPolicy) P2PRouterOption {
+	return func(cfg *P2PRouterConfig) error {
+		cfg.Topology = topology
+		cfg.TopologyPolicy = policy
+		return nil
+	}
+}
+
+// WithPeerLoadTracker weights the selection of peers in lookups by the load they report.
+func WithPeerLoadTracker(tracker *LoadTracker) P2PRouterOption {
+	return func(cfg *P2PRouterConfig) error {
+		cfg.LoadTracker = tracker
+		return nil
+	}
+}
+
+// WithPeerScoreboard excludes peers with an open circuit breaker from lookups.
+func WithPeerScoreboard(scoreboard *Scoreboard) P2PRouterOption {
+	return func(cfg *P2PRouterConfig) error {
+		cfg.Scoreboard = scoreboard
+		return nil
+	}
+}
+
 func WithDataDir(dataDir string) P2PRouterOption {
 	return func(cfg *P2PRouterConfig) error {
 		cfg.DataDir = dataDir
@@ -89,6 +160,7 @@ var _ Router = &P2PRouter{}
 
 type P2PRouter struct {
 	bootstrapper     Bootstrapper
+	peerCache        *peerCache
 	host             host.Host
 	kdht             *dht.IpfsDHT
 	prov             *provider.SweepingProvider
@@ -96,11 +168,17 @@ type P2PRouter struct {
 	lookupCache      *expirable.LRU[string, *Iterator]
 	connectivityGate *channel.Gate
 	protocols        []ma.Multiaddr
+	loadTracker      *LoadTracker
+	scoreboard       *Scoreboard
+	topology         Topology
+	topologyPolicy   TopologyPolicy
 	registryPort     uint16
 }
 
 func NewP2PRouter(ctx context.Context, addr string, bs Bootstrapper, registryPortStr string, opts ...P2PRouterOption) (*P2PRouter, error) {
 	cfg := P2PRouterConfig{
+		Transports:        []string{TransportTCP},
+		TopologyPolicy:    TopologyPolicyNone,
 		AdvertiseTTL:      15 * time.Minute,
 		MaxReprovideDelay: 2 * time.Minute,
 	}
@@ -114,7 +192,11 @@ func NewP2PRouter(ctx context.Context, addr string, bs Bootstrapper, registryPor
 		return nil, err
 	}
 
-	listenAddrs, err := listenMultiaddrs(addr)
+	listenAddrs, err := listenMultiaddrs(addr, cfg.Transports)
+	if err != nil {
+		return nil, err
+	}
+	transportOpt, err := transportOptions(cfg.Transports)
 	if err != nil {
 		return nil, err
 	}
@@ -132,10 +214,7 @@ func NewP2PRouter(ctx context.Context, addr string, bs Bootstrapper, registryPor
 			}
 			return filtered
 		}),
-		libp2p.ChainOptions(
-			libp2p.NoTransports,
-			libp2p.Transport(tcp.NewTCPTransport),
-		),
+		transportOpt,
 	}
 	if cfg.DataDir != "" {
 		peerKey, err := loadOrCreatePrivateKey(ctx, cfg.DataDir)
@@ -144,12 +223,30 @@ func NewP2PRouter(ctx context.Context, addr string, bs Bootstrapper, registryPor
 		}
 		hostOpts = append(hostOpts, libp2p.Identity(peerKey))
 	}
+	if cfg.PSKPath != "" {
+		psk, err := loadPSK(cfg.PSKPath)
+		if err != nil {
+			return nil, err
+		}
+		// QUIC encrypts connections itself and WebSocket shares the TCP listener, neither of which can use a PSK.
+		if slices.Contains(cfg.Transports, TransportQUIC) {
+			return nil, errors.New("pre-shared key is not supported with the quic transport")
+		}
+		if slices.Contains(cfg.Transports, TransportTCP) && slices.Contains(cfg.Transports, TransportWebSocket) {
+			return nil, errors.New("pre-shared key is not supported when combining the tcp and websocket transports")
+		}
+		hostOpts = append(hostOpts, libp2p.PrivateNetwork(psk))
+	}
+	if cfg.Allowlist != nil {
+		hostOpts = append(hostOpts, libp2p.ConnectionGater(&allowlistGater{allowlist: cfg.Allowlist}))
+	}
 	hostOpts = append(hostOpts, cfg.Libp2pOpts...)
 	host, err := libp2p.New(hostOpts...)
 	if err != nil {
 		return nil, fmt.Errorf("could not create host: %w", err)
 	}
 	protocols := protocolsFromAddrs(host.Addrs())
+	host.SetStreamHandler(topologyProtocolID, topologyHandler(cfg.Topology))
 
 	dhtOpts := []dht.Option{
 		dht.Mode(dht.ModeServer),
@@ -195,8 +292,14 @@ func NewP2PRouter(ctx context.Context, addr string, bs Bootstrapper, registryPor
 		return nil, err
 	}
 
+	var cache *peerCache
+	if cfg.DataDir != "" {
+		cache = newPeerCache(cfg.DataDir)
+	}
+
 	return &P2PRouter{
 		bootstrapper:     bs,
+		peerCache:        cache,
 		host:             host,
 		kdht:             kdht,
 		prov:             prov,
@@ -204,6 +307,10 @@ func NewP2PRouter(ctx context.Context, addr string, bs Bootstrapper, registryPor
 		lookupCache:      expirable.NewLRU[string, *Iterator](0, nil, lookupCacheTTL),
 		connectivityGate: connectivityGate,
 		protocols:        protocols,
+		loadTracker:      cfg.LoadTracker,
+		scoreboard:       cfg.Scoreboard,
+		topology:         cfg.Topology,
+		topologyPolicy:   cfg.TopologyPolicy,
 		registryPort:     uint16(registryPort),
 	}, nil
 }
@@ -212,10 +319,20 @@ func (r *P2PRouter) Host() host.Host {
 	return r.host
 }
 
+// PeerTLS returns TLS configurations bound to the identity of the router.
+func (r *P2PRouter) PeerTLS() (*PeerTLS, error) {
+	return NewPeerTLS(r.host.Peerstore().PrivKey(r.host.ID()))
+}
+
 func (r *P2PRouter) Run(ctx context.Context) error {
 	log := logr.FromContextOrDiscard(ctx).WithName("p2p")
 	log.Info("starting p2p router", "id", r.host.ID())
 
+	var changedCh <-chan any
+	if notifier, ok := r.bootstrapper.(NotifyingBootstrapper); ok {
+		changedCh = notifier.Changed()
+	}
+
 	group := errgroup.WithContext(ctx)
 	group.Go(func(ctx context.Context) error {
 		err := r.bootstrapper.Run(ctx, *host.InfoFromHost(r.host))
@@ -241,7 +358,7 @@ func (r *P2PRouter) Run(ctx context.Context) error {
 					if !r.connectivityGate.State() {
 						return nil
 					}
-					err := bootstrapPeers(ctx, r.bootstrapper, r.kdht, r.protocols)
+					err := bootstrapPeers(ctx, r.bootstrapper, r.kdht, r.protocols, r.peerCache)
 					if err != nil {
 						return err
 					}
@@ -255,8 +372,14 @@ func (r *P2PRouter) Run(ctx context.Context) error {
 					continue
 				}
 				log.Info("bootstrap completed connectivity is reached", "duration", time.Since(start))
+			case <-changedCh:
+				err := bootstrapPeers(ctx, r.bootstrapper, r.kdht, r.protocols, nil)
+				if err != nil {
+					log.Error(err, "bootstrap after bootstrap peers changed failed")
+					continue
+				}
 			case <-time.After(30 * time.Minute):
-				err := bootstrapPeers(ctx, r.bootstrapper, r.kdht, r.protocols)
+				err := bootstrapPeers(ctx, r.bootstrapper, r.kdht, r.protocols, nil)
 				if err != nil {
 					log.Error(err, "periodic bootstrap failed")
 					continue
@@ -264,6 +387,56 @@ func (r *P2PRouter) Run(ctx context.Context) error {
 			}
 		}
 	})
+	if !r.topology.IsZero() {
+		group.Go(func(ctx context.Context) error {
+			sub, err := r.host.EventBus().Subscribe(new(event.EvtPeerIdentificationCompleted))
+			if err != nil {
+				return err
+			}
+			defer sub.Close()
+			// Topology is fetched from peers once they are identified as supporting the protocol.
+			for {
+				select {
+				case <-ctx.Done():
+					return nil
+				case e := <-sub.Out():
+					//nolint: errcheck // Subscription only emits this event type.
+					evt := e.(event.EvtPeerIdentificationCompleted)
+					if !slices.Contains(evt.Protocols, topologyProtocolID) {
+						continue
+					}
+					go func() {
+						err := fetchTopology(ctx, r.host, evt.Peer)
+						if err != nil {
+							log.Error(err, "could not fetch topology from peer", "peer", evt.Peer)
+						}
+					}()
+				}
+			}
+		})
+	}
+	if r.peerCache != nil {
+		group.Go(func(ctx context.Context) error {
+			ticker := time.NewTicker(peerCacheInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					// Persist the latest peers before shutting down so that they can be used after a restart.
+					err := r.savePeers()
+					if err != nil {
+						log.Error(err, "could not save peers to cache")
+					}
+					return nil
+				case <-ticker.C:
+					err := r.savePeers()
+					if err != nil {
+						log.Error(err, "could not save peers to cache")
+					}
+				}
+			}
+		})
+	}
 
 	errs := []error{}
 	err := group.Wait()
@@ -283,6 +456,23 @@ func (r *P2PRouter) Run(ctx context.Context) error {
 	return nil
 }
 
+// savePeers persists the peers in the routing table with their known addresses.
+func (r *P2PRouter) savePeers() error {
+	addrInfos := []peer.AddrInfo{}
+	for _, id := range r.kdht.RoutingTable().ListPeers() {
+		addrs := r.host.Peerstore().Addrs(id)
+		if len(addrs) == 0 {
+			continue
+		}
+		addrInfos = append(addrInfos, peer.AddrInfo{ID: id, Addrs: addrs})
+	}
+	// Keep the previous peers rather than replacing them with an empty cache.
+	if len(addrInfos) == 0 {
+		return nil
+	}
+	return r.peerCache.Save(addrInfos)
+}
+
 func (r *P2PRouter) Ready(ctx context.Context) (bool, error) {
 	if r.kdht.RoutingTable().Size() == 0 {
 		return false, nil
@@ -308,7 +498,7 @@ func (r *P2PRouter) Lookup(ctx context.Context, key string, count int) (*Iterato
 			// Open iterator to run refresh.
 			iter.Open()
 		} else {
-			iter = NewIterator()
+			iter = NewIterator(WithTopologyPolicy(r.topologyPolicy), WithLoadTracker(r.loadTracker), WithScoreboard(r.scoreboard))
 			r.lookupCache.Add(c.String(), iter)
 		}
 
@@ -333,9 +523,7 @@ func (r *P2PRouter) Lookup(ctx context.Context, key string, count int) (*Iterato
 				peer := Peer{
 					Host:      addrInfo.ID.String(),
 					Addresses: ipAddrs,
-					Metadata: PeerMetadata{
-						RegistryPort: r.registryPort,
-					},
+					Metadata:  r.peerMetadata(addrInfo.ID),
 				}
 				iter.Add(peer)
 			}
@@ -375,9 +563,7 @@ func (r *P2PRouter) Measure(ctx context.Context, key string) ([]LookupResult, er
 			Peer: Peer{
 				Host:      addrInfo.ID.String(),
 				Addresses: ipAddrs,
-				Metadata: PeerMetadata{
-					RegistryPort: r.registryPort,
-				},
+				Metadata:  r.peerMetadata(addrInfo.ID),
 			},
 			Duration: d,
 		}
@@ -441,15 +627,41 @@ func (r *P2PRouter) ListPeers() ([]Peer, error) {
 		peer := Peer{
 			Host:      id.String(),
 			Addresses: ipAddrs,
-			Metadata: PeerMetadata{
-				RegistryPort: r.registryPort,
-			},
+			Metadata:  r.peerMetadata(id),
 		}
 		peers = append(peers, peer)
 	}
 	return peers, nil
 }
 
+// IsConnected returns true if the peer with the ID is connected to the router.
+// Connections are authenticated with the peer key and gated by the pre-shared key and allowlist.
+func (r *P2PRouter) IsConnected(id string) bool {
+	peerID, err := peer.Decode(id)
+	if err != nil {
+		return false
+	}
+	return r.host.Network().Connectedness(peerID) == network.Connected
+}
+
+// PeerScores returns the health of peers tracked by the scoreboard.
+func (r *P2PRouter) PeerScores() map[string]PeerScore {
+	if r.scoreboard == nil {
+		return map[string]PeerScore{}
+	}
+	return r.scoreboard.Scores()
+}
+
+// peerMetadata returns the metadata of the peer with its locality relative to the router.
+func (r *P2PRouter) peerMetadata(id peer.ID) PeerMetadata {
+	topology := peerTopology(r.host, id)
+	return PeerMetadata{
+		Topology:     topology,
+		Locality:     r.topology.Locality(topology),
+		RegistryPort: r.registryPort,
+	}
+}
+
 func (r *P2PRouter) LocalAddresses() ([]netip.Addr, error) {
 	ipAddrs, err := toIPAddrs(r.host.Addrs())
 	if err != nil {
@@ -469,6 +681,7 @@ func toIPAddrs(addrs []ma.Multiaddr) ([]netip.Addr, error) {
 		if _, ok := existing[ip.String()]; ok {
 			continue
 		}
+		existing[ip.String()] = nil
 		ipAddr, ok := netip.AddrFromSlice(ip)
 		if !ok {
 			return nil, errors.New("could not convert to netip address")
@@ -478,7 +691,7 @@ func toIPAddrs(addrs []ma.Multiaddr) ([]netip.Addr, error) {
 	return ipAddrs, nil
 }
 
-func listenMultiaddrs(addr string) ([]ma.Multiaddr, error) {
+func listenMultiaddrs(addr string, transports []string) ([]ma.Multiaddr, error) {
 	h, p, err := net.SplitHostPort(addr)
 	if err != nil {
 		return nil, err
@@ -504,33 +717,70 @@ func listenMultiaddrs(addr string) ([]ma.Multiaddr, error) {
 	}
 
 	listenAddrs := []ma.Multiaddr{}
-	udpComp, err := ma.NewComponent("udp", p)
-	if err != nil {
-		return nil, err
-	}
-	quicComp, err := ma.NewComponent("quic-v1", "")
-	if err != nil {
-		return nil, err
-	}
-	tcpComp, err := ma.NewComponent("tcp", p)
-	if err != nil {
-		return nil, err
-	}
 	for _, ipComp := range ipComps {
-		listenAddrs = append(listenAddrs, ma.Join(ipComp.Multiaddr(), udpComp, quicComp), ma.Join(ipComp.Multiaddr(), tcpComp))
+		for _, transport := range transports {
+			var protocol string
+			switch transport {
+			case TransportTCP:
+				protocol = fmt.Sprintf("/tcp/%s", p)
+			case TransportQUIC:
+				protocol = fmt.Sprintf("/udp/%s/quic-v1", p)
+			case TransportWebSocket:
+				protocol = fmt.Sprintf("/tcp/%s/ws", p)
+			default:
+				return nil, fmt.Errorf("unknown transport %s", transport)
+			}
+			protocolAddr, err := ma.NewMultiaddr(protocol)
+			if err != nil {
+				return nil, err
+			}
+			listenAddrs = append(listenAddrs, ma.Join(ipComp.Multiaddr(), protocolAddr))
+		}
 	}
 	return listenAddrs, nil
 }
 
+// transportOptions returns the libp2p option which enables only the given transports.
+func transportOptions(transports []string) (libp2p.Option, error) {
+	if len(transports) == 0 {
+		return nil, errors.New("at least one transport is required")
+	}
+	opts := []libp2p.Option{libp2p.NoTransports}
+	for _, transport := range slices.Compact(slices.Sorted(slices.Values(transports))) {
+		switch transport {
+		case TransportTCP:
+			opts = append(opts, libp2p.Transport(tcp.NewTCPTransport))
+		case TransportQUIC:
+			opts = append(opts, libp2p.Transport(quic.NewTransport))
+		case TransportWebSocket:
+			opts = append(opts, libp2p.Transport(websocket.New))
+		default:
+			return nil, fmt.Errorf("unknown transport %s", transport)
+		}
+	}
+	// TCP and WebSocket listen on the same port.
+	if slices.Contains(transports, TransportTCP) && slices.Contains(transports, TransportWebSocket) {
+		opts = append(opts, libp2p.ShareTCPListener())
+	}
+	return libp2p.ChainOptions(opts...), nil
+}
+
+// protocolsFromAddrs returns the unique transport protocols of the addresses without the IP component.
+// The order of the addresses is kept so that the preferred transport is dialed first.
 func protocolsFromAddrs(addrs []ma.Multiaddr) []ma.Multiaddr {
-	protocolSet := map[string]ma.Multiaddr{}
+	protocols := []ma.Multiaddr{}
 	for _, addr := range addrs {
 		_, protocol := ma.SplitFirst(addr)
-		protocolSet[protocol.String()] = protocol
-	}
-	protocols := []ma.Multiaddr{}
-	for _, v := range protocolSet {
-		protocols = append(protocols, v)
+		if len(protocol) == 0 {
+			continue
+		}
+		exists := slices.ContainsFunc(protocols, func(existing ma.Multiaddr) bool {
+			return existing.Equal(protocol)
+		})
+		if exists {
+			continue
+		}
+		protocols = append(protocols, protocol)
 	}
 	return protocols
 }
@@ -560,15 +810,86 @@ func addrsEqual(a1, a2 []ma.Multiaddr) bool {
 	return false
 }
 
-func bootstrapPeers(ctx context.Context, bs Bootstrapper, kdht *dht.IpfsDHT, protocols []ma.Multiaddr) error {
-	// Attempt to connect to bootstrap peers.
-	bootstrapCtx, bootstrapCancel := context.WithTimeout(ctx, 30*time.Second)
-	defer bootstrapCancel()
+func bootstrapPeers(ctx context.Context, bs Bootstrapper, kdht *dht.IpfsDHT, protocols []ma.Multiaddr, cache *peerCache) error {
+	log := logr.FromContextOrDiscard(ctx)
 
-	addrInfos, err := bs.Get(bootstrapCtx)
-	if err != nil {
-		return err
+	// Cached peers are tried first, the bootstrapper is only used when none of them can be reached.
+	connected := false
+	if cache != nil {
+		cachedAddrInfos, err := cache.Load()
+		if err != nil {
+			log.Error(err, "could not load cached peers")
+		}
+		if len(cachedAddrInfos) > 0 {
+			reachable := connectCachedPeers(ctx, kdht, protocols, cachedAddrInfos)
+			if len(reachable) == 0 {
+				log.Info("could not connect to any cached peers")
+			}
+			// Unreachable peers are removed so that a stale cache is not retried on every bootstrap.
+			if len(reachable) < len(cachedAddrInfos) {
+				err := cache.Save(reachable)
+				if err != nil {
+					log.Error(err, "could not prune cached peers")
+				}
+			}
+			connected = len(reachable) > 0
+		}
+	}
+	if !connected {
+		// Attempt to connect to bootstrap peers.
+		bootstrapCtx, bootstrapCancel := context.WithTimeout(ctx, 30*time.Second)
+		defer bootstrapCancel()
+		addrInfos, err := bs.Get(bootstrapCtx)
+		if err != nil {
+			return err
+		}
+		err = connectPeers(bootstrapCtx, kdht, protocols, addrInfos)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Refresh routing table.
+	if kdht.RoutingTable().Size() == 0 {
+		return errors.New("routing table is empty after bootstrapping")
+	}
+	errCh := kdht.RefreshRoutingTable()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case err := <-errCh:
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// connectCachedPeers dials the cached peers in parallel and returns the peers that could be connected to.
+func connectCachedPeers(ctx context.Context, kdht *dht.IpfsDHT, protocols []ma.Multiaddr, addrInfos []peer.AddrInfo) []peer.AddrInfo {
+	dialCtx, dialCancel := context.WithTimeout(ctx, cachedPeerDialTimeout)
+	defer dialCancel()
+
+	mx := sync.Mutex{}
+	reachable := []peer.AddrInfo{}
+	wg := sync.WaitGroup{}
+	for _, addrInfo := range addrInfos {
+		wg.Go(func() {
+			err := connectPeers(dialCtx, kdht, protocols, []peer.AddrInfo{addrInfo})
+			if err != nil {
+				return
+			}
+			mx.Lock()
+			defer mx.Unlock()
+			reachable = append(reachable, addrInfo)
+		})
 	}
+	wg.Wait()
+	return reachable
+}
+
+// connectPeers connects to the peers, returning an error only if no peer could be connected to.
+func connectPeers(ctx context.Context, kdht *dht.IpfsDHT, protocols []ma.Multiaddr, addrInfos []peer.AddrInfo) error {
 	errs := []error{}
 	self := *host.InfoFromHost(kdht.Host())
 	for _, addrInfo := range addrInfos {
@@ -606,7 +927,7 @@ func bootstrapPeers(ctx context.Context, bs Bootstrapper, kdht *dht.IpfsDHT, pro
 				return err
 			}
 			addrInfo.ID = id
-			err = kdht.Host().Connect(bootstrapCtx, addrInfo)
+			err = kdht.Host().Connect(ctx, addrInfo)
 			mismatchErr, ok := errors.AsType[sec.ErrPeerIDMismatch](err)
 			kdht.Host().Peerstore().ClearAddrs(addrInfo.ID)
 			kdht.Host().Peerstore().RemovePeer(addrInfo.ID)
@@ -617,7 +938,7 @@ func bootstrapPeers(ctx context.Context, bs Bootstrapper, kdht *dht.IpfsDHT, pro
 			addrInfo.ID = mismatchErr.Actual
 		}
 
-		err := kdht.Host().Connect(bootstrapCtx, addrInfo)
+		err := kdht.Host().Connect(ctx, addrInfo)
 		if err != nil {
 			errs = append(errs, err)
 			continue
@@ -626,21 +947,21 @@ func bootstrapPeers(ctx context.Context, bs Bootstrapper, kdht *dht.IpfsDHT, pro
 	if len(errs) == len(addrInfos) {
 		return errors.Join(errs...)
 	}
+	return nil
+}
 
-	// Refresh routing table.
-	if kdht.RoutingTable().Size() == 0 {
-		return errors.New("routing table is empty after bootstrapping")
+// loadPSK reads a pre-shared key in the libp2p V1 PSK format.
+func loadPSK(path string) (pnet.PSK, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
 	}
-	errCh := kdht.RefreshRoutingTable()
-	select {
-	case <-ctx.Done():
-		return ctx.Err()
-	case err = <-errCh:
-		if err != nil {
-			return err
-		}
+	defer f.Close()
+	psk, err := pnet.DecodeV1PSK(f)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode pre-shared key: %w", err)
 	}
-	return nil
+	return psk, nil
 }
 
 func loadOrCreatePrivateKey(ctx context.Context, dataDir string) (crypto.PrivKey, error) {
@@ -2,6 +2,12 @@ package routing
 
 import (
 	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -10,6 +16,7 @@ import (
 	"github.com/go-openapi/testify/v2/assert"
 	"github.com/go-openapi/testify/v2/require"
 	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/crypto"
 	"github.com/libp2p/go-libp2p/core/host"
 	"github.com/libp2p/go-libp2p/core/network"
 	"github.com/libp2p/go-libp2p/core/peer"
@@ -29,12 +36,16 @@ func TestP2PRouterOptions(t *testing.T) {
 	opts := []P2PRouterOption{
 		WithLibP2POptions(libp2pOpts...),
 		WithDataDir("foobar"),
+		WithPSKPath("swarm.key"),
+		WithTransports(TransportTCP, TransportQUIC),
 	}
 	cfg := P2PRouterConfig{}
 	err := option.Apply(&cfg, opts...)
 	require.NoError(t, err)
 	require.Equal(t, libp2pOpts, cfg.Libp2pOpts)
 	require.EqualT(t, "foobar", cfg.DataDir)
+	require.EqualT(t, "swarm.key", cfg.PSKPath)
+	require.SliceEqualT(t, []string{TransportTCP, TransportQUIC}, cfg.Transports)
 }
 
 func TestP2PRouter(t *testing.T) {
@@ -230,17 +241,292 @@ func TestProvideTTL(t *testing.T) {
 	require.NoError(t, err)
 }
 
+func TestP2PRouterTransports(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		transports []string
+		protocol   string
+	}{
+		{
+			name:       "quic",
+			transports: []string{TransportQUIC},
+			protocol:   "quic-v1",
+		},
+		{
+			name:       "websocket",
+			transports: []string{TransportWebSocket},
+			protocol:   "ws",
+		},
+		{
+			name:       "tcp and websocket",
+			transports: []string{TransportTCP, TransportWebSocket},
+			protocol:   "tcp",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			runCtx, runCancel := context.WithCancel(t.Context())
+			group := errgroup.WithContext(runCtx)
+
+			primaryRouter, err := NewP2PRouter(t.Context(), "127.0.0.1:0", NewStaticBootstrapper(nil), "9090", WithTransports(tt.transports...))
+			require.NoError(t, err)
+			bs := NewStaticBootstrapper([]peer.AddrInfo{{ID: primaryRouter.host.ID(), Addrs: primaryRouter.host.Network().ListenAddresses()}})
+			router, err := NewP2PRouter(t.Context(), "127.0.0.1:0", bs, "9090", WithTransports(tt.transports...))
+			require.NoError(t, err)
+			for _, r := range []*P2PRouter{primaryRouter, router} {
+				group.Go(func(ctx context.Context) error {
+					return r.Run(ctx)
+				})
+			}
+
+			require.Eventually(t, func() bool {
+				conns := router.host.Network().ConnsToPeer(primaryRouter.host.ID())
+				if len(conns) == 0 {
+					return false
+				}
+				_, err := conns[0].RemoteMultiaddr().ValueForProtocol(ma.ProtocolWithName(tt.protocol).Code)
+				return err == nil
+			}, 10*time.Second, 100*time.Millisecond)
+
+			runCancel()
+			err = group.Wait()
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestP2PRouterPSK(t *testing.T) {
+	t.Parallel()
+
+	tmpDir := t.TempDir()
+	pskPath := filepath.Join(tmpDir, "swarm.key")
+	err := os.WriteFile(pskPath, []byte("/key/swarm/psk/1.0.0/\n/base16/\n"+strings.Repeat("ab", 32)), 0o600)
+	require.NoError(t, err)
+	otherPSKPath := filepath.Join(tmpDir, "other.key")
+	err = os.WriteFile(otherPSKPath, []byte("/key/swarm/psk/1.0.0/\n/base16/\n"+strings.Repeat("cd", 32)), 0o600)
+	require.NoError(t, err)
+
+	primaryRouter, err := NewP2PRouter(t.Context(), "127.0.0.1:0", NewStaticBootstrapper(nil), "9090", WithPSKPath(pskPath))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		require.NoError(t, primaryRouter.host.Close())
+	})
+	primaryInfo := peer.AddrInfo{ID: primaryRouter.host.ID(), Addrs: primaryRouter.host.Network().ListenAddresses()}
+
+	tests := []struct {
+		name      string
+		opts      []P2PRouterOption
+		expectErr bool
+	}{
+		{
+			name: "same key",
+			opts: []P2PRouterOption{WithPSKPath(pskPath)},
+		},
+		{
+			name:      "different key",
+			opts:      []P2PRouterOption{WithPSKPath(otherPSKPath)},
+			expectErr: true,
+		},
+		{
+			name:      "no key",
+			expectErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			router, err := NewP2PRouter(t.Context(), "127.0.0.1:0", NewStaticBootstrapper(nil), "9090", tt.opts...)
+			require.NoError(t, err)
+			t.Cleanup(func() {
+				require.NoError(t, router.host.Close())
+			})
+			ctx, cancel := context.WithTimeout(t.Context(), 5*time.Second)
+			defer cancel()
+			err = router.host.Connect(ctx, primaryInfo)
+			if tt.expectErr {
+				require.Error(t, err)
+				require.FalseT(t, primaryRouter.IsConnected(router.host.ID().String()))
+				return
+			}
+			require.NoError(t, err)
+			require.Eventually(t, func() bool {
+				return primaryRouter.IsConnected(router.host.ID().String())
+			}, 5*time.Second, 10*time.Millisecond)
+		})
+	}
+	require.FalseT(t, primaryRouter.IsConnected("invalid"))
+
+	_, err = NewP2PRouter(t.Context(), "127.0.0.1:0", NewStaticBootstrapper(nil), "9090", WithPSKPath(pskPath), WithTransports(TransportQUIC))
+	require.EqualError(t, err, "pre-shared key is not supported with the quic transport")
+	_, err = NewP2PRouter(t.Context(), "127.0.0.1:0", NewStaticBootstrapper(nil), "9090", WithPSKPath(filepath.Join(tmpDir, "missing.key")))
+	require.ErrorIs(t, err, os.ErrNotExist)
+	invalidPSKPath := filepath.Join(tmpDir, "invalid.key")
+	err = os.WriteFile(invalidPSKPath, []byte("foobar"), 0o600)
+	require.NoError(t, err)
+	_, err = NewP2PRouter(t.Context(), "127.0.0.1:0", NewStaticBootstrapper(nil), "9090", WithPSKPath(invalidPSKPath))
+	require.ErrorContains(t, err, "could not decode pre-shared key")
+}
+
+func TestP2PRouterPeerCache(t *testing.T) {
+	t.Parallel()
+
+	log := tlog.NewTestLogger(t)
+	ctx := logr.NewContext(t.Context(), log)
+	dataDir := t.TempDir()
+
+	primaryRouter, err := NewP2PRouter(ctx, "localhost:0", NewStaticBootstrapper(nil), "9090")
+	require.NoError(t, err)
+	primaryCtx, primaryCancel := context.WithCancel(ctx)
+	primaryGroup := errgroup.WithContext(primaryCtx)
+	primaryGroup.Go(func(ctx context.Context) error {
+		return primaryRouter.Run(ctx)
+	})
+	t.Cleanup(func() {
+		primaryCancel()
+		require.NoError(t, primaryGroup.Wait())
+	})
+
+	// Bootstrap with the primary router and persist it to the peer cache.
+	bs := NewStaticBootstrapper([]peer.AddrInfo{*host.InfoFromHost(primaryRouter.host)})
+	firstRouter, err := NewP2PRouter(ctx, "localhost:0", bs, "9090", WithDataDir(dataDir))
+	require.NoError(t, err)
+	firstCtx, firstCancel := context.WithCancel(ctx)
+	firstGroup := errgroup.WithContext(firstCtx)
+	firstGroup.Go(func(ctx context.Context) error {
+		return firstRouter.Run(ctx)
+	})
+	require.EventuallyWith(t, func(c *assert.CollectT) {
+		ready, err := firstRouter.Ready(ctx)
+		require.NoError(c, err)
+		require.TrueT(c, ready)
+	}, 5*time.Second, 100*time.Millisecond)
+	firstCancel()
+	err = firstGroup.Wait()
+	require.NoError(t, err)
+	addrInfos, err := newPeerCache(dataDir).Load()
+	require.NoError(t, err)
+	require.Len(t, addrInfos, 1)
+	require.EqualT(t, primaryRouter.host.ID(), addrInfos[0].ID)
+
+	// Restarting should bootstrap with the cached peers without any bootstrap peers.
+	secondRouter, err := NewP2PRouter(ctx, "localhost:0", NewStaticBootstrapper(nil), "9090", WithDataDir(dataDir))
+	require.NoError(t, err)
+	require.EqualT(t, firstRouter.host.ID(), secondRouter.host.ID())
+	secondCtx, secondCancel := context.WithCancel(ctx)
+	secondGroup := errgroup.WithContext(secondCtx)
+	secondGroup.Go(func(ctx context.Context) error {
+		return secondRouter.Run(ctx)
+	})
+	require.EventuallyWith(t, func(c *assert.CollectT) {
+		ready, err := secondRouter.Ready(ctx)
+		require.NoError(c, err)
+		require.TrueT(c, ready)
+	}, 5*time.Second, 100*time.Millisecond)
+	secondCancel()
+	err = secondGroup.Wait()
+	require.NoError(t, err)
+}
+
+func TestP2PRouterStalePeerCache(t *testing.T) {
+	t.Parallel()
+
+	log := tlog.NewTestLogger(t)
+	ctx := logr.NewContext(t.Context(), log)
+	dataDir := t.TempDir()
+
+	primaryRouter, err := NewP2PRouter(ctx, "localhost:0", NewStaticBootstrapper(nil), "9090")
+	require.NoError(t, err)
+	primaryCtx, primaryCancel := context.WithCancel(ctx)
+	primaryGroup := errgroup.WithContext(primaryCtx)
+	primaryGroup.Go(func(ctx context.Context) error {
+		return primaryRouter.Run(ctx)
+	})
+	t.Cleanup(func() {
+		primaryCancel()
+		require.NoError(t, primaryGroup.Wait())
+	})
+
+	// Cache peers that are no longer reachable.
+	staleAddrInfos := []peer.AddrInfo{}
+	for range 3 {
+		priv, _, err := crypto.GenerateEd25519Key(nil)
+		require.NoError(t, err)
+		id, err := peer.IDFromPrivateKey(priv)
+		require.NoError(t, err)
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		addrPort := netip.MustParseAddrPort(l.Addr().String())
+		require.NoError(t, l.Close())
+		addr, err := ma.NewMultiaddr(fmt.Sprintf("/ip4/127.0.0.1/tcp/%d", addrPort.Port()))
+		require.NoError(t, err)
+		staleAddrInfos = append(staleAddrInfos, peer.AddrInfo{ID: id, Addrs: []ma.Multiaddr{addr}})
+	}
+	err = newPeerCache(dataDir).Save(staleAddrInfos)
+	require.NoError(t, err)
+
+	// The bootstrapper should be used when none of the cached peers can be reached.
+	bs := NewStaticBootstrapper([]peer.AddrInfo{*host.InfoFromHost(primaryRouter.host)})
+	router, err := NewP2PRouter(ctx, "localhost:0", bs, "9090", WithDataDir(dataDir))
+	require.NoError(t, err)
+	routerCtx, routerCancel := context.WithCancel(ctx)
+	routerGroup := errgroup.WithContext(routerCtx)
+	routerGroup.Go(func(ctx context.Context) error {
+		return router.Run(ctx)
+	})
+	require.EventuallyWith(t, func(c *assert.CollectT) {
+		ready, err := router.Ready(ctx)
+		require.NoError(c, err)
+		require.TrueT(c, ready)
+	}, 5*time.Second, 100*time.Millisecond)
+
+	// Unreachable peers should be pruned from the cache.
+	addrInfos, err := newPeerCache(dataDir).Load()
+	require.NoError(t, err)
+	require.Empty(t, addrInfos)
+
+	routerCancel()
+	err = routerGroup.Wait()
+	require.NoError(t, err)
+	addrInfos, err = newPeerCache(dataDir).Load()
+	require.NoError(t, err)
+	require.Len(t, addrInfos, 1)
+	require.EqualT(t, primaryRouter.host.ID(), addrInfos[0].ID)
+}
+
+func TestToIPAddrs(t *testing.T) {
+	t.Parallel()
+
+	// Peers listening on multiple transports advertise the same IP more than once.
+	addrs := []ma.Multiaddr{
+		ma.StringCast("/ip4/10.0.0.1/udp/5001/quic-v1"),
+		ma.StringCast("/ip4/10.0.0.1/tcp/5001"),
+		ma.StringCast("/ip4/10.0.0.1/tcp/5001/ws"),
+		ma.StringCast("/ip6/fd00::1/tcp/5001"),
+		ma.StringCast("/ip6/fd00::1/udp/5001/quic-v1"),
+	}
+	ipAddrs, err := toIPAddrs(addrs)
+	require.NoError(t, err)
+	require.SliceEqualT(t, []netip.Addr{netip.MustParseAddr("10.0.0.1"), netip.MustParseAddr("fd00::1")}, ipAddrs)
+}
+
 func TestListenMultiaddrs(t *testing.T) {
 	t.Parallel()
 
 	tests := []struct {
 		name                string
 		addr                string
+		transports          []string
 		expectedListenAddrs []ma.Multiaddr
 	}{
 		{
-			name: "listen address type not specified",
-			addr: ":9090",
+			name:       "listen address type not specified",
+			addr:       ":9090",
+			transports: []string{TransportQUIC, TransportTCP},
 			expectedListenAddrs: []ma.Multiaddr{
 				ma.StringCast("/ip6/::/udp/9090/quic-v1"),
 				ma.StringCast("/ip6/::/tcp/9090"),
@@ -249,33 +535,85 @@ func TestListenMultiaddrs(t *testing.T) {
 			},
 		},
 		{
-			name: "ipv4 only",
-			addr: "192.168.1.24:7892",
+			name:       "ipv4 only",
+			addr:       "192.168.1.24:7892",
+			transports: []string{TransportQUIC, TransportTCP},
 			expectedListenAddrs: []ma.Multiaddr{
 				ma.StringCast("/ip4/192.168.1.24/udp/7892/quic-v1"),
 				ma.StringCast("/ip4/192.168.1.24/tcp/7892"),
 			},
 		},
 		{
-			name: "ipv6 only",
-			addr: "[::]:9090",
+			name:       "ipv6 only",
+			addr:       "[::]:9090",
+			transports: []string{TransportQUIC, TransportTCP},
 			expectedListenAddrs: []ma.Multiaddr{
 				ma.StringCast("/ip6/::/udp/9090/quic-v1"),
 				ma.StringCast("/ip6/::/tcp/9090"),
 			},
 		},
+		{
+			name:       "tcp only",
+			addr:       "192.168.1.24:5001",
+			transports: []string{TransportTCP},
+			expectedListenAddrs: []ma.Multiaddr{
+				ma.StringCast("/ip4/192.168.1.24/tcp/5001"),
+			},
+		},
+		{
+			name:       "websocket",
+			addr:       "192.168.1.24:5001",
+			transports: []string{TransportTCP, TransportWebSocket},
+			expectedListenAddrs: []ma.Multiaddr{
+				ma.StringCast("/ip4/192.168.1.24/tcp/5001"),
+				ma.StringCast("/ip4/192.168.1.24/tcp/5001/ws"),
+			},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			t.Parallel()
 
-			listenAddrs, err := listenMultiaddrs(tt.addr)
+			listenAddrs, err := listenMultiaddrs(tt.addr, tt.transports)
 			require.NoError(t, err)
+			require.Len(t, listenAddrs, len(tt.expectedListenAddrs))
 			for i, e := range tt.expectedListenAddrs {
 				require.EqualT(t, e.String(), listenAddrs[i].String())
 			}
 		})
 	}
+
+	_, err := listenMultiaddrs(":5001", []string{"foo"})
+	require.EqualError(t, err, "unknown transport foo")
+}
+
+func TestTransportOptions(t *testing.T) {
+	t.Parallel()
+
+	_, err := transportOptions([]string{TransportTCP, TransportQUIC, TransportWebSocket})
+	require.NoError(t, err)
+	_, err = transportOptions(nil)
+	require.EqualError(t, err, "at least one transport is required")
+	_, err = transportOptions([]string{TransportTCP, "foo"})
+	require.EqualError(t, err, "unknown transport foo")
+}
+
+func TestProtocolsFromAddrs(t *testing.T) {
+	t.Parallel()
+
+	addrs := []ma.Multiaddr{
+		ma.StringCast("/ip4/10.0.0.1/udp/5001/quic-v1"),
+		ma.StringCast("/ip4/10.0.0.1/tcp/5001"),
+		ma.StringCast("/ip6/fd00::1/udp/5001/quic-v1"),
+		ma.StringCast("/ip6/fd00::1/tcp/5001/ws"),
+		ma.StringCast("/ip4/10.0.0.1"),
+	}
+	protocols := protocolsFromAddrs(addrs)
+	expected := []string{"/udp/5001/quic-v1", "/tcp/5001", "/tcp/5001/ws"}
+	require.Len(t, protocols, len(expected))
+	for i, e := range expected {
+		require.EqualT(t, e, protocols[i].String())
+	}
 }
 
 func TestCreateCid(t *testing.T) {
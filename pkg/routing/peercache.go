@@ -0,0 +1,60 @@
+package routing
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+const (
+	peerCacheFileName = "peers.json"
+	peerCacheMaxPeers = 20
+)
+
+// peerCache persists recently seen peers in the data directory.
+// Cached peers are tried first when bootstrapping so that a restarted router does not depend on the bootstrapper.
+type peerCache struct {
+	path string
+}
+
+func newPeerCache(dataDir string) *peerCache {
+	return &peerCache{
+		path: filepath.Join(dataDir, peerCacheFileName),
+	}
+}
+
+// Load returns the cached peers. No peers are returned if nothing has been cached.
+func (c *peerCache) Load() ([]peer.AddrInfo, error) {
+	b, err := os.ReadFile(c.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	addrInfos := []peer.AddrInfo{}
+	err = json.Unmarshal(b, &addrInfos)
+	if err != nil {
+		return nil, err
+	}
+	return addrInfos, nil
+}
+
+// Save replaces the cached peers, keeping at most the first peerCacheMaxPeers peers.
+// The file is replaced atomically so that a crash never leaves a partially written cache.
+func (c *peerCache) Save(addrInfos []peer.AddrInfo) error {
+	addrInfos = addrInfos[:min(len(addrInfos), peerCacheMaxPeers)]
+	b, err := json.Marshal(addrInfos)
+	if err != nil {
+		return err
+	}
+	tmpPath := c.path + ".tmp"
+	err = os.WriteFile(tmpPath, b, 0o600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, c.path)
+}
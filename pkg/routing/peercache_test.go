@@ -0,0 +1,44 @@
+package routing
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-openapi/testify/v2/require"
+	"github.com/libp2p/go-libp2p/core/peer"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+func TestPeerCache(t *testing.T) {
+	t.Parallel()
+
+	dataDir := t.TempDir()
+	cache := newPeerCache(dataDir)
+
+	addrInfos, err := cache.Load()
+	require.NoError(t, err)
+	require.Empty(t, addrInfos)
+
+	expected := []peer.AddrInfo{}
+	for range peerCacheMaxPeers + 5 {
+		expected = append(expected, peer.AddrInfo{
+			ID:    testPeerID(t),
+			Addrs: []ma.Multiaddr{ma.StringCast("/ip4/10.0.0.1/tcp/5001")},
+		})
+	}
+	err = cache.Save(expected)
+	require.NoError(t, err)
+	addrInfos, err = cache.Load()
+	require.NoError(t, err)
+	require.Len(t, addrInfos, peerCacheMaxPeers)
+	for i, addrInfo := range addrInfos {
+		require.EqualT(t, expected[i].ID, addrInfo.ID)
+		require.TrueT(t, expected[i].Addrs[0].Equal(addrInfo.Addrs[0]))
+	}
+
+	err = os.WriteFile(filepath.Join(dataDir, peerCacheFileName), []byte("foo"), 0o600)
+	require.NoError(t, err)
+	_, err = cache.Load()
+	require.Error(t, err)
+}
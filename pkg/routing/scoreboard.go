@@ -0,0 +1,179 @@
+package routing
+
+import (
+	"maps"
+	"sync"
+	"time"
+
+	"github.com/spegel-org/spegel/pkg/metrics"
+)
+
+const (
+	scoreboardFailureThreshold = 3
+	scoreboardOpenDuration     = 30 * time.Second
+	scoreboardDecay            = 0.2
+	scoreboardTTL              = 10 * time.Minute
+	scoreboardMaxPeers         = 1024
+)
+
+// CircuitState is the state of the circuit breaker of a peer.
+type CircuitState string
+
+const (
+	// CircuitClosed allows fetching from the peer.
+	CircuitClosed CircuitState = "closed"
+	// CircuitOpen excludes the peer from lookups after consecutive failures.
+	CircuitOpen CircuitState = "open"
+	// CircuitHalfOpen allows a single lookup to try the peer again.
+	CircuitHalfOpen CircuitState = "half-open"
+)
+
+// PeerScore is the health of a peer based on the results of fetching from it.
+type PeerScore struct {
+	// Updated is when the last result was recorded.
+	Updated time.Time
+	// LastErrorTime is when the last error was recorded.
+	LastErrorTime time.Time
+	// LastError is the message of the last error.
+	LastError string
+	// State is the state of the circuit breaker.
+	State CircuitState
+	// SuccessRate is the moving average of successful fetches between zero and one.
+	SuccessRate float64
+	// Latency is the moving average of the time to fetch from the peer.
+	Latency time.Duration
+	// ConsecutiveFailures is the amount of failures since the last success.
+	ConsecutiveFailures int
+}
+
+// Scoreboard tracks the health of peers across lookups.
+// Peers which fail consecutively have their circuit opened and are excluded from new iterators.
+// Once the circuit has been open for a while a single lookup is allowed to try the peer again.
+type Scoreboard struct {
+	scores    map[string]*peerScore
+	openCount int
+	mx        sync.Mutex
+}
+
+type peerScore struct {
+	openUntil time.Time
+	PeerScore
+}
+
+func NewScoreboard() *Scoreboard {
+	return &Scoreboard{
+		scores: map[string]*peerScore{},
+	}
+}
+
+// RecordSuccess records a successful fetch from the peer, closing its circuit.
+func (s *Scoreboard) RecordSuccess(host string, latency time.Duration) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	score, ok := s.score(host)
+	if !ok {
+		score.SuccessRate = 1
+		score.Latency = latency
+	} else {
+		score.SuccessRate = decay(score.SuccessRate, 1)
+		score.Latency = time.Duration(decay(float64(score.Latency), float64(latency)))
+	}
+	score.ConsecutiveFailures = 0
+	s.transition(score, CircuitClosed)
+}
+
+// RecordFailure records a failed fetch from the peer.
+// The circuit is opened once the failure threshold is reached or if the peer fails while half open.
+func (s *Scoreboard) RecordFailure(host string, err error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	score, ok := s.score(host)
+	if !ok {
+		score.SuccessRate = 0
+	} else {
+		score.SuccessRate = decay(score.SuccessRate, 0)
+	}
+	score.ConsecutiveFailures += 1
+	score.LastErrorTime = score.Updated
+	if err != nil {
+		score.LastError = err.Error()
+	}
+	if score.State == CircuitHalfOpen || score.ConsecutiveFailures >= scoreboardFailureThreshold {
+		score.openUntil = score.Updated.Add(scoreboardOpenDuration)
+		s.transition(score, CircuitOpen)
+	}
+}
+
+// Allow returns true if the peer should be included in a lookup.
+// A peer with an expired open circuit becomes half open and is allowed once until a result is recorded or the open duration passes again.
+func (s *Scoreboard) Allow(host string) bool {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	score, ok := s.scores[host]
+	if !ok || score.State == CircuitClosed {
+		return true
+	}
+	now := time.Now()
+	if now.Before(score.openUntil) {
+		return false
+	}
+	score.openUntil = now.Add(scoreboardOpenDuration)
+	s.transition(score, CircuitHalfOpen)
+	return true
+}
+
+// Scores returns a copy of the score of all tracked peers.
+func (s *Scoreboard) Scores() map[string]PeerScore {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	scores := map[string]PeerScore{}
+	for host, score := range s.scores {
+		scores[host] = score.PeerScore
+	}
+	return scores
+}
+
+// score returns the score of the peer, creating it if it does not exist.
+// Closed circuits which have not been updated recently are removed when the scoreboard is full.
+func (s *Scoreboard) score(host string) (*peerScore, bool) {
+	now := time.Now()
+	score, ok := s.scores[host]
+	if !ok {
+		if len(s.scores) >= scoreboardMaxPeers {
+			maps.DeleteFunc(s.scores, func(_ string, score *peerScore) bool {
+				return score.State == CircuitClosed && now.Sub(score.Updated) > scoreboardTTL
+			})
+		}
+		score = &peerScore{
+			PeerScore: PeerScore{
+				State: CircuitClosed,
+			},
+		}
+		s.scores[host] = score
+	}
+	score.Updated = now
+	return score, ok
+}
+
+func (s *Scoreboard) transition(score *peerScore, state CircuitState) {
+	if score.State == state {
+		return
+	}
+	if score.State == CircuitClosed {
+		s.openCount += 1
+	}
+	if state == CircuitClosed {
+		s.openCount -= 1
+	}
+	score.State = state
+	metrics.PeerCircuitTransitionsTotal.WithLabelValues(string(state)).Inc()
+	metrics.PeerCircuitsOpen.Set(float64(s.openCount))
+}
+
+func decay(avg, v float64) float64 {
+	return avg + scoreboardDecay*(v-avg)
+}
@@ -0,0 +1,76 @@
+package routing
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"testing/synctest"
+	"time"
+
+	"github.com/go-openapi/testify/v2/require"
+)
+
+func TestScoreboard(t *testing.T) {
+	t.Parallel()
+
+	synctest.Test(t, func(t *testing.T) {
+		scoreboard := NewScoreboard()
+		require.TrueT(t, scoreboard.Allow("foo"))
+		require.Empty(t, scoreboard.Scores())
+
+		scoreboard.RecordSuccess("foo", 100*time.Millisecond)
+		scoreboard.RecordSuccess("foo", 200*time.Millisecond)
+		score := scoreboard.Scores()["foo"]
+		require.EqualT(t, CircuitClosed, score.State)
+		require.InDeltaT(t, 1, score.SuccessRate, 0.001)
+		require.EqualT(t, 120*time.Millisecond, score.Latency)
+
+		// The circuit opens once the failure threshold is reached.
+		for range scoreboardFailureThreshold - 1 {
+			scoreboard.RecordFailure("foo", errors.New("connection refused"))
+			require.TrueT(t, scoreboard.Allow("foo"))
+		}
+		scoreboard.RecordFailure("foo", errors.New("connection reset"))
+		require.FalseT(t, scoreboard.Allow("foo"))
+		score = scoreboard.Scores()["foo"]
+		require.EqualT(t, CircuitOpen, score.State)
+		require.EqualT(t, scoreboardFailureThreshold, score.ConsecutiveFailures)
+		require.InDeltaT(t, 0.512, score.SuccessRate, 0.001)
+		require.EqualT(t, "connection reset", score.LastError)
+		require.EqualT(t, time.Now(), score.LastErrorTime)
+
+		// A single lookup is allowed to try the peer once the circuit has been open long enough.
+		time.Sleep(scoreboardOpenDuration)
+		require.TrueT(t, scoreboard.Allow("foo"))
+		require.FalseT(t, scoreboard.Allow("foo"))
+		require.EqualT(t, CircuitHalfOpen, scoreboard.Scores()["foo"].State)
+
+		// A failure while half open opens the circuit again.
+		scoreboard.RecordFailure("foo", errors.New("timeout"))
+		require.EqualT(t, CircuitOpen, scoreboard.Scores()["foo"].State)
+		require.FalseT(t, scoreboard.Allow("foo"))
+
+		// A success while half open closes the circuit.
+		time.Sleep(scoreboardOpenDuration)
+		require.TrueT(t, scoreboard.Allow("foo"))
+		scoreboard.RecordSuccess("foo", 100*time.Millisecond)
+		score = scoreboard.Scores()["foo"]
+		require.EqualT(t, CircuitClosed, score.State)
+		require.EqualT(t, 0, score.ConsecutiveFailures)
+		require.TrueT(t, scoreboard.Allow("foo"))
+		require.EqualT(t, 0, scoreboard.openCount)
+
+		// Stale closed circuits are removed when the max amount of peers is reached.
+		scoreboard.RecordFailure("bar", nil)
+		scoreboard.RecordFailure("bar", nil)
+		scoreboard.RecordFailure("bar", nil)
+		time.Sleep(scoreboardTTL + time.Second)
+		for i := range scoreboardMaxPeers - 1 {
+			scoreboard.RecordSuccess(strconv.Itoa(i), time.Millisecond)
+		}
+		require.Len(t, scoreboard.scores, scoreboardMaxPeers)
+		_, ok := scoreboard.Scores()["foo"]
+		require.FalseT(t, ok)
+		require.EqualT(t, CircuitOpen, scoreboard.Scores()["bar"].State)
+	})
+}
@@ -0,0 +1,81 @@
+package routing
+
+import (
+	"crypto/tls"
+	"errors"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	libp2ptls "github.com/libp2p/go-libp2p/p2p/security/tls"
+)
+
+// PeerTLS provides TLS configurations with a certificate bound to the libp2p peer identity.
+// The certificate is self signed and contains the public peer key signed by the private peer key.
+type PeerTLS struct {
+	cert tls.Certificate
+}
+
+func NewPeerTLS(privKey crypto.PrivKey) (*PeerTLS, error) {
+	if privKey == nil {
+		return nil, errors.New("private key cannot be nil")
+	}
+	identity, err := libp2ptls.NewIdentity(privKey)
+	if err != nil {
+		return nil, err
+	}
+	identityConfig, _ := identity.ConfigForPeer("")
+	if len(identityConfig.Certificates) != 1 {
+		return nil, errors.New("expected a single identity certificate")
+	}
+	return &PeerTLS{
+		cert: identityConfig.Certificates[0],
+	}, nil
+}
+
+// ServerTLSConfig returns a server configuration which requests client certificates and verifies them when given.
+// Requiring a client certificate is left to the handler so that clients without one can still be served.
+func (p *PeerTLS) ServerTLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion:   tls.VersionTLS13,
+		Certificates: []tls.Certificate{p.cert},
+		ClientAuth:   tls.RequestClientCert,
+		VerifyConnection: func(cs tls.ConnectionState) error {
+			if len(cs.PeerCertificates) == 0 {
+				return nil
+			}
+			_, err := PeerIdentity(cs)
+			return err
+		},
+	}
+}
+
+// ClientTLSConfig returns a client configuration which presents the certificate and verifies that the server certificate is bound to a peer identity.
+// Matching the identity with the expected peer is done per request as connections are reused.
+func (p *PeerTLS) ClientTLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion:   tls.VersionTLS13,
+		Certificates: []tls.Certificate{p.cert},
+		//nolint: gosec // Certificate is verified in VerifyConnection with the peer key.
+		InsecureSkipVerify: true,
+		VerifyConnection: func(cs tls.ConnectionState) error {
+			_, err := PeerIdentity(cs)
+			return err
+		},
+	}
+}
+
+// PeerIdentity returns the peer ID which the TLS certificate of the connection is bound to.
+func PeerIdentity(cs tls.ConnectionState) (string, error) {
+	if len(cs.PeerCertificates) == 0 {
+		return "", errors.New("no peer certificate presented")
+	}
+	pubKey, err := libp2ptls.PubKeyFromCertChain(cs.PeerCertificates)
+	if err != nil {
+		return "", err
+	}
+	id, err := peer.IDFromPublicKey(pubKey)
+	if err != nil {
+		return "", err
+	}
+	return id.String(), nil
+}
@@ -0,0 +1,57 @@
+package routing
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"net"
+	"testing"
+
+	"github.com/go-openapi/testify/v2/require"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+func TestPeerTLS(t *testing.T) {
+	t.Parallel()
+
+	_, err := NewPeerTLS(nil)
+	require.EqualError(t, err, "private key cannot be nil")
+
+	serverKey, _, err := crypto.GenerateEd25519Key(rand.Reader)
+	require.NoError(t, err)
+	serverID, err := peer.IDFromPrivateKey(serverKey)
+	require.NoError(t, err)
+	serverTLS, err := NewPeerTLS(serverKey)
+	require.NoError(t, err)
+	clientKey, _, err := crypto.GenerateEd25519Key(rand.Reader)
+	require.NoError(t, err)
+	clientID, err := peer.IDFromPrivateKey(clientKey)
+	require.NoError(t, err)
+	clientTLS, err := NewPeerTLS(clientKey)
+	require.NoError(t, err)
+
+	serverConn, clientConn := net.Pipe()
+	t.Cleanup(func() {
+		serverConn.Close()
+		clientConn.Close()
+	})
+	server := tls.Server(serverConn, serverTLS.ServerTLSConfig())
+	client := tls.Client(clientConn, clientTLS.ClientTLSConfig())
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- server.HandshakeContext(t.Context())
+	}()
+	err = client.HandshakeContext(t.Context())
+	require.NoError(t, err)
+	require.NoError(t, <-errCh)
+
+	identity, err := PeerIdentity(client.ConnectionState())
+	require.NoError(t, err)
+	require.EqualT(t, serverID.String(), identity)
+	identity, err = PeerIdentity(server.ConnectionState())
+	require.NoError(t, err)
+	require.EqualT(t, clientID.String(), identity)
+
+	_, err = PeerIdentity(tls.ConnectionState{})
+	require.EqualError(t, err, "no peer certificate presented")
+}
@@ -0,0 +1,172 @@
+package routing
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+)
+
+const (
+	topologyProtocolID   = protocol.ID("/spegel/topology/1.0.0")
+	topologyPeerstoreKey = "spegel/topology"
+	topologyTimeout      = 10 * time.Second
+	topologyMaxSize      = 4096
+)
+
+// Topology describes where a peer is located.
+type Topology struct {
+	Region string `json:"region,omitempty"`
+	Zone   string `json:"zone,omitempty"`
+	Rack   string `json:"rack,omitempty"`
+}
+
+// IsZero returns true if no topology is set.
+func (t Topology) IsZero() bool {
+	return t == Topology{}
+}
+
+// Locality describes how close a peer is relative to the local peer.
+type Locality string
+
+const (
+	// LocalityRack is a peer in the same rack, zone and region.
+	LocalityRack Locality = "rack"
+	// LocalityZone is a peer in the same zone and region but not known to be in the same rack.
+	LocalityZone Locality = "zone"
+	// LocalityRegion is a peer in the same region but not known to be in the same zone.
+	LocalityRegion Locality = "region"
+	// LocalityRemote is a peer in another region.
+	LocalityRemote Locality = "remote"
+	// LocalityUnknown is a peer for which the locality can not be determined.
+	LocalityUnknown Locality = "unknown"
+)
+
+// Locality returns the locality of the other topology relative to this topology.
+func (t Topology) Locality(other Topology) Locality {
+	if t.Region == "" || other.Region == "" {
+		return LocalityUnknown
+	}
+	if t.Region != other.Region {
+		return LocalityRemote
+	}
+	if t.Zone == "" || t.Zone != other.Zone {
+		return LocalityRegion
+	}
+	if t.Rack != "" && t.Rack == other.Rack {
+		return LocalityRack
+	}
+	return LocalityZone
+}
+
+// TopologyPolicy decides which peers are preferred based on their locality.
+type TopologyPolicy string
+
+const (
+	// TopologyPolicyNone selects peers by usage only.
+	TopologyPolicyNone TopologyPolicy = "none"
+	// TopologyPolicyRack prefers peers in the same rack, then peers in the same zone, then peers in the same region.
+	TopologyPolicyRack TopologyPolicy = "rack"
+	// TopologyPolicyZone prefers peers in the same zone, then peers in the same region.
+	TopologyPolicyZone TopologyPolicy = "zone"
+	// TopologyPolicyRegion prefers peers in the same region.
+	TopologyPolicyRegion TopologyPolicy = "region"
+)
+
+// ParseTopologyPolicy returns the topology policy with the given name.
+func ParseTopologyPolicy(s string) (TopologyPolicy, error) {
+	switch policy := TopologyPolicy(s); policy {
+	case TopologyPolicyNone, TopologyPolicyRack, TopologyPolicyZone, TopologyPolicyRegion:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown topology policy %s", s)
+	}
+}
+
+// rank returns the preference of the locality, where a lower rank is preferred.
+func (p TopologyPolicy) rank(locality Locality) int {
+	switch p {
+	case TopologyPolicyRack:
+		switch locality {
+		case LocalityRack:
+			return 0
+		case LocalityZone:
+			return 1
+		case LocalityRegion:
+			return 2
+		default:
+			return 3
+		}
+	case TopologyPolicyZone:
+		switch locality {
+		case LocalityRack, LocalityZone:
+			return 0
+		case LocalityRegion:
+			return 1
+		default:
+			return 2
+		}
+	case TopologyPolicyRegion:
+		switch locality {
+		case LocalityRack, LocalityZone, LocalityRegion:
+			return 0
+		default:
+			return 1
+		}
+	default:
+		return 0
+	}
+}
+
+// topologyHandler responds to streams with the local topology.
+func topologyHandler(topology Topology) network.StreamHandler {
+	return func(s network.Stream) {
+		defer s.Close()
+		err := json.NewEncoder(s).Encode(topology)
+		if err != nil {
+			//nolint: errcheck // Nothing to do if the reset fails.
+			s.Reset()
+		}
+	}
+}
+
+// fetchTopology requests the topology from the peer and stores it in the peerstore.
+func fetchTopology(ctx context.Context, h host.Host, id peer.ID) error {
+	ctx, cancel := context.WithTimeout(ctx, topologyTimeout)
+	defer cancel()
+
+	s, err := h.NewStream(ctx, id, topologyProtocolID)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	err = s.SetDeadline(time.Now().Add(topologyTimeout))
+	if err != nil {
+		return err
+	}
+	topology := Topology{}
+	err = json.NewDecoder(io.LimitReader(s, topologyMaxSize)).Decode(&topology)
+	if err != nil {
+		return fmt.Errorf("could not decode topology from peer %s: %w", id, err)
+	}
+	return h.Peerstore().Put(id, topologyPeerstoreKey, topology)
+}
+
+// peerTopology returns the topology of the peer if it is known.
+func peerTopology(h host.Host, id peer.ID) Topology {
+	v, err := h.Peerstore().Get(id, topologyPeerstoreKey)
+	if err != nil {
+		return Topology{}
+	}
+	topology, ok := v.(Topology)
+	if !ok {
+		return Topology{}
+	}
+	return topology
+}
@@ -0,0 +1,170 @@
+package routing
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-openapi/testify/v2/assert"
+	"github.com/go-openapi/testify/v2/require"
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	"github.com/kvick-org/pkg/errgroup"
+)
+
+func TestTopologyLocality(t *testing.T) {
+	t.Parallel()
+
+	//nolint: govet // Prioritize readability in tests.
+	tests := []struct {
+		name     string
+		local    Topology
+		other    Topology
+		expected Locality
+	}{
+		{
+			name:     "same rack",
+			local:    Topology{Region: "eu", Zone: "a", Rack: "1"},
+			other:    Topology{Region: "eu", Zone: "a", Rack: "1"},
+			expected: LocalityRack,
+		},
+		{
+			name:     "same rack in other zone",
+			local:    Topology{Region: "eu", Zone: "a", Rack: "1"},
+			other:    Topology{Region: "eu", Zone: "b", Rack: "1"},
+			expected: LocalityRegion,
+		},
+		{
+			name:     "same zone without rack",
+			local:    Topology{Region: "eu", Zone: "a"},
+			other:    Topology{Region: "eu", Zone: "a"},
+			expected: LocalityZone,
+		},
+		{
+			name:     "same zone",
+			local:    Topology{Region: "eu", Zone: "a", Rack: "1"},
+			other:    Topology{Region: "eu", Zone: "a", Rack: "2"},
+			expected: LocalityZone,
+		},
+		{
+			name:     "same region",
+			local:    Topology{Region: "eu", Zone: "a"},
+			other:    Topology{Region: "eu", Zone: "b"},
+			expected: LocalityRegion,
+		},
+		{
+			name:     "same region without zone",
+			local:    Topology{Region: "eu"},
+			other:    Topology{Region: "eu"},
+			expected: LocalityRegion,
+		},
+		{
+			name:     "other region",
+			local:    Topology{Region: "eu", Zone: "a"},
+			other:    Topology{Region: "us", Zone: "a"},
+			expected: LocalityRemote,
+		},
+		{
+			name:     "unknown local",
+			local:    Topology{},
+			other:    Topology{Region: "eu", Zone: "a"},
+			expected: LocalityUnknown,
+		},
+		{
+			name:     "unknown other",
+			local:    Topology{Region: "eu", Zone: "a"},
+			other:    Topology{Zone: "a"},
+			expected: LocalityUnknown,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			require.EqualT(t, tt.expected, tt.local.Locality(tt.other))
+		})
+	}
+}
+
+func TestTopologyPolicy(t *testing.T) {
+	t.Parallel()
+
+	for _, s := range []string{"none", "rack", "zone", "region"} {
+		policy, err := ParseTopologyPolicy(s)
+		require.NoError(t, err)
+		require.EqualT(t, TopologyPolicy(s), policy)
+	}
+	_, err := ParseTopologyPolicy("host")
+	require.EqualError(t, err, "unknown topology policy host")
+
+	localities := []Locality{LocalityRack, LocalityZone, LocalityRegion, LocalityRemote, LocalityUnknown}
+	expected := map[TopologyPolicy][]int{
+		TopologyPolicyNone:   {0, 0, 0, 0, 0},
+		TopologyPolicyRack:   {0, 1, 2, 3, 3},
+		TopologyPolicyZone:   {0, 0, 1, 2, 2},
+		TopologyPolicyRegion: {0, 0, 0, 1, 1},
+	}
+	for policy, ranks := range expected {
+		for i, locality := range localities {
+			require.EqualT(t, ranks[i], policy.rank(locality))
+		}
+	}
+}
+
+func TestFetchTopology(t *testing.T) {
+	t.Parallel()
+
+	topology := Topology{Region: "eu", Zone: "a", Rack: "1"}
+	server, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		require.NoError(t, server.Close())
+	})
+	server.SetStreamHandler(topologyProtocolID, topologyHandler(topology))
+	client, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		require.NoError(t, client.Close())
+	})
+
+	require.EqualT(t, Topology{}, peerTopology(client, server.ID()))
+	err = client.Connect(t.Context(), peer.AddrInfo{ID: server.ID(), Addrs: server.Addrs()})
+	require.NoError(t, err)
+	err = fetchTopology(t.Context(), client, server.ID())
+	require.NoError(t, err)
+	require.EqualT(t, topology, peerTopology(client, server.ID()))
+
+	// Peers without the protocol should fail.
+	err = fetchTopology(t.Context(), server, client.ID())
+	require.Error(t, err)
+}
+
+func TestP2PRouterTopology(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(t.Context())
+	primaryRouter, err := NewP2PRouter(ctx, "127.0.0.1:0", NewStaticBootstrapper(nil), "9090", WithTopology(Topology{Region: "eu", Zone: "a"}, TopologyPolicyZone))
+	require.NoError(t, err)
+	group := errgroup.WithContext(ctx)
+	group.Go(func(ctx context.Context) error {
+		return primaryRouter.Run(ctx)
+	})
+	t.Cleanup(func() {
+		cancel()
+		require.NoError(t, group.Wait())
+	})
+	otherRouter, err := NewP2PRouter(ctx, "127.0.0.1:0", NewStaticBootstrapper(nil), "9090", WithTopology(Topology{Region: "eu", Zone: "b"}, TopologyPolicyZone))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		require.NoError(t, otherRouter.host.Close())
+	})
+
+	err = otherRouter.host.Connect(ctx, peer.AddrInfo{ID: primaryRouter.host.ID(), Addrs: primaryRouter.host.Network().ListenAddresses()})
+	require.NoError(t, err)
+	require.EventuallyWith(t, func(c *assert.CollectT) {
+		metadata := primaryRouter.peerMetadata(otherRouter.host.ID())
+		require.EqualT(c, Topology{Region: "eu", Zone: "b"}, metadata.Topology)
+		require.EqualT(c, LocalityRegion, metadata.Locality)
+	}, 5*time.Second, 100*time.Millisecond)
+}
@@ -4,8 +4,10 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/go-logr/logr"
+	"github.com/opencontainers/go-digest"
 
 	"github.com/spegel-org/spegel/internal/option"
 	"github.com/spegel-org/spegel/pkg/metrics"
@@ -33,25 +35,27 @@ func Track(ctx context.Context, ociStore oci.Store, router routing.Router, opts
 		return err
 	}
 
-	initial, eventCh, err := ociStore.Subscribe(ctx)
+	nsInitial, eventCh, err := subscribe(ctx, ociStore)
 	if err != nil {
 		return err
 	}
 
 	// Initial advertisement of all content.
 	keys := []string{}
-	for img, dgsts := range initial {
-		if !oci.MatchesFilter(img.Reference, cfg.Filters) {
-			tagName, ok := img.TagName()
-			if ok {
-				metrics.AdvertisedImageTags.WithLabelValues(img.Registry).Inc()
-				keys = append(keys, tagName)
+	for ns, initial := range nsInitial {
+		for img, dgsts := range initial {
+			if !oci.MatchesFilter(img.Reference, cfg.Filters) {
+				tagName, ok := img.TagName()
+				if ok {
+					metrics.AdvertisedImageTags.WithLabelValues(img.Registry, ns).Inc()
+					keys = append(keys, tagName)
+				}
+			}
+			metrics.AdvertisedImageDigests.WithLabelValues(img.Registry, ns).Inc()
+			for _, dgst := range dgsts {
+				metrics.AdvertisedContentDigests.WithLabelValues(img.Registry, ns).Inc()
+				keys = append(keys, dgst.String())
 			}
-		}
-		metrics.AdvertisedImageDigests.WithLabelValues(img.Registry).Inc()
-		for _, dgst := range dgsts {
-			metrics.AdvertisedContentDigests.WithLabelValues(img.Registry).Inc()
-			keys = append(keys, dgst.String())
 		}
 	}
 	err = router.Advertise(ctx, keys)
@@ -78,6 +82,73 @@ func Track(ctx context.Context, ociStore oci.Store, router routing.Router, opts
 	}
 }
 
+// TrackIngests advertises content while it is being written to the store, including content written by the container runtime.
+// Ingests are polled as container runtimes do not publish events when writes start.
+// Content is withdrawn when its ingest is removed without the content being committed.
+func TrackIngests(ctx context.Context, ingestStore oci.IngestStore, router routing.Router, interval time.Duration) error {
+	log := logr.FromContextOrDiscard(ctx)
+
+	advertised := map[digest.Digest]any{}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+
+		dgsts, err := ingestStore.ListIngests(ctx)
+		if err != nil {
+			log.Error(err, "could not list ingests")
+			continue
+		}
+		current := map[digest.Digest]any{}
+		for _, dgst := range dgsts {
+			current[dgst] = nil
+			if _, ok := advertised[dgst]; ok {
+				continue
+			}
+			err := router.Advertise(ctx, []string{dgst.String()})
+			if err != nil {
+				log.Error(err, "could not advertise ingest", "digest", dgst)
+				continue
+			}
+			advertised[dgst] = nil
+		}
+		for dgst := range advertised {
+			if _, ok := current[dgst]; ok {
+				continue
+			}
+			// Committed content is advertised through store events.
+			_, err := ingestStore.Descriptor(ctx, dgst)
+			if err == nil {
+				delete(advertised, dgst)
+				continue
+			}
+			err = router.Withdraw(ctx, []string{dgst.String()})
+			if err != nil {
+				log.Error(err, "could not withdraw ingest", "digest", dgst)
+				continue
+			}
+			delete(advertised, dgst)
+		}
+	}
+}
+
+// subscribe returns the initial state grouped by namespace, stores without namespaces use an empty namespace.
+func subscribe(ctx context.Context, ociStore oci.Store) (map[string]map[oci.Image][]digest.Digest, <-chan oci.OCIEvent, error) {
+	namespacedStore, ok := ociStore.(oci.NamespacedStore)
+	if ok {
+		return namespacedStore.SubscribeNamespaces(ctx)
+	}
+	initial, eventCh, err := ociStore.Subscribe(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	return map[string]map[oci.Image][]digest.Digest{"": initial}, eventCh, nil
+}
+
 func handleEvent(ctx context.Context, router routing.Router, event oci.OCIEvent, filters []oci.Filter) error {
 	if oci.MatchesFilter(event.Reference, filters) {
 		return nil
@@ -86,9 +157,9 @@ func handleEvent(ctx context.Context, router routing.Router, event oci.OCIEvent,
 	switch event.Type {
 	case oci.CreateEvent:
 		if event.Reference.Tag != "" {
-			metrics.AdvertisedImageTags.WithLabelValues(event.Reference.Registry).Inc()
+			metrics.AdvertisedImageTags.WithLabelValues(event.Reference.Registry, event.Namespace).Inc()
 		} else {
-			metrics.AdvertisedContentDigests.WithLabelValues(event.Reference.Registry).Inc()
+			metrics.AdvertisedContentDigests.WithLabelValues(event.Reference.Registry, event.Namespace).Inc()
 		}
 		err := router.Advertise(ctx, []string{event.Reference.Identifier()})
 		if err != nil {
@@ -97,9 +168,9 @@ func handleEvent(ctx context.Context, router routing.Router, event oci.OCIEvent,
 		return nil
 	case oci.DeleteEvent:
 		if event.Reference.Tag != "" {
-			metrics.AdvertisedImageTags.WithLabelValues(event.Reference.Registry).Dec()
+			metrics.AdvertisedImageTags.WithLabelValues(event.Reference.Registry, event.Namespace).Dec()
 		} else {
-			metrics.AdvertisedContentDigests.WithLabelValues(event.Reference.Registry).Dec()
+			metrics.AdvertisedContentDigests.WithLabelValues(event.Reference.Registry, event.Namespace).Dec()
 		}
 		err := router.Withdraw(ctx, []string{event.Reference.Identifier()})
 		if err != nil {
@@ -139,3 +139,48 @@ func TestTrack(t *testing.T) {
 		})
 	}
 }
+
+func TestTrackIngests(t *testing.T) {
+	t.Parallel()
+
+	ociStore := oci.NewMemory()
+	router := routing.NewMemoryRouter(map[string][]routing.Peer{}, routing.Peer{Host: "self"})
+	ctx, cancel := context.WithCancel(t.Context())
+	group := errgroup.WithContext(ctx)
+	group.Go(func(ctx context.Context) error {
+		return TrackIngests(ctx, ociStore, router, 10*time.Millisecond)
+	})
+
+	advertised := func(dgst digest.Digest) func() bool {
+		return func() bool {
+			peers, _ := router.Get(dgst.String())
+			return len(peers) == 1
+		}
+	}
+
+	// Ingests which are aborted are withdrawn.
+	abortedDesc := ocispec.Descriptor{Digest: digest.FromString("aborted"), Size: 7}
+	abortedWriter, err := ociStore.Writer(t.Context(), oci.Reference{}, abortedDesc)
+	require.NoError(t, err)
+	require.Eventually(t, advertised(abortedDesc.Digest), 5*time.Second, 10*time.Millisecond)
+	err = abortedWriter.Close()
+	require.NoError(t, err)
+	require.Eventually(t, func() bool { return !advertised(abortedDesc.Digest)() }, 5*time.Second, 10*time.Millisecond)
+
+	// Ingests which are committed stay advertised.
+	committedDesc := ocispec.Descriptor{MediaType: "dummy", Digest: digest.FromString("committed"), Size: 9}
+	committedWriter, err := ociStore.Writer(t.Context(), oci.Reference{}, committedDesc)
+	require.NoError(t, err)
+	require.Eventually(t, advertised(committedDesc.Digest), 5*time.Second, 10*time.Millisecond)
+	_, err = committedWriter.Write([]byte("committed"))
+	require.NoError(t, err)
+	err = committedWriter.Commit(t.Context())
+	require.NoError(t, err)
+	err = committedWriter.Close()
+	require.NoError(t, err)
+	require.Never(t, func() bool { return !advertised(committedDesc.Digest)() }, 100*time.Millisecond, 10*time.Millisecond)
+
+	cancel()
+	err = group.Wait()
+	require.ErrorIs(t, err, context.Canceled)
+}
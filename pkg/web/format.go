@@ -75,3 +75,7 @@ func formatDuration(d time.Duration) string {
 	}
 	return strings.Join(comps, " ")
 }
+
+func formatPercent(ratio float64) string {
+	return fmt.Sprintf("%.0f%%", ratio*100)
+}
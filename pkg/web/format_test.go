@@ -70,3 +70,33 @@ func TestDuration(t *testing.T) {
 		})
 	}
 }
+
+func TestFormatPercent(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		expected string
+		ratio    float64
+	}{
+		{
+			ratio:    0,
+			expected: "0%",
+		},
+		{
+			ratio:    0.488,
+			expected: "49%",
+		},
+		{
+			ratio:    1,
+			expected: "100%",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expected, func(t *testing.T) {
+			t.Parallel()
+
+			result := formatPercent(tt.ratio)
+			require.EqualT(t, tt.expected, result)
+		})
+	}
+}
@@ -72,6 +72,7 @@ func NewWeb(router *routing.P2PRouter, ociStore oci.Store, reg *registry.Registr
 		"join":           joinStrings,
 		"formatBytes":    formatBytes,
 		"formatDuration": formatDuration,
+		"formatPercent":  formatPercent,
 	}
 	tmpls, err := template.New("").Funcs(funcs).ParseFS(templatesFS, "templates/*")
 	if err != nil {
@@ -132,6 +133,7 @@ type statsData struct {
 	LocalAddresses    []netip.Addr
 	Images            []oci.Image
 	Peers             []routing.Peer
+	PeerScores        map[string]routing.PeerScore
 	MirrorLastSuccess time.Duration
 }
 
@@ -168,6 +170,7 @@ func (w *Web) statsHandler(rw httpx.ResponseWriter, req *http.Request) {
 		return
 	}
 	data.Peers = peers
+	data.PeerScores = w.router.PeerScores()
 
 	httpx.RenderTemplate(rw, w.tmpls.Lookup("stats.html"), data)
 }
@@ -48,9 +48,12 @@ func TestWeb(t *testing.T) {
 	require.EqualT(t, http.StatusOK, resp.StatusCode)
 
 	stats := statsData{
-		LocalAddresses:    []netip.Addr{{}},
-		Images:            []oci.Image{{}},
-		Peers:             []routing.Peer{{}},
+		LocalAddresses: []netip.Addr{{}},
+		Images:         []oci.Image{{}},
+		Peers:          []routing.Peer{{}},
+		PeerScores: map[string]routing.PeerScore{
+			"foo": {State: routing.CircuitOpen, SuccessRate: 0.5, Latency: time.Second, LastError: "error"},
+		},
 		MirrorLastSuccess: 1 * time.Minute,
 	}
 	rw, rec = httpx.NewRecorder()
@@ -3,8 +3,11 @@ package containerd
 import (
 	"context"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
 	"time"
 
@@ -13,6 +16,7 @@ import (
 	"github.com/moby/moby/api/types/container"
 	"github.com/moby/moby/api/types/mount"
 	"github.com/moby/moby/client"
+	"github.com/opencontainers/go-digest"
 	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
@@ -83,6 +87,9 @@ func TestContainerdPull(t *testing.T) {
 				fmt.Sprintf("GROUP_ID=%d", os.Getgid()),
 			}
 			runPath := t.TempDir()
+			// Content is written by root in the container so it cannot be removed by the test cleanup.
+			contentPath, err := os.MkdirTemp("", "containerd-content")
+			require.NoError(t, err)
 			createOpt := client.ContainerCreateOptions{
 				Config: &container.Config{
 					Image: img.String(),
@@ -97,6 +104,11 @@ func TestContainerdPull(t *testing.T) {
 							Source: runPath,
 							Target: "/run/containerd-sock",
 						},
+						{
+							Type:   mount.TypeBind,
+							Source: contentPath,
+							Target: "/var/lib/containerd/io.containerd.content.v1.content",
+						},
 					},
 				},
 			}
@@ -118,7 +130,7 @@ func TestContainerdPull(t *testing.T) {
 			require.NoError(t, err)
 			imageClient := runtimeapi.NewImageServiceClient(connClient)
 
-			containerdStore, err := containerd.NewContainerd(t.Context(), socketPath, "k8s.io")
+			containerdStore, err := containerd.NewContainerd(t.Context(), socketPath, []string{"k8s.io"}, containerd.WithContentPath(contentPath))
 			require.NoError(t, err)
 			name := containerdStore.Name()
 			require.EqualT(t, "containerd", name)
@@ -146,8 +158,8 @@ func TestContainerdPull(t *testing.T) {
 				expectedCreateEvents := []oci.OCIEvent{}
 				expectedDeleteEvents := []oci.OCIEvent{}
 				if benchmarkImg.Tag != "" && benchmarkImg.Digest == "" {
-					expectedCreateEvents = append(expectedCreateEvents, oci.OCIEvent{Type: oci.CreateEvent, Reference: benchmarkImg.Reference})
-					expectedDeleteEvents = append(expectedDeleteEvents, oci.OCIEvent{Type: oci.DeleteEvent, Reference: benchmarkImg.Reference})
+					expectedCreateEvents = append(expectedCreateEvents, oci.OCIEvent{Type: oci.CreateEvent, Reference: benchmarkImg.Reference, Namespace: "k8s.io"})
+					expectedDeleteEvents = append(expectedDeleteEvents, oci.OCIEvent{Type: oci.DeleteEvent, Reference: benchmarkImg.Reference, Namespace: "k8s.io"})
 				}
 				for _, desc := range expectedDescs {
 					ref := oci.Reference{
@@ -155,8 +167,8 @@ func TestContainerdPull(t *testing.T) {
 						Repository: benchmarkImg.Repository,
 						Digest:     desc.Digest,
 					}
-					expectedCreateEvents = append(expectedCreateEvents, oci.OCIEvent{Type: oci.CreateEvent, Reference: ref})
-					expectedDeleteEvents = append(expectedDeleteEvents, oci.OCIEvent{Type: oci.DeleteEvent, Reference: ref})
+					expectedCreateEvents = append(expectedCreateEvents, oci.OCIEvent{Type: oci.CreateEvent, Reference: ref, Namespace: "k8s.io"})
+					expectedDeleteEvents = append(expectedDeleteEvents, oci.OCIEvent{Type: oci.DeleteEvent, Reference: ref, Namespace: "k8s.io"})
 				}
 
 				t.Log("Pulling image with CRI", benchmarkImg.String())
@@ -182,6 +194,41 @@ func TestContainerdPull(t *testing.T) {
 				testutil.EnsureEvents(t, eventCh, expectedDeleteEvents)
 			}
 
+			t.Log("Streaming content while it is being written")
+			blob := []byte(strings.Repeat("Lorem Ipsum Dolor ", 1024))
+			blobDesc := ocispec.Descriptor{MediaType: "application/octet-stream", Digest: digest.FromBytes(blob), Size: int64(len(blob))}
+			cw, err := containerdStore.Writer(t.Context(), oci.Reference{Registry: "example.com", Repository: "ingest"}, blobDesc)
+			require.NoError(t, err)
+			_, err = cw.Write(blob[:len(blob)/2])
+			require.NoError(t, err)
+			require.EventuallyWith(t, func(collect *assert.CollectT) {
+				dgsts, err := containerdStore.ListIngests(t.Context())
+				require.NoError(collect, err)
+				require.True(collect, slices.Contains(dgsts, blobDesc.Digest))
+			}, 5*time.Second, 100*time.Millisecond)
+			ingestDesc, err := containerdStore.IngestDescriptor(t.Context(), blobDesc.Digest)
+			require.NoError(t, err)
+			require.EqualT(t, blobDesc.Size, ingestDesc.Size)
+			rc, err := containerdStore.OpenIngest(t.Context(), blobDesc.Digest)
+			require.NoError(t, err)
+			half := make([]byte, len(blob)/2)
+			_, err = io.ReadFull(rc, half)
+			require.NoError(t, err)
+			require.SliceEqualT(t, blob[:len(blob)/2], half)
+			_, err = cw.Write(blob[len(blob)/2:])
+			require.NoError(t, err)
+			err = cw.Commit(t.Context())
+			require.NoError(t, err)
+			err = cw.Close()
+			require.NoError(t, err)
+			rest, err := io.ReadAll(rc)
+			require.NoError(t, err)
+			require.SliceEqualT(t, blob[len(blob)/2:], rest)
+			err = rc.Close()
+			require.NoError(t, err)
+			_, err = containerdStore.Descriptor(t.Context(), blobDesc.Digest)
+			require.NoError(t, err)
+
 			t.Log("Closing Containerd store")
 			err = connClient.Close()
 			require.NoError(t, err)